@@ -3,45 +3,93 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"codewithumam-tugas1/database"
 )
 
-const (
-	maxNameLength        = 255
-	maxDescriptionLength = 5000
-)
+// maxNameLength limits names that are not validated by a request struct tag
+const maxNameLength = 255
+
+// categoryRequest is the request body for creating, updating or patching a category.
+// A nil Description is stored as NULL and a nil ParentID makes the category top-level.
+type categoryRequest struct {
+	Name        string  `json:"name" validate:"required,trim,max=255"`
+	Description *string `json:"description" validate:"nullable,trim,max=5000"`
+	ParentID    *int    `json:"parent_id" validate:"nullable,min=1"`
+}
 
 // Categories manages HTTP requests for categories
 type Categories struct {
-	db        *sql.DB
-	tableName string
+	db           *sql.DB
+	tableName    string
+	productTable string
 }
 
 // NewCategories creates a new categories service
-func NewCategories(db *sql.DB, tableName string) *Categories {
+func NewCategories(db *sql.DB, tableName, productTable string) *Categories {
 	return &Categories{
-		db:        db,
-		tableName: tableName,
+		db:           db,
+		tableName:    tableName,
+		productTable: productTable,
 	}
 }
 
-// GetAll handles GET /categories
+// GetAll handles GET /categories?limit=&cursor=&sort=id|name&order=asc|desc&include_deleted=true
 func (c *Categories) GetAll(w http.ResponseWriter, r *http.Request) {
-	categories, err := database.GetAll(c.db, c.tableName)
+	q := r.URL.Query()
+	limit, cursor, desc, err := parsePageParams(q)
 	if err != nil {
-		http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	sort := q.Get("sort")
+	if sort != "" && sort != "id" && sort != "name" {
+		writeBadRequest(w, r, &fieldError{"sort", "sort must be id or name"})
+		return
+	}
+
+	includeDeleted, err := parseOptionalBool(q, "include_deleted")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	page, err := database.ListCategories(c.db, c.tableName, database.CategoryListParams{
+		Limit:  limit,
+		Cursor: cursor,
+		Sort:   sort,
+		Desc:   desc,
+
+		IncludeDeleted: includeDeleted != nil && *includeDeleted,
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			writeBadRequest(w, r, &fieldError{"cursor", "Invalid cursor"})
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve categories")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if categories == nil {
-		categories = []database.Category{}
+	json.NewEncoder(w).Encode(page)
+}
+
+// Tree handles GET /categories/tree
+func (c *Categories) Tree(w http.ResponseWriter, r *http.Request) {
+	tree, err := database.GetCategoryTree(c.db, c.tableName)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve categories")
+		return
 	}
-	json.NewEncoder(w).Encode(categories)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
 }
 
 // GetByID handles GET /categories/{id}
@@ -49,128 +97,225 @@ func (c *Categories) GetByID(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
 
 	cat, err := database.GetByID(c.db, c.tableName, id)
 	if err != nil {
-		http.Error(w, "Category not found", http.StatusNotFound)
+		if errors.Is(err, database.ErrCategoryNotFound) {
+			writeError(w, r, http.StatusNotFound, codeCategoryNotFound, "Category not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve category")
 		return
 	}
 
+	setETag(w, cat.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(cat)
 }
 
 // Create handles POST /categories
 func (c *Categories) Create(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+	var req categoryRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	cat, err := database.Create(c.db, c.tableName, req.Name, req.Description, req.ParentID)
+	if err != nil {
+		if errors.Is(err, database.ErrParentCategoryNotFound) {
+			writeBadRequest(w, r, &fieldError{"parent_id", "Parent category not found"})
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to create category")
 		return
 	}
 
-	// Trim whitespace
-	req.Name = strings.TrimSpace(req.Name)
-	req.Description = strings.TrimSpace(req.Description)
+	setETag(w, cat.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cat)
+}
 
-	// Validate name
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+// Update handles PUT /categories/{id}. An If-Match header makes the update
+// conditional on the category's current ETag.
+func (c *Categories) Update(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
-	if len(req.Name) > maxNameLength {
-		http.Error(w, "Name must be 255 characters or less", http.StatusBadRequest)
+
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Category has been modified")
 		return
 	}
-	if len(req.Description) > maxDescriptionLength {
-		http.Error(w, "Description must be 5000 characters or less", http.StatusBadRequest)
+
+	var req categoryRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	cat, err := database.Create(c.db, c.tableName, req.Name, req.Description)
+	cat, err := database.Update(c.db, c.tableName, id, req.Name, req.Description, req.ParentID, expectedVersion)
 	if err != nil {
-		http.Error(w, "Failed to create category", http.StatusInternalServerError)
+		writeCategoryUpdateError(w, r, err)
 		return
 	}
 
+	setETag(w, cat.Version)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(cat)
 }
 
-// Update handles PUT /categories/{id}
-func (c *Categories) Update(w http.ResponseWriter, r *http.Request) {
+// Patch handles PATCH /categories/{id} with a JSON Merge Patch (RFC 7396)
+// body. Absent fields keep their current value; null clears the description
+// or makes the category top-level when sent as parent_id. An If-Match header
+// makes the patch conditional on the category's current ETag.
+func (c *Categories) Patch(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
 
-	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Category has been modified")
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !isMergePatchRequest(r) {
+		writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
 		return
 	}
 
-	// Trim whitespace
-	req.Name = strings.TrimSpace(req.Name)
-	req.Description = strings.TrimSpace(req.Description)
+	for attempt := 1; ; attempt++ {
+		current, err := database.GetByID(c.db, c.tableName, id)
+		if err != nil {
+			if errors.Is(err, database.ErrCategoryNotFound) {
+				writeError(w, r, http.StatusNotFound, codeCategoryNotFound, "Category not found")
+				return
+			}
+			writeDatabaseError(w, r, err, "Failed to retrieve category")
+			return
+		}
+		if expectedVersion != 0 && current.Version != expectedVersion {
+			writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Category has been modified")
+			return
+		}
+
+		req := categoryRequest{
+			Name:        current.Name,
+			Description: current.Description,
+			ParentID:    current.ParentID,
+		}
+		if err := decodePatch(patch, &req); err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
 
-	// Validate name
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		cat, err := database.Update(c.db, c.tableName, id, req.Name, req.Description, req.ParentID, current.Version)
+		if errors.Is(err, database.ErrVersionMismatch) && expectedVersion == 0 && attempt < maxPatchAttempts {
+			// Changed since it was read; apply the patch to the new state
+			continue
+		}
+		if err != nil {
+			writeCategoryUpdateError(w, r, err)
+			return
+		}
+
+		setETag(w, cat.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cat)
 		return
 	}
-	if len(req.Name) > maxNameLength {
-		http.Error(w, "Name must be 255 characters or less", http.StatusBadRequest)
+}
+
+// writeCategoryUpdateError maps an Update error to an HTTP response
+func writeCategoryUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrVersionMismatch):
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Category has been modified")
+	case errors.Is(err, database.ErrParentCategoryNotFound):
+		writeBadRequest(w, r, &fieldError{"parent_id", "Parent category not found"})
+	case errors.Is(err, database.ErrCategoryCycle):
+		writeError(w, r, http.StatusConflict, codeCategoryCycle, "A category cannot be moved under itself or its subcategories")
+	case errors.Is(err, database.ErrCategoryNotFound):
+		writeError(w, r, http.StatusNotFound, codeCategoryNotFound, "Category not found")
+	default:
+		writeDatabaseError(w, r, err, "Failed to update category")
+	}
+}
+
+// Delete handles DELETE /categories/{id}. An If-Match header makes the delete
+// conditional on the category's current ETag.
+func (c *Categories) Delete(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
-	if len(req.Description) > maxDescriptionLength {
-		http.Error(w, "Description must be 5000 characters or less", http.StatusBadRequest)
+
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Category has been modified")
 		return
 	}
 
-	cat, err := database.Update(c.db, c.tableName, id, req.Name, req.Description)
+	err = database.Delete(c.db, c.tableName, c.productTable, id, expectedVersion)
 	if err != nil {
-		http.Error(w, "Category not found", http.StatusNotFound)
+		switch {
+		case errors.Is(err, database.ErrVersionMismatch):
+			writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Category has been modified")
+		case errors.Is(err, database.ErrCategoryNotFound):
+			writeError(w, r, http.StatusNotFound, codeCategoryNotFound, "Category not found")
+		case errors.Is(err, database.ErrCategoryInUse):
+			writeError(w, r, http.StatusConflict, codeCategoryInUse, "Cannot delete category that has products or subcategories")
+		default:
+			writeDatabaseError(w, r, err, "Failed to delete category")
+		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(cat)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// Delete handles DELETE /categories/{id}
-func (c *Categories) Delete(w http.ResponseWriter, r *http.Request) {
+// Restore handles POST /categories/{id}/restore
+func (c *Categories) Restore(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
 
-	err = database.Delete(c.db, c.tableName, id)
+	cat, err := database.RestoreCategory(c.db, c.tableName, id)
 	if err != nil {
-		// Check if it's a "not found" error or a foreign key constraint error
-		if err.Error() == "category not found" {
-			http.Error(w, "Category not found", http.StatusNotFound)
-		} else {
-			// Foreign key constraint or other database error
-			http.Error(w, "Cannot delete category that has products", http.StatusConflict)
+		switch {
+		case errors.Is(err, database.ErrCategoryNotFound):
+			writeError(w, r, http.StatusNotFound, codeCategoryNotFound, "Category not found")
+		case errors.Is(err, database.ErrCategoryDeleted):
+			writeError(w, r, http.StatusConflict, codeCategoryDeleted, "Restore the parent category first")
+		default:
+			writeDatabaseError(w, r, err, "Failed to restore category")
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, cat.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cat)
 }
@@ -4,8 +4,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"strings"
 
 	"codewithumam-tugas1/database"
 )
@@ -13,51 +13,87 @@ import (
 // Checkout handles checkout requests
 // It creates a transaction and updates product stock atomically.
 type Checkout struct {
-	db                     *sql.DB
-	productTable           string
-	categoryTable          string
-	transactionTable       string
-	transactionDetailTable string
+	db     *sql.DB
+	tables database.Tables
 }
 
 // NewCheckout creates a new checkout service
-func NewCheckout(db *sql.DB, productTable, categoryTable, transactionTable, transactionDetailTable string) *Checkout {
+func NewCheckout(db *sql.DB, tables database.Tables) *Checkout {
 	return &Checkout{
-		db:                     db,
-		productTable:           productTable,
-		categoryTable:          categoryTable,
-		transactionTable:       transactionTable,
-		transactionDetailTable: transactionDetailTable,
+		db:     db,
+		tables: tables,
 	}
 }
 
-// Create handles POST /checkout
+// maxIdempotencyKeyLength is the longest accepted Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// Create handles POST /checkout. With an Idempotency-Key header a retry of the
+// same request returns the original 201 response body byte for byte instead
+// of checking out again, and another request under the key gets 422.
 func (c *Checkout) Create(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(key) > maxIdempotencyKeyLength {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Idempotency-Key must be 255 characters or less")
+		return
+	}
+
 	var req database.CheckoutRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	transaction, err := database.Checkout(c.db, c.productTable, c.categoryTable, c.transactionTable, c.transactionDetailTable, req.Items)
+	var transaction database.Transaction
+	var response []byte
+	var replayed bool
+	var err error
+	if key != "" {
+		response, replayed, err = database.IdempotentCheckout(c.db, c.tables, key, req)
+	} else {
+		transaction, err = database.Checkout(c.db, c.tables, req.OutletID, req.Items, req.Payments)
+	}
 	if err != nil {
+		var stockErr *database.StockError
 		switch {
+		case errors.Is(err, database.ErrIdempotencyConflict):
+			writeError(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "Idempotency-Key was used for a different request")
+			return
 		case errors.Is(err, database.ErrCheckoutEmptyItems), errors.Is(err, database.ErrInvalidCheckoutItem):
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBadRequest(w, r, &fieldError{"items", err.Error()})
+			return
+		case errors.Is(err, database.ErrInvalidPayment), errors.Is(err, database.ErrPaymentReferenceRequired):
+			writeTransactionError(w, r, err, "Failed to checkout")
+			return
+		case errors.Is(err, database.ErrOutletNotFound):
+			writeBadRequest(w, r, &fieldError{"outlet_id", "Outlet does not exist"})
 			return
 		case errors.Is(err, database.ErrProductNotFound):
-			http.Error(w, "Product not found", http.StatusNotFound)
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+			return
+		case errors.Is(err, database.ErrVariantNotFound):
+			writeError(w, r, http.StatusNotFound, codeVariantNotFound, "Variant not found")
+			return
+		case errors.Is(err, database.ErrProductDeleted):
+			writeError(w, r, http.StatusGone, codeProductDeleted, "Product has been deleted")
 			return
-		case errors.Is(err, database.ErrInsufficientStock):
-			http.Error(w, "Insufficient stock", http.StatusBadRequest)
+		case errors.As(err, &stockErr):
+			writeStockError(w, r, stockErr)
 			return
 		default:
-			http.Error(w, fmt.Sprintf("Failed to checkout: %v", err), http.StatusInternalServerError)
+			writeDatabaseError(w, r, err, "Failed to checkout")
 			return
 		}
 	}
 
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	if response != nil {
+		w.Write(response)
+		return
+	}
 	json.NewEncoder(w).Encode(transaction)
 }
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"codewithumam-tugas1/database"
+)
+
+// Error codes returned in the code field of error responses. Clients should
+// branch on the code; the message is meant for people and may change.
+const (
+	codeInvalidRequest        = "invalid_request"
+	codeNotFound              = "not_found"
+	codeValidationFailed      = "validation_failed"
+	codeProductNotFound       = "product_not_found"
+	codeCategoryNotFound      = "category_not_found"
+	codeVariantNotFound       = "variant_not_found"
+	codeVersionMismatch       = "version_mismatch"
+	codeDuplicateCode         = "duplicate_code"
+	codeCategoryInUse         = "category_in_use"
+	codeCategoryCycle         = "category_cycle"
+	codeCategoryDeleted       = "category_deleted"
+	codeProductDeleted        = "product_deleted"
+	codeInsufficientStock     = "insufficient_stock"
+	codeInsufficientPayment   = "insufficient_payment"
+	codeSupplierNotFound      = "supplier_not_found"
+	codeOutletNotFound        = "outlet_not_found"
+	codePurchaseOrderNotFound = "purchase_order_not_found"
+	codeTransferNotFound      = "stock_transfer_not_found"
+	codeStockTakeNotFound     = "stock_take_not_found"
+	codeStockTakeOpen         = "stock_take_open"
+	codeShiftNotFound         = "shift_not_found"
+	codeShiftOpen             = "shift_open"
+	codeInvalidStatus         = "invalid_status"
+	codeReceiptExceedsOrder   = "receipt_exceeds_order"
+	codeReturnExceedsSale     = "return_exceeds_sale"
+	codeIdempotencyKeyReused  = "idempotency_key_reused"
+	codeTransactionNotFound   = "transaction_not_found"
+	codeTransactionSettled    = "transaction_settled"
+	codeTransactionVoided     = "transaction_voided"
+	codeTransactionReturned   = "transaction_returned"
+	codeVoidWindowExpired     = "void_window_expired"
+	codeUnsupportedMediaType  = "unsupported_media_type"
+	codeConflict              = "conflict"
+	codeConcurrentUpdate      = "concurrent_update"
+	codeInternal              = "internal_error"
+)
+
+// errorResponse is the JSON body of every error response
+type errorResponse struct {
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// fieldError is a validation failure of a single request field, such as a
+// body member or query parameter
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *fieldError) Error() string {
+	return e.Message
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorDetails(w, r, status, code, message, nil)
+}
+
+// NotFound writes a 404 error response for a path that matches no endpoint
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, codeNotFound, "Endpoint not found")
+}
+
+// writeErrorDetails writes a JSON error response with additional details
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestIDFrom(r.Context()),
+	})
+}
+
+// writeBadRequest answers a request that failed parsing or validation with
+// 400. A fieldError or fieldErrors is reported as validation_failed with the
+// failing fields in details; any other error as invalid_request.
+func writeBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		writeErrorDetails(w, r, http.StatusBadRequest, codeValidationFailed, fe.Message, map[string]interface{}{fe.Field: fe.Message})
+		return
+	}
+	var errs fieldErrors
+	if errors.As(err, &errs) {
+		details := make(map[string]interface{}, len(errs))
+		for field, message := range errs {
+			details[field] = message
+		}
+		writeErrorDetails(w, r, http.StatusBadRequest, codeValidationFailed, errs.Error(), details)
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+}
+
+// writeDatabaseError answers a database error the handler has no specific
+// response for. Serialization failures and deadlocks can be retried by the
+// client, constraint violations mean the request conflicts with the current
+// data, and anything else is logged and reported as a server error with message.
+func writeDatabaseError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrSerializationFailure):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusServiceUnavailable, codeConcurrentUpdate, "Conflicting concurrent request, please retry")
+	case errors.Is(err, database.ErrForeignKeyViolation), errors.Is(err, database.ErrUniqueViolation):
+		writeError(w, r, http.StatusConflict, codeConflict, "Request conflicts with existing data")
+	default:
+		log.Printf("request %s: %s: %v", requestIDFrom(r.Context()), message, err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, message)
+	}
+}
+
+// writeStockError answers a write that needed more stock than is available
+func writeStockError(w http.ResponseWriter, r *http.Request, stockErr *database.StockError) {
+	details := map[string]interface{}{
+		"product_id": stockErr.ProductID,
+		"requested":  stockErr.Requested,
+		"available":  stockErr.Available,
+	}
+	if stockErr.VariantID != 0 {
+		details["variant_id"] = stockErr.VariantID
+	}
+	if stockErr.OutletID != 0 {
+		details["outlet_id"] = stockErr.OutletID
+	}
+	writeErrorDetails(w, r, http.StatusBadRequest, codeInsufficientStock, "Insufficient stock", details)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag sets the ETag header for a resource at the given version
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion reads the If-Match header. It returns the version the client
+// expects (0 when the header is absent or "*") and false when the header can
+// never match a version, which callers must answer with 412.
+func ifMatchVersion(r *http.Request) (int, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, true
+	}
+
+	// Only a single strong ETag can match; weak (W/"...") validators never do
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"codewithumam-tugas1/database"
+)
+
+// stockAdjustmentRequest is the request body of a stock adjustment
+type stockAdjustmentRequest struct {
+	VariantID int    `json:"variant_id" validate:"nullable,min=1"`
+	OutletID  int    `json:"outlet_id" validate:"nullable,min=1"`
+	Delta     int    `json:"delta" validate:"required"`
+	Reason    string `json:"reason" validate:"required"`
+	Note      string `json:"note" validate:"required,trim,max=1000"`
+}
+
+func (req *stockAdjustmentRequest) check(errs fieldErrors) {
+	if req.Delta == 0 {
+		errs.add("delta", "delta cannot be 0")
+	}
+	if req.Reason != "" && !database.ValidAdjustmentReason(req.Reason) {
+		errs.add("reason", "reason must be one of "+strings.Join(database.AdjustmentReasons, ", "))
+	}
+}
+
+// lotRequest is the request body for assigning stock already at an outlet to
+// a lot. The default outlet is used unless outlet_id is set.
+type lotRequest struct {
+	VariantID  int    `json:"variant_id" validate:"nullable,min=1"`
+	OutletID   int    `json:"outlet_id" validate:"nullable,min=1"`
+	LotNumber  string `json:"lot_number" validate:"required,trim,max=64"`
+	ExpiryDate string `json:"expiry_date" validate:"required"`
+	Quantity   int    `json:"quantity" validate:"required,min=1"`
+}
+
+func (req *lotRequest) check(errs fieldErrors) {
+	checkLot(errs, "", req.LotNumber, req.ExpiryDate)
+}
+
+// checkLot validates the lot number and expiry date of a lot, naming the
+// fields with prefix
+func checkLot(errs fieldErrors, prefix, lotNumber, expiryDate string) {
+	if lotNumber == "" {
+		errs.add(prefix+"lot_number", prefix+"lot_number is required")
+	} else if len(lotNumber) > 64 {
+		errs.add(prefix+"lot_number", prefix+"lot_number must be 64 characters or less")
+	}
+	if _, err := time.Parse("2006-01-02", expiryDate); err != nil {
+		errs.add(prefix+"expiry_date", prefix+"expiry_date must be a date in YYYY-MM-DD format")
+	}
+}
+
+// defaultExpiringDays is the window of GET /inventory/expiring without
+// within_days
+const defaultExpiringDays = 30
+
+// Defaults of GET /inventory/reorder-suggestions
+const (
+	defaultSalesWindowDays = 30
+	defaultLeadDays        = 7
+	maxSalesWindowDays     = 365
+)
+
+// Inventory handles the stock ledger of products
+type Inventory struct {
+	db     *sql.DB
+	tables database.Tables
+}
+
+// NewInventory creates a new inventory service
+func NewInventory(db *sql.DB, tables database.Tables) *Inventory {
+	return &Inventory{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// StockHistory handles GET /products/{id}/stock-history with cursor
+// pagination (limit, cursor). Movements are listed newest first.
+func (i *Inventory) StockHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	limit, cursor, _, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	page, err := database.GetStockHistory(i.db, i.tables.InventoryMovement, i.tables.Product, id, limit, cursor)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrProductNotFound):
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+		case errors.Is(err, database.ErrInvalidCursor):
+			writeBadRequest(w, r, &fieldError{"cursor", "Invalid cursor"})
+		default:
+			writeDatabaseError(w, r, err, "Failed to retrieve stock history")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// Adjust handles POST /products/{id}/stock-adjustments. The delta is added to
+// the current stock of the product, or of the variant given by variant_id, at
+// the outlet given by outlet_id or the default outlet.
+func (i *Inventory) Adjust(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req stockAdjustmentRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	adj, err := database.AdjustStock(i.db, i.tables, database.StockAdjustment{
+		ProductID: id,
+		VariantID: req.VariantID,
+		OutletID:  req.OutletID,
+		Delta:     req.Delta,
+		Reason:    req.Reason,
+		Note:      req.Note,
+	})
+	if err != nil {
+		var stockErr *database.StockError
+		switch {
+		case errors.Is(err, database.ErrProductNotFound):
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+		case errors.Is(err, database.ErrVariantNotFound):
+			writeError(w, r, http.StatusNotFound, codeVariantNotFound, "Variant not found")
+		case errors.Is(err, database.ErrOutletNotFound):
+			writeBadRequest(w, r, &fieldError{"outlet_id", "Outlet does not exist"})
+		case errors.As(err, &stockErr):
+			writeStockError(w, r, stockErr)
+		default:
+			writeDatabaseError(w, r, err, "Failed to adjust stock")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(adj)
+}
+
+// Lots handles GET /products/{id}/lots, which lists the lots of a product
+// that still hold stock, earliest expiry first
+func (i *Inventory) Lots(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	lots, err := database.GetLots(i.db, i.tables, id)
+	if err != nil {
+		if errors.Is(err, database.ErrProductNotFound) {
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve lots")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lots)
+}
+
+// CreateLot handles POST /products/{id}/lots, which assigns stock already at
+// an outlet to a lot. Goods delivered with a lot number are booked through
+// purchase order receipts instead.
+func (i *Inventory) CreateLot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req lotRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	lot, err := database.CreateLot(i.db, i.tables, database.Lot{
+		ProductID:  id,
+		VariantID:  req.VariantID,
+		OutletID:   req.OutletID,
+		LotNumber:  req.LotNumber,
+		ExpiryDate: req.ExpiryDate,
+		Quantity:   req.Quantity,
+	})
+	if err != nil {
+		var stockErr *database.StockError
+		switch {
+		case errors.Is(err, database.ErrProductNotFound):
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+		case errors.Is(err, database.ErrVariantNotFound):
+			writeError(w, r, http.StatusNotFound, codeVariantNotFound, "Variant not found")
+		case errors.Is(err, database.ErrOutletNotFound):
+			writeBadRequest(w, r, &fieldError{"outlet_id", "Outlet does not exist"})
+		case errors.Is(err, database.ErrInvalidLot):
+			writeBadRequest(w, r, &fieldError{"lot_number", "Lot number already exists with another expiry date"})
+		case errors.As(err, &stockErr):
+			writeStockError(w, r, stockErr)
+		default:
+			writeDatabaseError(w, r, err, "Failed to create lot")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(lot)
+}
+
+// Expiring handles GET /inventory/expiring, which lists the lots with stock
+// that expire within within_days days (default 30), including lots that
+// have already expired, optionally at one outlet (outlet_id)
+func (i *Inventory) Expiring(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	days := defaultExpiringDays
+	withinDays, err := parseOptionalInt(q, "within_days")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if withinDays != nil {
+		if *withinDays < 0 {
+			writeBadRequest(w, r, &fieldError{"within_days", "within_days cannot be negative"})
+			return
+		}
+		days = *withinDays
+	}
+	outletID, err := parseOptionalInt(q, "outlet_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	outlet := 0
+	if outletID != nil {
+		outlet = *outletID
+	}
+
+	lots, err := database.GetExpiringLots(i.db, i.tables, time.Now().UTC().AddDate(0, 0, days), outlet)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve expiring lots")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lots)
+}
+
+// LowStock handles GET /inventory/low-stock, which lists the products at or
+// below their reorder point
+func (i *Inventory) LowStock(w http.ResponseWriter, r *http.Request) {
+	products, err := database.GetLowStockProducts(i.db, i.tables)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve low-stock products")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// ReorderSuggestions handles GET /inventory/reorder-suggestions, which
+// proposes order quantities per supplier from the sales of the last
+// window_days days (default 30) and a lead time of lead_days days (default 7)
+func (i *Inventory) ReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := database.ReorderParams{
+		WindowDays: defaultSalesWindowDays,
+		LeadDays:   defaultLeadDays,
+		Now:        time.Now().UTC(),
+	}
+
+	windowDays, err := parseOptionalInt(q, "window_days")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if windowDays != nil {
+		if *windowDays <= 0 || *windowDays > maxSalesWindowDays {
+			writeBadRequest(w, r, &fieldError{"window_days", "window_days must be between 1 and 365"})
+			return
+		}
+		params.WindowDays = *windowDays
+	}
+	leadDays, err := parseOptionalInt(q, "lead_days")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if leadDays != nil {
+		if *leadDays < 0 || *leadDays > maxSalesWindowDays {
+			writeBadRequest(w, r, &fieldError{"lead_days", "lead_days must be between 0 and 365"})
+			return
+		}
+		params.LeadDays = *leadDays
+	}
+
+	suppliers, err := database.GetReorderSuggestions(i.db, i.tables, params)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve reorder suggestions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
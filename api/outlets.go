@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"codewithumam-tugas1/database"
+)
+
+// outletRequest is the request body for creating or updating an outlet
+type outletRequest struct {
+	Name    string `json:"name" validate:"required,trim,max=255"`
+	Address string `json:"address" validate:"nullable,trim,max=1000"`
+}
+
+// Outlets manages HTTP requests for outlets
+type Outlets struct {
+	db        *sql.DB
+	tableName string
+}
+
+// NewOutlets creates a new outlets service
+func NewOutlets(db *sql.DB, tableName string) *Outlets {
+	return &Outlets{db: db, tableName: tableName}
+}
+
+// GetAll handles GET /outlets
+func (o *Outlets) GetAll(w http.ResponseWriter, r *http.Request) {
+	outlets, err := database.GetOutlets(o.db, o.tableName)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve outlets")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outlets)
+}
+
+// GetByID handles GET /outlets/{id}
+func (o *Outlets) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	outlet, err := database.GetOutletByID(o.db, o.tableName, id)
+	if err != nil {
+		if errors.Is(err, database.ErrOutletNotFound) {
+			writeError(w, r, http.StatusNotFound, codeOutletNotFound, "Outlet not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve outlet")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outlet)
+}
+
+// Create handles POST /outlets. Outlet names must be unique.
+func (o *Outlets) Create(w http.ResponseWriter, r *http.Request) {
+	var req outletRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	outlet, err := database.CreateOutlet(o.db, o.tableName, database.Outlet{Name: req.Name, Address: req.Address})
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to create outlet")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(outlet)
+}
+
+// Update handles PUT /outlets/{id}
+func (o *Outlets) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req outletRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	outlet, err := database.UpdateOutlet(o.db, o.tableName, database.Outlet{ID: id, Name: req.Name, Address: req.Address})
+	if err != nil {
+		if errors.Is(err, database.ErrOutletNotFound) {
+			writeError(w, r, http.StatusNotFound, codeOutletNotFound, "Outlet not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to update outlet")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outlet)
+}
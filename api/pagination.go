@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// parseOptionalInt reads an integer query parameter. It returns nil when the
+// parameter is absent.
+func parseOptionalInt(q url.Values, key string) (*int, error) {
+	raw := q.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, &fieldError{key, "Invalid " + key}
+	}
+	return &n, nil
+}
+
+// parseOptionalBool reads a boolean query parameter. It returns nil when the
+// parameter is absent.
+func parseOptionalBool(q url.Values, key string) (*bool, error) {
+	raw := q.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, &fieldError{key, "Invalid " + key}
+	}
+	return &b, nil
+}
+
+// parsePageParams reads limit, cursor and order from the query string.
+// order must be "asc" (default) or "desc".
+func parsePageParams(q url.Values) (limit int, cursor string, desc bool, err error) {
+	l, err := parseOptionalInt(q, "limit")
+	if err != nil {
+		return 0, "", false, err
+	}
+	if l != nil {
+		if *l <= 0 {
+			return 0, "", false, &fieldError{"limit", "limit must be greater than 0"}
+		}
+		limit = *l
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		return 0, "", false, &fieldError{"order", "order must be asc or desc"}
+	}
+
+	return limit, q.Get("cursor"), desc, nil
+}
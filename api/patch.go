@@ -0,0 +1,24 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+)
+
+// maxPatchAttempts bounds how often an unconditional PATCH re-reads the
+// resource when a concurrent write changes it between read and update
+const maxPatchAttempts = 3
+
+// isMergePatchRequest reports whether the request body may be treated as a
+// JSON Merge Patch (RFC 7396). Plain application/json is accepted as well.
+func isMergePatchRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/merge-patch+json" || mediaType == "application/json"
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,29 +12,173 @@ import (
 	"codewithumam-tugas1/database"
 )
 
+// checkProductCodes checks the optional SKU and barcode of a product.
+// SKUs may contain letters, digits, '-', '_' and '.'; barcodes must be
+// EAN-8, UPC-A, EAN-13 or GTIN-14 with a valid check digit.
+func checkProductCodes(errs fieldErrors, sku, barcode string) {
+	for _, r := range sku {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			errs.add("sku", "sku may only contain letters, digits, '-', '_' and '.'")
+			break
+		}
+	}
+	if barcode != "" && !database.ValidBarcode(barcode) {
+		errs.add("barcode", "barcode must be EAN-8, UPC-A, EAN-13 or GTIN-14 with a valid check digit")
+	}
+}
+
+// productRequest is the request body for creating, updating or patching a product.
+// The category is checked against the database separately.
+type productRequest struct {
+	Name         string `json:"name" validate:"required,trim,max=255"`
+	Price        int    `json:"price" validate:"required,min=1"`
+	Stock        int    `json:"stock" validate:"required,min=0"`
+	CategoryID   int    `json:"category_id" validate:"required,min=1"`
+	SKU          string `json:"sku" validate:"nullable,trim,max=64"`
+	Barcode      string `json:"barcode" validate:"nullable,trim"`
+	ReorderPoint int    `json:"reorder_point" validate:"nullable,min=0"`
+	ReorderQty   int    `json:"reorder_qty" validate:"nullable,min=0"`
+}
+
+func (req *productRequest) check(errs fieldErrors) {
+	checkProductCodes(errs, req.SKU, req.Barcode)
+}
+
+// product returns the product described by the request
+func (req *productRequest) product() database.Product {
+	return database.Product{
+		Name:         req.Name,
+		Price:        req.Price,
+		Stock:        req.Stock,
+		CategoryID:   req.CategoryID,
+		SKU:          req.SKU,
+		Barcode:      req.Barcode,
+		ReorderPoint: req.ReorderPoint,
+		ReorderQty:   req.ReorderQty,
+	}
+}
+
 // Products manages HTTP requests for products
 type Products struct {
-	db        *sql.DB
-	tableName string
+	db     *sql.DB
+	tables database.Tables
 }
 
 // NewProducts creates a new products service
-func NewProducts(db *sql.DB, tableName string) *Products {
-	return &Products{db: db, tableName: tableName}
+func NewProducts(db *sql.DB, tables database.Tables) *Products {
+	return &Products{
+		db:     db,
+		tables: tables,
+	}
 }
 
-// GetAll handles GET /products
+// GetAll handles GET /products with optional filters (category_id, min_price,
+// max_price, in_stock, include_deleted), sorting (sort=id|name|price|stock,
+// order=asc|desc) and cursor pagination (limit, cursor). Each product lists its
+// stock per outlet; outlet_id narrows stock, in_stock and sort=stock to one outlet.
 func (p *Products) GetAll(w http.ResponseWriter, r *http.Request) {
-	products, err := database.GetAllProducts(p.db, p.tableName, "category")
+	q := r.URL.Query()
+	limit, cursor, desc, err := parsePageParams(q)
 	if err != nil {
-		http.Error(w, "Failed to retrieve products", http.StatusInternalServerError)
+		writeBadRequest(w, r, err)
 		return
 	}
+
+	params := database.ProductListParams{
+		Limit:  limit,
+		Cursor: cursor,
+		Sort:   q.Get("sort"),
+		Desc:   desc,
+	}
+
+	categoryID, err := parseOptionalInt(q, "category_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if categoryID != nil {
+		params.CategoryID = *categoryID
+	}
+	if params.MinPrice, err = parseOptionalInt(q, "min_price"); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if params.MaxPrice, err = parseOptionalInt(q, "max_price"); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if params.MinPrice != nil && params.MaxPrice != nil && *params.MinPrice > *params.MaxPrice {
+		writeBadRequest(w, r, &fieldError{"min_price", "min_price must not be greater than max_price"})
+		return
+	}
+	if params.InStock, err = parseOptionalBool(q, "in_stock"); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	includeDeleted, err := parseOptionalBool(q, "include_deleted")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	params.IncludeDeleted = includeDeleted != nil && *includeDeleted
+	outletID, err := parseOptionalInt(q, "outlet_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if outletID != nil {
+		params.OutletID = *outletID
+	}
+
+	page, err := database.ListProducts(p.db, p.tables, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrInvalidCursor):
+			writeBadRequest(w, r, &fieldError{"cursor", "Invalid cursor"})
+		case errors.Is(err, database.ErrInvalidSort):
+			writeBadRequest(w, r, &fieldError{"sort", "sort must be id, name, price or stock"})
+		default:
+			writeDatabaseError(w, r, err, "Failed to retrieve products")
+		}
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if products == nil {
-		products = []database.Product{}
+	json.NewEncoder(w).Encode(page)
+}
+
+// maxSearchQueryLength limits the search text accepted by GET /products/search
+const maxSearchQueryLength = 100
+
+// Search handles GET /products/search?q=&limit=
+func (p *Products) Search(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeBadRequest(w, r, &fieldError{"q", "q is required"})
+		return
+	}
+	if len(q) > maxSearchQueryLength {
+		writeBadRequest(w, r, &fieldError{"q", "q must be 100 characters or less"})
+		return
+	}
+
+	limit, _, _, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	matches, err := database.SearchProducts(p.db, p.tables, q, limit)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to search products")
+		return
 	}
-	json.NewEncoder(w).Encode(products)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Query string                  `json:"query"`
+		Data  []database.ProductMatch `json:"data"`
+	}{Query: q, Data: matches})
 }
 
 // GetByID handles GET /products/{id}
@@ -40,156 +186,319 @@ func (p *Products) GetByID(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	prod, err := database.GetProductByID(p.db, p.tables, id)
+	if err != nil {
+		if errors.Is(err, database.ErrProductNotFound) {
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve product")
+		return
+	}
+
+	prod.Variants, err = database.GetVariantsByProductID(p.db, p.tables, id)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve product variants")
+		return
+	}
+
+	setETag(w, prod.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prod)
+}
+
+// GetByBarcode handles GET /products/barcode/{code}
+func (p *Products) GetByBarcode(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimSpace(r.PathValue("code"))
+	if !database.ValidBarcode(code) {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid barcode")
 		return
 	}
 
-	prod, err := database.GetProductByID(p.db, p.tableName, "category", id)
+	prod, err := database.GetProductByBarcode(p.db, p.tables, code)
+	if errors.Is(err, database.ErrProductNotFound) {
+		// A variant barcode resolves to its product, like at checkout
+		prod, err = p.getByVariantBarcode(code)
+	}
 	if err != nil {
-		http.Error(w, "Product not found", http.StatusNotFound)
+		if errors.Is(err, database.ErrProductNotFound) {
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve product")
 		return
 	}
 
+	setETag(w, prod.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(prod)
 }
 
+// getByVariantBarcode returns the product of the variant with the given
+// barcode, with Variants holding only that variant
+func (p *Products) getByVariantBarcode(code string) (database.Product, error) {
+	variant, err := database.GetVariantByBarcode(p.db, p.tables, code)
+	if err != nil {
+		if errors.Is(err, database.ErrVariantNotFound) {
+			return database.Product{}, database.ErrProductNotFound
+		}
+		return database.Product{}, err
+	}
+	prod, err := database.GetProductByID(p.db, p.tables, variant.ProductID)
+	if err != nil {
+		return database.Product{}, err
+	}
+	prod.Variants = []database.ProductVariant{variant}
+	return prod, nil
+}
+
 // Create handles POST /products
 func (p *Products) Create(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name       string `json:"name"`
-		Price      int    `json:"price"`
-		Stock      int    `json:"stock"`
-		CategoryID int    `json:"category_id"`
+	var req productRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	// Validate category exists
+	if _, err := database.GetByID(p.db, p.tables.Category, req.CategoryID); err != nil {
+		if errors.Is(err, database.ErrCategoryNotFound) {
+			writeBadRequest(w, r, &fieldError{"category_id", "Category does not exist"})
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve category")
 		return
 	}
 
-	// Trim whitespace
-	req.Name = strings.TrimSpace(req.Name)
-
-	// Validate name
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	prod, err := database.CreateProduct(p.db, p.tables, req.product())
+	if err != nil {
+		if errors.Is(err, database.ErrDuplicateProductCode) {
+			writeError(w, r, http.StatusConflict, codeDuplicateCode, "SKU or barcode already exists")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to create product")
 		return
 	}
-	if len(req.Name) > maxNameLength {
-		http.Error(w, "Name must be 255 characters or less", http.StatusBadRequest)
+
+	setETag(w, prod.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(prod)
+}
+
+// Update handles PUT /products/{id}. An If-Match header makes the update
+// conditional on the product's current ETag.
+func (p *Products) Update(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
 
-	// Validate price and stock
-	if req.Price <= 0 {
-		http.Error(w, "Price must be greater than 0", http.StatusBadRequest)
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Product has been modified")
 		return
 	}
-	if req.Stock < 0 {
-		http.Error(w, "Stock cannot be negative", http.StatusBadRequest)
+
+	var req productRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
 		return
 	}
 
 	// Validate category exists
-	_, err := database.GetByID(p.db, "category", req.CategoryID)
-	if err != nil {
-		http.Error(w, "Category does not exist", http.StatusBadRequest)
+	if _, err := database.GetByID(p.db, p.tables.Category, req.CategoryID); err != nil {
+		if errors.Is(err, database.ErrCategoryNotFound) {
+			writeBadRequest(w, r, &fieldError{"category_id", "Category does not exist"})
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve category")
 		return
 	}
 
-	prod, err := database.CreateProduct(p.db, p.tableName, "category", req.Name, req.Price, req.Stock, req.CategoryID)
+	update := req.product()
+	update.ID = id
+	prod, err := database.UpdateProduct(p.db, p.tables, update, expectedVersion)
 	if err != nil {
-		http.Error(w, "Failed to create product", http.StatusInternalServerError)
+		writeProductUpdateError(w, r, err)
 		return
 	}
 
+	setETag(w, prod.Version)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(prod)
 }
 
-// Update handles PUT /products/{id}
-func (p *Products) Update(w http.ResponseWriter, r *http.Request) {
+// Patch handles PATCH /products/{id} with a JSON Merge Patch (RFC 7396) body.
+// Absent fields keep their current value and sku or barcode can be cleared
+// with null. An If-Match header makes the patch conditional on the product's
+// current ETag.
+func (p *Products) Patch(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
 
-	var req struct {
-		Name       string `json:"name"`
-		Price      int    `json:"price"`
-		Stock      int    `json:"stock"`
-		CategoryID int    `json:"category_id"`
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Product has been modified")
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !isMergePatchRequest(r) {
+		writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
 		return
 	}
 
-	// Trim whitespace
-	req.Name = strings.TrimSpace(req.Name)
+	for attempt := 1; ; attempt++ {
+		current, err := database.GetProductByID(p.db, p.tables, id)
+		if err != nil {
+			if errors.Is(err, database.ErrProductNotFound) {
+				writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+				return
+			}
+			writeDatabaseError(w, r, err, "Failed to retrieve product")
+			return
+		}
+		if expectedVersion != 0 && current.Version != expectedVersion {
+			writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Product has been modified")
+			return
+		}
 
-	// Validate name
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		req := productRequest{
+			Name:         current.Name,
+			Price:        current.Price,
+			Stock:        current.Stock,
+			CategoryID:   current.CategoryID,
+			SKU:          current.SKU,
+			Barcode:      current.Barcode,
+			ReorderPoint: current.ReorderPoint,
+			ReorderQty:   current.ReorderQty,
+		}
+		if err := decodePatch(patch, &req); err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+
+		// Validate category exists
+		if _, err := database.GetByID(p.db, p.tables.Category, req.CategoryID); err != nil {
+			if errors.Is(err, database.ErrCategoryNotFound) {
+				writeBadRequest(w, r, &fieldError{"category_id", "Category does not exist"})
+				return
+			}
+			writeDatabaseError(w, r, err, "Failed to retrieve category")
+			return
+		}
+
+		update := req.product()
+		update.ID = id
+		prod, err := database.UpdateProduct(p.db, p.tables, update, current.Version)
+		if errors.Is(err, database.ErrVersionMismatch) && expectedVersion == 0 && attempt < maxPatchAttempts {
+			// Changed since it was read; apply the patch to the new state
+			continue
+		}
+		if err != nil {
+			writeProductUpdateError(w, r, err)
+			return
+		}
+
+		setETag(w, prod.Version)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prod)
 		return
 	}
-	if len(req.Name) > maxNameLength {
-		http.Error(w, "Name must be 255 characters or less", http.StatusBadRequest)
+}
+
+// writeProductUpdateError maps an UpdateProduct error to an HTTP response
+func writeProductUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, database.ErrDuplicateProductCode) {
+		writeError(w, r, http.StatusConflict, codeDuplicateCode, "SKU or barcode already exists")
 		return
 	}
-
-	// Validate price and stock
-	if req.Price <= 0 {
-		http.Error(w, "Price must be greater than 0", http.StatusBadRequest)
+	if errors.Is(err, database.ErrVersionMismatch) {
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Product has been modified")
+		return
+	}
+	if errors.Is(err, database.ErrProductNotFound) {
+		writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
 		return
 	}
-	if req.Stock < 0 {
-		http.Error(w, "Stock cannot be negative", http.StatusBadRequest)
+	var stockErr *database.StockError
+	if errors.As(err, &stockErr) {
+		writeStockError(w, r, stockErr)
 		return
 	}
+	writeDatabaseError(w, r, err, "Failed to update product")
+}
 
-	// Validate category exists
-	_, err = database.GetByID(p.db, "category", req.CategoryID)
+// Delete handles DELETE /products/{id}. An If-Match header makes the delete
+// conditional on the product's current ETag.
+func (p *Products) Delete(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Category does not exist", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Product has been modified")
 		return
 	}
 
-	prod, err := database.UpdateProduct(p.db, p.tableName, "category", id, req.Name, req.Price, req.Stock, req.CategoryID)
+	err = database.DeleteProduct(p.db, p.tables, id, expectedVersion)
 	if err != nil {
-		http.Error(w, "Product not found", http.StatusNotFound)
+		switch {
+		case errors.Is(err, database.ErrProductNotFound):
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+		case errors.Is(err, database.ErrVersionMismatch):
+			writeError(w, r, http.StatusPreconditionFailed, codeVersionMismatch, "Product has been modified")
+		default:
+			writeDatabaseError(w, r, err, "Failed to delete product")
+		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(prod)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// Delete handles DELETE /products/{id}
-func (p *Products) Delete(w http.ResponseWriter, r *http.Request) {
+// Restore handles POST /products/{id}/restore
+func (p *Products) Restore(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
 		return
 	}
 
-	err = database.DeleteProduct(p.db, p.tableName, id)
+	prod, err := database.RestoreProduct(p.db, p.tables, id)
 	if err != nil {
-		// Check if it's a "not found" error or another database error
-		if err.Error() == "product not found" {
-			http.Error(w, "Product not found", http.StatusNotFound)
-		} else {
-			// Other database error (constraint violation, etc)
-			http.Error(w, "Failed to delete product", http.StatusConflict)
+		switch {
+		case errors.Is(err, database.ErrProductNotFound):
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+		case errors.Is(err, database.ErrCategoryDeleted):
+			writeError(w, r, http.StatusConflict, codeCategoryDeleted, "Restore the product's category first")
+		default:
+			writeDatabaseError(w, r, err, "Failed to restore product")
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, prod.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prod)
 }
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"codewithumam-tugas1/database"
+)
+
+// purchaseOrderRequest is the request body for creating or updating a purchase order
+type purchaseOrderRequest struct {
+	SupplierID int                        `json:"supplier_id" validate:"required,min=1"`
+	Note       string                     `json:"note" validate:"nullable,trim,max=5000"`
+	Lines      []purchaseOrderLineRequest `json:"lines" validate:"required,max=100"`
+}
+
+// purchaseOrderLineRequest is a line of a purchaseOrderRequest
+type purchaseOrderLineRequest struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+	UnitCost  int `json:"unit_cost"`
+}
+
+func (req *purchaseOrderRequest) check(errs fieldErrors) {
+	seen := make(map[int]bool, len(req.Lines))
+	for i, line := range req.Lines {
+		field := fmt.Sprintf("lines.%d.", i)
+		if line.ProductID <= 0 {
+			errs.add(field+"product_id", field+"product_id must be greater than 0")
+		} else if seen[line.ProductID] {
+			errs.add(field+"product_id", field+"product_id is already on the order")
+		}
+		seen[line.ProductID] = true
+		if line.Quantity <= 0 {
+			errs.add(field+"quantity", field+"quantity must be greater than 0")
+		}
+		if line.UnitCost < 0 {
+			errs.add(field+"unit_cost", field+"unit_cost cannot be negative")
+		}
+	}
+}
+
+// purchaseOrder converts the request to purchase order id
+func (req *purchaseOrderRequest) purchaseOrder(id int) database.PurchaseOrder {
+	order := database.PurchaseOrder{ID: id, SupplierID: req.SupplierID, Note: req.Note}
+	for _, line := range req.Lines {
+		order.Lines = append(order.Lines, database.PurchaseOrderLine{ProductID: line.ProductID, Quantity: line.Quantity, UnitCost: line.UnitCost})
+	}
+	return order
+}
+
+// receiptRequest is the request body of a goods receipt. The goods are
+// received at the default outlet unless outlet_id is set.
+type receiptRequest struct {
+	OutletID int                    `json:"outlet_id" validate:"nullable,min=1"`
+	Lines    []database.ReceiptLine `json:"lines" validate:"required,max=100"`
+}
+
+func (req *receiptRequest) check(errs fieldErrors) {
+	seen := make(map[int]bool, len(req.Lines))
+	for i, line := range req.Lines {
+		field := fmt.Sprintf("lines.%d.", i)
+		if line.ProductID <= 0 {
+			errs.add(field+"product_id", field+"product_id must be greater than 0")
+		} else if seen[line.ProductID] {
+			errs.add(field+"product_id", field+"product_id is already in the receipt")
+		}
+		seen[line.ProductID] = true
+		if line.Quantity <= 0 {
+			errs.add(field+"quantity", field+"quantity must be greater than 0")
+		}
+		if line.LotNumber != "" || line.ExpiryDate != "" {
+			checkLot(errs, field, line.LotNumber, line.ExpiryDate)
+		}
+	}
+}
+
+// PurchaseOrders manages HTTP requests for purchase orders
+type PurchaseOrders struct {
+	db     *sql.DB
+	tables database.Tables
+}
+
+// NewPurchaseOrders creates a new purchase orders service
+func NewPurchaseOrders(db *sql.DB, tables database.Tables) *PurchaseOrders {
+	return &PurchaseOrders{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// GetAll handles GET /purchase-orders with optional filters (status,
+// supplier_id) and cursor pagination (limit, cursor, order=asc|desc)
+func (p *PurchaseOrders) GetAll(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, cursor, desc, err := parsePageParams(q)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	params := database.PurchaseOrderListParams{
+		Limit:  limit,
+		Cursor: cursor,
+		Desc:   desc,
+		Status: q.Get("status"),
+	}
+	if params.Status != "" && !database.ValidPurchaseOrderStatus(params.Status) {
+		writeBadRequest(w, r, &fieldError{"status", "status must be draft, ordered, partially_received, received or cancelled"})
+		return
+	}
+	supplierID, err := parseOptionalInt(q, "supplier_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if supplierID != nil {
+		params.SupplierID = *supplierID
+	}
+
+	page, err := database.ListPurchaseOrders(p.db, p.tables, params)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			writeBadRequest(w, r, &fieldError{"cursor", "Invalid cursor"})
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve purchase orders")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetByID handles GET /purchase-orders/{id}
+func (p *PurchaseOrders) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	order, err := database.GetPurchaseOrder(p.db, p.tables, id)
+	if err != nil {
+		writePurchaseOrderError(w, r, err, "Failed to retrieve purchase order")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// Create handles POST /purchase-orders. New purchase orders are drafts.
+func (p *PurchaseOrders) Create(w http.ResponseWriter, r *http.Request) {
+	var req purchaseOrderRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	order, err := database.CreatePurchaseOrder(p.db, p.tables, req.purchaseOrder(0))
+	if err != nil {
+		writePurchaseOrderError(w, r, err, "Failed to create purchase order")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// Update handles PUT /purchase-orders/{id}. Only drafts can be changed.
+func (p *PurchaseOrders) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req purchaseOrderRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	order, err := database.UpdatePurchaseOrder(p.db, p.tables, req.purchaseOrder(id))
+	if err != nil {
+		writePurchaseOrderError(w, r, err, "Failed to update purchase order")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// Order handles POST /purchase-orders/{id}/order, which marks a draft as sent
+// to the supplier
+func (p *PurchaseOrders) Order(w http.ResponseWriter, r *http.Request) {
+	p.setStatus(w, r, database.OrderPurchaseOrder)
+}
+
+// Cancel handles POST /purchase-orders/{id}/cancel
+func (p *PurchaseOrders) Cancel(w http.ResponseWriter, r *http.Request) {
+	p.setStatus(w, r, database.CancelPurchaseOrder)
+}
+
+// setStatus answers a status change made by change
+func (p *PurchaseOrders) setStatus(w http.ResponseWriter, r *http.Request, change func(*sql.DB, database.Tables, int) (database.PurchaseOrder, error)) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	order, err := change(p.db, p.tables, id)
+	if err != nil {
+		writePurchaseOrderError(w, r, err, "Failed to update purchase order")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// Receive handles POST /purchase-orders/{id}/receipts. The received
+// quantities are added to the products' stock.
+func (p *PurchaseOrders) Receive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req receiptRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	order, err := database.ReceivePurchaseOrder(p.db, p.tables, id, req.OutletID, req.Lines)
+	if err != nil {
+		var receiptErr *database.ReceiptError
+		switch {
+		case errors.As(err, &receiptErr):
+			writeErrorDetails(w, r, http.StatusConflict, codeReceiptExceedsOrder, "Received quantity exceeds ordered quantity", map[string]interface{}{
+				"product_id": receiptErr.ProductID,
+				"ordered":    receiptErr.Ordered,
+				"received":   receiptErr.Received,
+				"requested":  receiptErr.Requested,
+			})
+		case errors.Is(err, database.ErrInvalidReceipt):
+			writeBadRequest(w, r, &fieldError{"lines", "Every product must be on the purchase order"})
+		case errors.Is(err, database.ErrInvalidLot):
+			writeBadRequest(w, r, &fieldError{"lines", "Lot number already exists with another expiry date"})
+		case errors.Is(err, database.ErrOutletNotFound):
+			writeBadRequest(w, r, &fieldError{"outlet_id", "Outlet does not exist"})
+		case errors.Is(err, database.ErrProductNotFound):
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "A product on the purchase order does not exist or is deleted")
+		default:
+			writePurchaseOrderError(w, r, err, "Failed to receive purchase order")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// writePurchaseOrderError maps a purchase order error to an HTTP response
+func writePurchaseOrderError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrPurchaseOrderNotFound):
+		writeError(w, r, http.StatusNotFound, codePurchaseOrderNotFound, "Purchase order not found")
+	case errors.Is(err, database.ErrSupplierNotFound):
+		writeBadRequest(w, r, &fieldError{"supplier_id", "Supplier does not exist"})
+	case errors.Is(err, database.ErrProductNotFound):
+		writeBadRequest(w, r, &fieldError{"lines", "Every product must exist and not be deleted"})
+	case errors.Is(err, database.ErrPurchaseOrderStatus):
+		writeError(w, r, http.StatusConflict, codeInvalidStatus, "Purchase order status does not allow this change")
+	case errors.Is(err, database.ErrInvalidPurchaseOrder):
+		writeBadRequest(w, r, &fieldError{"lines", err.Error()})
+	default:
+		writeDatabaseError(w, r, err, message)
+	}
+}
@@ -11,25 +11,29 @@ import (
 
 // Report handles report endpoints.
 type Report struct {
-	db                     *sql.DB
-	transactionTable       string
-	transactionDetailTable string
+	db     *sql.DB
+	tables database.Tables
 }
 
 // NewReport creates a new report service.
-func NewReport(db *sql.DB, transactionTable, transactionDetailTable string) *Report {
+func NewReport(db *sql.DB, tables database.Tables) *Report {
 	return &Report{
-		db:                     db,
-		transactionTable:       transactionTable,
-		transactionDetailTable: transactionDetailTable,
+		db:     db,
+		tables: tables,
 	}
 }
 
-// Today handles GET /report/hari-ini
-func (r *Report) Today(w http.ResponseWriter, _ *http.Request) {
-	summary, err := database.GetReportToday(r.db, r.transactionTable, r.transactionDetailTable, time.Now().UTC())
+// Today handles GET /report/hari-ini with an optional outlet_id filter
+func (r *Report) Today(w http.ResponseWriter, req *http.Request) {
+	outletID, err := parseOutletFilter(req)
 	if err != nil {
-		http.Error(w, "Failed to generate report", http.StatusInternalServerError)
+		writeBadRequest(w, req, err)
+		return
+	}
+
+	summary, err := database.GetReportToday(r.db, r.tables, time.Now().UTC(), outletID)
+	if err != nil {
+		writeDatabaseError(w, req, err, "Failed to generate report")
 		return
 	}
 
@@ -37,39 +41,115 @@ func (r *Report) Today(w http.ResponseWriter, _ *http.Request) {
 	json.NewEncoder(w).Encode(summary)
 }
 
-// Range handles GET /report?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD
-func (r *Report) Range(w http.ResponseWriter, req *http.Request) {
+// parseOutletFilter reads the optional outlet_id query parameter. It returns 0,
+// meaning every outlet, when the parameter is absent.
+func parseOutletFilter(req *http.Request) (int, error) {
+	outletID, err := parseOptionalInt(req.URL.Query(), "outlet_id")
+	if err != nil || outletID == nil {
+		return 0, err
+	}
+	return *outletID, nil
+}
+
+// parseDateRange reads start_date and end_date (YYYY-MM-DD) and returns the
+// UTC range [start, end+1day) so the end date is inclusive.
+func parseDateRange(req *http.Request) (time.Time, time.Time, error) {
 	startDate := req.URL.Query().Get("start_date")
 	endDate := req.URL.Query().Get("end_date")
-	if startDate == "" || endDate == "" {
-		http.Error(w, "start_date and end_date are required", http.StatusBadRequest)
-		return
+	if startDate == "" {
+		return time.Time{}, time.Time{}, &fieldError{"start_date", "start_date and end_date are required"}
+	}
+	if endDate == "" {
+		return time.Time{}, time.Time{}, &fieldError{"end_date", "start_date and end_date are required"}
 	}
 
 	start, err := time.Parse("2006-01-02", startDate)
 	if err != nil {
-		http.Error(w, "Invalid start_date", http.StatusBadRequest)
-		return
+		return time.Time{}, time.Time{}, &fieldError{"start_date", "Invalid start_date"}
 	}
 	end, err := time.Parse("2006-01-02", endDate)
 	if err != nil {
-		http.Error(w, "Invalid end_date", http.StatusBadRequest)
-		return
+		return time.Time{}, time.Time{}, &fieldError{"end_date", "Invalid end_date"}
 	}
 	if end.Before(start) {
-		http.Error(w, "end_date must be on or after start_date", http.StatusBadRequest)
-		return
+		return time.Time{}, time.Time{}, &fieldError{"end_date", "end_date must be on or after start_date"}
 	}
 
 	endExclusive := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
 	startUTC := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	return startUTC, endExclusive, nil
+}
+
+// Range handles GET /report?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD with an
+// optional outlet_id filter
+func (r *Report) Range(w http.ResponseWriter, req *http.Request) {
+	start, end, err := parseDateRange(req)
+	if err != nil {
+		writeBadRequest(w, req, err)
+		return
+	}
+	outletID, err := parseOutletFilter(req)
+	if err != nil {
+		writeBadRequest(w, req, err)
+		return
+	}
 
-	summary, err := database.GetReportBetween(r.db, r.transactionTable, r.transactionDetailTable, startUTC, endExclusive)
+	summary, err := database.GetReportBetween(r.db, r.tables, start, end, outletID)
 	if err != nil {
-		http.Error(w, "Failed to generate report", http.StatusInternalServerError)
+		writeDatabaseError(w, req, err, "Failed to generate report")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(summary)
 }
+
+// Categories handles GET /report/categories?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD
+// Each category's totals include the sales of all its subcategories. An
+// optional outlet_id limits the totals to one outlet.
+func (r *Report) Categories(w http.ResponseWriter, req *http.Request) {
+	start, end, err := parseDateRange(req)
+	if err != nil {
+		writeBadRequest(w, req, err)
+		return
+	}
+	outletID, err := parseOutletFilter(req)
+	if err != nil {
+		writeBadRequest(w, req, err)
+		return
+	}
+
+	sales, err := database.GetCategorySalesBetween(r.db, r.tables, start, end, outletID)
+	if err != nil {
+		writeDatabaseError(w, req, err, "Failed to generate report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sales)
+}
+
+// Payments handles GET /report/payments?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD
+// It totals the payments per method for reconciliation. An optional
+// outlet_id limits the totals to one outlet.
+func (r *Report) Payments(w http.ResponseWriter, req *http.Request) {
+	start, end, err := parseDateRange(req)
+	if err != nil {
+		writeBadRequest(w, req, err)
+		return
+	}
+	outletID, err := parseOutletFilter(req)
+	if err != nil {
+		writeBadRequest(w, req, err)
+		return
+	}
+
+	summaries, err := database.GetPaymentSummaryBetween(r.db, r.tables, start, end, outletID)
+	if err != nil {
+		writeDatabaseError(w, req, err, "Failed to generate report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	// requestIDHeader carries the request id in requests and responses
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength limits client-supplied request ids
+	maxRequestIDLength = 64
+)
+
+type requestIDKey struct{}
+
+// RequestID is middleware that gives every request an id. A valid
+// X-Request-ID sent by the client is kept, otherwise a random one is
+// generated. The id is echoed in the X-Request-ID response header and
+// included in error responses so failures can be traced in the logs.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestIDFrom returns the request id stored by RequestID, or "" when the
+// middleware did not run
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether a client-supplied id is safe to echo and log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit id in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
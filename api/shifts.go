@@ -0,0 +1,137 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"codewithumam-tugas1/database"
+)
+
+// openShiftRequest is the request body for opening a shift. The shift is
+// opened at the default outlet unless outlet_id is set.
+type openShiftRequest struct {
+	OutletID int    `json:"outlet_id" validate:"nullable,min=1"`
+	OpenedBy string `json:"opened_by" validate:"required,trim,max=255"`
+}
+
+// closeShiftRequest is the request body for closing a shift
+type closeShiftRequest struct {
+	ClosedBy string `json:"closed_by" validate:"required,trim,max=255"`
+}
+
+// Shifts manages HTTP requests for cashier shifts
+type Shifts struct {
+	db     *sql.DB
+	tables database.Tables
+}
+
+// NewShifts creates a new shifts service
+func NewShifts(db *sql.DB, tables database.Tables) *Shifts {
+	return &Shifts{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// GetAll handles GET /shifts, optionally of one outlet (outlet_id)
+func (s *Shifts) GetAll(w http.ResponseWriter, r *http.Request) {
+	outletID, err := parseOptionalInt(r.URL.Query(), "outlet_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	outlet := 0
+	if outletID != nil {
+		outlet = *outletID
+	}
+
+	shifts, err := database.GetShifts(s.db, s.tables, outlet)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve shifts")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shifts)
+}
+
+// GetByID handles GET /shifts/{id}
+func (s *Shifts) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	shift, err := database.GetShift(s.db, s.tables, id)
+	if err != nil {
+		writeShiftError(w, r, err, "Failed to retrieve shift")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shift)
+}
+
+// Create handles POST /shifts, which opens a shift at an outlet
+func (s *Shifts) Create(w http.ResponseWriter, r *http.Request) {
+	var req openShiftRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	shift, err := database.OpenShift(s.db, s.tables, req.OutletID, req.OpenedBy)
+	if err != nil {
+		writeShiftError(w, r, err, "Failed to open shift")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shift)
+}
+
+// Close handles POST /shifts/{id}/close. Sales of a closed shift can only be
+// voided within the void window.
+func (s *Shifts) Close(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req closeShiftRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	shift, err := database.CloseShift(s.db, s.tables, id, req.ClosedBy)
+	if err != nil {
+		writeShiftError(w, r, err, "Failed to close shift")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shift)
+}
+
+// writeShiftError maps a shift error to an HTTP response
+func writeShiftError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrShiftNotFound):
+		writeError(w, r, http.StatusNotFound, codeShiftNotFound, "Shift not found")
+	case errors.Is(err, database.ErrOutletNotFound):
+		writeBadRequest(w, r, &fieldError{"outlet_id", "Outlet does not exist"})
+	case errors.Is(err, database.ErrShiftOpen):
+		writeError(w, r, http.StatusConflict, codeShiftOpen, "Outlet already has an open shift")
+	case errors.Is(err, database.ErrShiftClosed):
+		writeError(w, r, http.StatusConflict, codeInvalidStatus, "Shift is already closed")
+	default:
+		writeDatabaseError(w, r, err, message)
+	}
+}
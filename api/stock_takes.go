@@ -0,0 +1,180 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"codewithumam-tugas1/database"
+)
+
+// stockTakeRequest is the request body for opening a stock take. The default
+// outlet is counted unless outlet_id is set.
+type stockTakeRequest struct {
+	OutletID int    `json:"outlet_id" validate:"nullable,min=1"`
+	Note     string `json:"note" validate:"nullable,trim,max=5000"`
+}
+
+// stockCountRequest is the request body of a batch of counted quantities
+type stockCountRequest struct {
+	Counts []database.StockCount `json:"counts" validate:"required,max=500"`
+}
+
+func (req *stockCountRequest) check(errs fieldErrors) {
+	seen := make(map[int]bool, len(req.Counts))
+	for i, count := range req.Counts {
+		field := fmt.Sprintf("counts.%d.", i)
+		if count.ProductID <= 0 {
+			errs.add(field+"product_id", field+"product_id must be greater than 0")
+		} else if seen[count.ProductID] {
+			errs.add(field+"product_id", field+"product_id is already in the batch")
+		}
+		seen[count.ProductID] = true
+		if count.Quantity < 0 {
+			errs.add(field+"quantity", field+"quantity cannot be negative")
+		}
+	}
+}
+
+// StockTakes manages HTTP requests for stock takes
+type StockTakes struct {
+	db     *sql.DB
+	tables database.Tables
+}
+
+// NewStockTakes creates a new stock takes service
+func NewStockTakes(db *sql.DB, tables database.Tables) *StockTakes {
+	return &StockTakes{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// GetAll handles GET /stock-takes
+func (s *StockTakes) GetAll(w http.ResponseWriter, r *http.Request) {
+	stockTakes, err := database.GetStockTakes(s.db, s.tables)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve stock takes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stockTakes)
+}
+
+// GetByID handles GET /stock-takes/{id}, which lists the count and variance
+// of every product
+func (s *StockTakes) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	stockTake, err := database.GetStockTake(s.db, s.tables, id)
+	if err != nil {
+		writeStockTakeError(w, r, err, "Failed to retrieve stock take")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stockTake)
+}
+
+// Create handles POST /stock-takes, which opens a stock take and snapshots
+// the outlet's stock
+func (s *StockTakes) Create(w http.ResponseWriter, r *http.Request) {
+	var req stockTakeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	stockTake, err := database.OpenStockTake(s.db, s.tables, req.OutletID, req.Note)
+	if err != nil {
+		writeStockTakeError(w, r, err, "Failed to open stock take")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(stockTake)
+}
+
+// Count handles POST /stock-takes/{id}/counts, which records a batch of
+// counted quantities
+func (s *StockTakes) Count(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req stockCountRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	stockTake, err := database.RecordStockCounts(s.db, s.tables, id, req.Counts)
+	if err != nil {
+		writeStockTakeError(w, r, err, "Failed to record stock counts")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stockTake)
+}
+
+// Finalize handles POST /stock-takes/{id}/finalize, which adjusts the stock
+// of every product counted with a variance
+func (s *StockTakes) Finalize(w http.ResponseWriter, r *http.Request) {
+	s.setStatus(w, r, database.FinalizeStockTake, "Failed to finalize stock take")
+}
+
+// Cancel handles POST /stock-takes/{id}/cancel
+func (s *StockTakes) Cancel(w http.ResponseWriter, r *http.Request) {
+	s.setStatus(w, r, database.CancelStockTake, "Failed to cancel stock take")
+}
+
+// setStatus answers a status change made by change
+func (s *StockTakes) setStatus(w http.ResponseWriter, r *http.Request, change func(*sql.DB, database.Tables, int) (database.StockTake, error), message string) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	stockTake, err := change(s.db, s.tables, id)
+	if err != nil {
+		writeStockTakeError(w, r, err, message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stockTake)
+}
+
+// writeStockTakeError maps a stock take error to an HTTP response
+func writeStockTakeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var stockErr *database.StockError
+	switch {
+	case errors.As(err, &stockErr):
+		writeStockError(w, r, stockErr)
+	case errors.Is(err, database.ErrStockTakeNotFound):
+		writeError(w, r, http.StatusNotFound, codeStockTakeNotFound, "Stock take not found")
+	case errors.Is(err, database.ErrOutletNotFound):
+		writeBadRequest(w, r, &fieldError{"outlet_id", "Outlet does not exist"})
+	case errors.Is(err, database.ErrStockTakeOpen):
+		writeError(w, r, http.StatusConflict, codeStockTakeOpen, "Outlet already has an open stock take")
+	case errors.Is(err, database.ErrStockTakeStatus):
+		writeError(w, r, http.StatusConflict, codeInvalidStatus, "Stock take status does not allow this change")
+	case errors.Is(err, database.ErrInvalidStockCount):
+		writeBadRequest(w, r, &fieldError{"counts", "Every product must be on the stock take"})
+	default:
+		writeDatabaseError(w, r, err, message)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"codewithumam-tugas1/database"
+)
+
+// supplierRequest is the request body for creating or updating a supplier
+type supplierRequest struct {
+	Name  string `json:"name" validate:"required,trim,max=255"`
+	Phone string `json:"phone" validate:"nullable,trim,max=32"`
+	Email string `json:"email" validate:"nullable,trim,max=255"`
+}
+
+func (req *supplierRequest) check(errs fieldErrors) {
+	if req.Email != "" && !strings.Contains(req.Email, "@") {
+		errs.add("email", "email must be an email address")
+	}
+}
+
+// Suppliers manages HTTP requests for suppliers
+type Suppliers struct {
+	db        *sql.DB
+	tableName string
+}
+
+// NewSuppliers creates a new suppliers service
+func NewSuppliers(db *sql.DB, tableName string) *Suppliers {
+	return &Suppliers{db: db, tableName: tableName}
+}
+
+// GetAll handles GET /suppliers
+func (s *Suppliers) GetAll(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := database.GetSuppliers(s.db, s.tableName)
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to retrieve suppliers")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+// GetByID handles GET /suppliers/{id}
+func (s *Suppliers) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	supplier, err := database.GetSupplierByID(s.db, s.tableName, id)
+	if err != nil {
+		if errors.Is(err, database.ErrSupplierNotFound) {
+			writeError(w, r, http.StatusNotFound, codeSupplierNotFound, "Supplier not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve supplier")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// Create handles POST /suppliers
+func (s *Suppliers) Create(w http.ResponseWriter, r *http.Request) {
+	var req supplierRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	supplier, err := database.CreateSupplier(s.db, s.tableName, database.Supplier{Name: req.Name, Phone: req.Phone, Email: req.Email})
+	if err != nil {
+		writeDatabaseError(w, r, err, "Failed to create supplier")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// Update handles PUT /suppliers/{id}
+func (s *Suppliers) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req supplierRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	supplier, err := database.UpdateSupplier(s.db, s.tableName, database.Supplier{ID: id, Name: req.Name, Phone: req.Phone, Email: req.Email})
+	if err != nil {
+		if errors.Is(err, database.ErrSupplierNotFound) {
+			writeError(w, r, http.StatusNotFound, codeSupplierNotFound, "Supplier not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to update supplier")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supplier)
+}
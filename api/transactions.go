@@ -0,0 +1,276 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"codewithumam-tugas1/database"
+)
+
+// paymentRequest is the request body for settling a transaction
+type paymentRequest struct {
+	Payments []database.CheckoutPayment `json:"payments" validate:"required,max=20"`
+}
+
+// returnRequest is the request body of a return
+type returnRequest struct {
+	Items  []database.ReturnItem `json:"items" validate:"required,max=500"`
+	Reason string                `json:"reason" validate:"nullable,trim,max=5000"`
+}
+
+// voidRequest is the request body of a void
+type voidRequest struct {
+	VoidedBy string `json:"voided_by" validate:"required,trim,max=255"`
+	Reason   string `json:"reason" validate:"required,trim,max=5000"`
+}
+
+func (req *returnRequest) check(errs fieldErrors) {
+	seen := make(map[int]bool, len(req.Items))
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items.%d.", i)
+		if item.TransactionDetailID <= 0 {
+			errs.add(field+"transaction_detail_id", field+"transaction_detail_id must be greater than 0")
+		} else if seen[item.TransactionDetailID] {
+			errs.add(field+"transaction_detail_id", field+"transaction_detail_id is already in the return")
+		}
+		seen[item.TransactionDetailID] = true
+		if item.Quantity <= 0 {
+			errs.add(field+"quantity", field+"quantity must be greater than 0")
+		}
+	}
+}
+
+// Transactions manages HTTP requests for transactions made by checkout
+type Transactions struct {
+	db         *sql.DB
+	tables     database.Tables
+	voidWindow time.Duration
+}
+
+// NewTransactions creates a new transactions service. Transactions can be
+// voided until voidWindow after checkout.
+func NewTransactions(db *sql.DB, tables database.Tables, voidWindow time.Duration) *Transactions {
+	return &Transactions{
+		db:         db,
+		tables:     tables,
+		voidWindow: voidWindow,
+	}
+}
+
+// GetAll handles GET /transactions with optional filters (start_date and
+// end_date, min_amount, max_amount, outlet_id, product_id, payment_method,
+// voided) and cursor pagination (limit, cursor, order=asc|desc)
+func (t *Transactions) GetAll(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, cursor, desc, err := parsePageParams(q)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	params := database.TransactionListParams{
+		Limit:         limit,
+		Cursor:        cursor,
+		Desc:          desc,
+		PaymentMethod: q.Get("payment_method"),
+	}
+	if q.Get("start_date") != "" || q.Get("end_date") != "" {
+		params.Start, params.End, err = parseDateRange(r)
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+	}
+	if params.PaymentMethod != "" && !database.ValidPaymentMethod(params.PaymentMethod) {
+		writeBadRequest(w, r, &fieldError{"payment_method", "payment_method must be cash, qris, debit_card, credit_card or e_wallet"})
+		return
+	}
+
+	if params.MinAmount, err = parseOptionalInt(q, "min_amount"); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if params.MaxAmount, err = parseOptionalInt(q, "max_amount"); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if params.MinAmount != nil && params.MaxAmount != nil && *params.MinAmount > *params.MaxAmount {
+		writeBadRequest(w, r, &fieldError{"min_amount", "min_amount must not be greater than max_amount"})
+		return
+	}
+	if params.Voided, err = parseOptionalBool(q, "voided"); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	outletID, err := parseOptionalInt(q, "outlet_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if outletID != nil {
+		params.OutletID = *outletID
+	}
+	productID, err := parseOptionalInt(q, "product_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if productID != nil {
+		params.ProductID = *productID
+	}
+
+	page, err := database.ListTransactions(t.db, t.tables, params)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			writeBadRequest(w, r, &fieldError{"cursor", "Invalid cursor"})
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve transactions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetByID handles GET /transactions/{id}, which returns a transaction with
+// its details and payments
+func (t *Transactions) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	transaction, err := database.GetTransaction(t.db, t.tables, id)
+	if err != nil {
+		writeTransactionError(w, r, err, "Failed to retrieve transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// AddPayments handles POST /transactions/{id}/payments, which settles the
+// outstanding amount of a transaction
+func (t *Transactions) AddPayments(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req paymentRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	transaction, err := database.AddPayments(t.db, t.tables, id, req.Payments)
+	if err != nil {
+		writeTransactionError(w, r, err, "Failed to record payments")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// CreateReturn handles POST /transactions/{id}/returns, which returns items
+// of a transaction to stock and refunds them
+func (t *Transactions) CreateReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req returnRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	ret, err := database.CreateReturn(t.db, t.tables, id, req.Items, req.Reason)
+	if err != nil {
+		writeTransactionError(w, r, err, "Failed to create return")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ret)
+}
+
+// Void handles POST /transactions/{id}/void, which cancels a recent
+// transaction and puts its stock back
+func (t *Transactions) Void(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req voidRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	transaction, err := database.VoidTransaction(t.db, t.tables, id, t.voidWindow, req.VoidedBy, req.Reason)
+	if err != nil {
+		writeTransactionError(w, r, err, "Failed to void transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction)
+}
+
+// writeTransactionError maps a transaction or payment error to an HTTP response
+func writeTransactionError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var paymentErr *database.PaymentError
+	var returnErr *database.ReturnError
+	switch {
+	case errors.Is(err, database.ErrTransactionNotFound):
+		writeError(w, r, http.StatusNotFound, codeTransactionNotFound, "Transaction not found")
+	case errors.Is(err, database.ErrTransactionVoided):
+		writeError(w, r, http.StatusConflict, codeTransactionVoided, "Transaction is voided")
+	case errors.Is(err, database.ErrVoidWindowExpired):
+		writeError(w, r, http.StatusConflict, codeVoidWindowExpired, "Transaction is too old to void and was not made in the open shift")
+	case errors.Is(err, database.ErrTransactionReturned):
+		writeError(w, r, http.StatusConflict, codeTransactionReturned, "Transaction with returns cannot be voided")
+	case errors.Is(err, database.ErrInvalidVoid):
+		writeBadRequest(w, r, &fieldError{"reason", "A void needs voided_by and a reason"})
+	case errors.Is(err, database.ErrTransactionSettled):
+		writeError(w, r, http.StatusConflict, codeTransactionSettled, "Transaction has no outstanding amount")
+	case errors.Is(err, database.ErrPaymentReferenceRequired):
+		writeBadRequest(w, r, &fieldError{"payments", "Card and QRIS payments need a reference"})
+	case errors.As(err, &paymentErr):
+		writeErrorDetails(w, r, http.StatusBadRequest, codeInsufficientPayment, "Payments do not cover the amount due", map[string]interface{}{
+			"due":  paymentErr.Total,
+			"paid": paymentErr.Paid,
+		})
+	case errors.Is(err, database.ErrInvalidPayment):
+		writeBadRequest(w, r, &fieldError{"payments", "Every payment needs a method of cash, qris, debit_card, credit_card or e_wallet and a positive amount, and only cash may be overpaid"})
+	case errors.As(err, &returnErr):
+		writeErrorDetails(w, r, http.StatusConflict, codeReturnExceedsSale, "Returned quantity exceeds sold quantity", map[string]interface{}{
+			"transaction_detail_id": returnErr.TransactionDetailID,
+			"sold":                  returnErr.Sold,
+			"returned":              returnErr.Returned,
+			"requested":             returnErr.Requested,
+		})
+	case errors.Is(err, database.ErrInvalidReturn):
+		writeBadRequest(w, r, &fieldError{"items", "Every item must be a detail of the transaction"})
+	case errors.Is(err, database.ErrProductNotFound), errors.Is(err, database.ErrVariantNotFound):
+		writeError(w, r, http.StatusConflict, codeConflict, "Product of the transaction no longer exists")
+	default:
+		writeDatabaseError(w, r, err, message)
+	}
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"codewithumam-tugas1/database"
+)
+
+// transferRequest is the request body for creating a stock transfer
+type transferRequest struct {
+	FromOutletID int                   `json:"from_outlet_id" validate:"required,min=1"`
+	ToOutletID   int                   `json:"to_outlet_id" validate:"required,min=1"`
+	Note         string                `json:"note" validate:"nullable,trim,max=5000"`
+	Lines        []transferLineRequest `json:"lines" validate:"required,max=100"`
+}
+
+// transferLineRequest is a line of a transferRequest
+type transferLineRequest struct {
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
+	Quantity  int `json:"quantity"`
+}
+
+func (req *transferRequest) check(errs fieldErrors) {
+	if req.FromOutletID != 0 && req.FromOutletID == req.ToOutletID {
+		errs.add("to_outlet_id", "to_outlet_id must differ from from_outlet_id")
+	}
+	seen := make(map[transferLineRequest]bool, len(req.Lines))
+	for i, line := range req.Lines {
+		field := fmt.Sprintf("lines.%d.", i)
+		key := transferLineRequest{ProductID: line.ProductID, VariantID: line.VariantID}
+		if line.ProductID <= 0 {
+			errs.add(field+"product_id", field+"product_id must be greater than 0")
+		} else if seen[key] {
+			errs.add(field+"product_id", field+"product_id is already on the transfer")
+		}
+		seen[key] = true
+		if line.VariantID < 0 {
+			errs.add(field+"variant_id", field+"variant_id cannot be negative")
+		}
+		if line.Quantity <= 0 {
+			errs.add(field+"quantity", field+"quantity must be greater than 0")
+		}
+	}
+}
+
+// transfer converts the request to a stock transfer
+func (req *transferRequest) transfer() database.StockTransfer {
+	transfer := database.StockTransfer{FromOutletID: req.FromOutletID, ToOutletID: req.ToOutletID, Note: req.Note}
+	for _, line := range req.Lines {
+		transfer.Lines = append(transfer.Lines, database.StockTransferLine{ProductID: line.ProductID, VariantID: line.VariantID, Quantity: line.Quantity})
+	}
+	return transfer
+}
+
+// transferReceiptRequest is the request body of a stock transfer receipt.
+// Lines that are not listed arrived in full.
+type transferReceiptRequest struct {
+	Lines []database.TransferReceiptLine `json:"lines" validate:"nullable,max=100"`
+}
+
+func (req *transferReceiptRequest) check(errs fieldErrors) {
+	seen := make(map[database.TransferReceiptLine]bool, len(req.Lines))
+	for i, line := range req.Lines {
+		field := fmt.Sprintf("lines.%d.", i)
+		key := database.TransferReceiptLine{ProductID: line.ProductID, VariantID: line.VariantID}
+		if line.ProductID <= 0 {
+			errs.add(field+"product_id", field+"product_id must be greater than 0")
+		} else if seen[key] {
+			errs.add(field+"product_id", field+"product_id is already in the receipt")
+		}
+		seen[key] = true
+		if line.Quantity < 0 {
+			errs.add(field+"quantity", field+"quantity cannot be negative")
+		}
+	}
+}
+
+// Transfers manages HTTP requests for stock transfers between outlets
+type Transfers struct {
+	db     *sql.DB
+	tables database.Tables
+}
+
+// NewTransfers creates a new stock transfers service
+func NewTransfers(db *sql.DB, tables database.Tables) *Transfers {
+	return &Transfers{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// GetAll handles GET /stock-transfers with optional filters (status,
+// outlet_id) and cursor pagination (limit, cursor, order=asc|desc)
+func (t *Transfers) GetAll(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, cursor, desc, err := parsePageParams(q)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	params := database.StockTransferListParams{
+		Limit:  limit,
+		Cursor: cursor,
+		Desc:   desc,
+		Status: q.Get("status"),
+	}
+	if params.Status != "" && !database.ValidTransferStatus(params.Status) {
+		writeBadRequest(w, r, &fieldError{"status", "status must be draft, in_transit, received or cancelled"})
+		return
+	}
+	outletID, err := parseOptionalInt(q, "outlet_id")
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+	if outletID != nil {
+		params.OutletID = *outletID
+	}
+
+	page, err := database.ListStockTransfers(t.db, t.tables, params)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			writeBadRequest(w, r, &fieldError{"cursor", "Invalid cursor"})
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to retrieve stock transfers")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetByID handles GET /stock-transfers/{id}
+func (t *Transfers) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	transfer, err := database.GetStockTransfer(t.db, t.tables, id)
+	if err != nil {
+		writeTransferError(w, r, err, "Failed to retrieve stock transfer")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// Create handles POST /stock-transfers. New transfers are drafts.
+func (t *Transfers) Create(w http.ResponseWriter, r *http.Request) {
+	var req transferRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	transfer, err := database.CreateStockTransfer(t.db, t.tables, req.transfer())
+	if err != nil {
+		writeTransferError(w, r, err, "Failed to create stock transfer")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// Ship handles POST /stock-transfers/{id}/ship, which takes the goods out of
+// the source outlet's stock
+func (t *Transfers) Ship(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	transfer, err := database.ShipStockTransfer(t.db, t.tables, id)
+	if err != nil {
+		writeTransferError(w, r, err, "Failed to ship stock transfer")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// Receive handles POST /stock-transfers/{id}/receive, which adds the arrived
+// goods to the destination outlet's stock
+func (t *Transfers) Receive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req transferReceiptRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	transfer, err := database.ReceiveStockTransfer(t.db, t.tables, id, req.Lines)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidTransferReceipt) {
+			writeBadRequest(w, r, &fieldError{"lines", "Every product must be on the stock transfer"})
+			return
+		}
+		writeTransferError(w, r, err, "Failed to receive stock transfer")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// Cancel handles POST /stock-transfers/{id}/cancel. Only drafts can be cancelled.
+func (t *Transfers) Cancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	transfer, err := database.CancelStockTransfer(t.db, t.tables, id)
+	if err != nil {
+		writeTransferError(w, r, err, "Failed to cancel stock transfer")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// writeTransferError maps a stock transfer error to an HTTP response
+func writeTransferError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var stockErr *database.StockError
+	switch {
+	case errors.As(err, &stockErr):
+		writeStockError(w, r, stockErr)
+	case errors.Is(err, database.ErrTransferNotFound):
+		writeError(w, r, http.StatusNotFound, codeTransferNotFound, "Stock transfer not found")
+	case errors.Is(err, database.ErrOutletNotFound):
+		writeBadRequest(w, r, &fieldError{"outlet_id", "Outlet does not exist"})
+	case errors.Is(err, database.ErrProductNotFound):
+		writeBadRequest(w, r, &fieldError{"lines", "Every product must exist and not be deleted"})
+	case errors.Is(err, database.ErrVariantNotFound):
+		writeBadRequest(w, r, &fieldError{"lines", "Every variant must belong to its product"})
+	case errors.Is(err, database.ErrTransferStatus):
+		writeError(w, r, http.StatusConflict, codeInvalidStatus, "Stock transfer status does not allow this change")
+	case errors.Is(err, database.ErrInvalidTransfer):
+		writeBadRequest(w, r, &fieldError{"lines", err.Error()})
+	case errors.Is(err, database.ErrInvalidLot):
+		writeError(w, r, http.StatusConflict, codeConflict, "A shipped lot number exists at the destination with another expiry date")
+	default:
+		writeDatabaseError(w, r, err, message)
+	}
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Request bodies are decoded and validated by decodeRequest and decodePatch.
+// Fields of a request struct are matched by their json name and checked
+// against the rules in their validate tag:
+//
+//	required  the field must be present; strings must not be blank and slices not empty
+//	nullable  null is accepted and stored as the zero value; otherwise null is rejected
+//	trim      surrounding whitespace is removed from strings before other rules run
+//	min=N     numbers must be at least N
+//	max=N     numbers must be at most N, strings at most N bytes and maps or slices at most N entries
+//
+// Members that match no field are rejected. Request types implement
+// requestChecker for rules that tags cannot express. All failures are
+// collected and returned together as fieldErrors.
+
+// fieldErrors maps JSON field names to validation messages
+type fieldErrors map[string]string
+
+// add records a failure for field unless it already has one
+func (e fieldErrors) add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+func (e fieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = e[field]
+	}
+	return strings.Join(messages, "; ")
+}
+
+// requestChecker is implemented by request structs with rules that cannot be
+// expressed in validate tags. check runs after the tag rules and adds its
+// failures to errs.
+type requestChecker interface {
+	check(errs fieldErrors)
+}
+
+// fieldRules are the parsed rules of a validate tag
+type fieldRules struct {
+	required bool
+	nullable bool
+	trim     bool
+	min, max *int
+}
+
+func parseFieldRules(tag string) fieldRules {
+	var rules fieldRules
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "":
+		case "required":
+			rules.required = true
+		case "nullable":
+			rules.nullable = true
+		case "trim":
+			rules.trim = true
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				panic("invalid validate tag: " + tag)
+			}
+			if name == "min" {
+				rules.min = &n
+			} else {
+				rules.max = &n
+			}
+		default:
+			panic("invalid validate tag: " + tag)
+		}
+	}
+	return rules
+}
+
+// decodeRequest reads the JSON object in the request body into target, a
+// pointer to a request struct, and validates it
+func decodeRequest(r *http.Request, target interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errors.New("Invalid request body")
+	}
+	return decodeFields(body, target, false)
+}
+
+// decodePatch applies the JSON Merge Patch (RFC 7396) document patch to
+// target, a pointer to a request struct holding the resource's current
+// values, and validates the result. Members absent from the patch keep their
+// value and null clears nullable fields.
+func decodePatch(patch []byte, target interface{}) error {
+	return decodeFields(patch, target, true)
+}
+
+// decodeFields decodes the members of the JSON object data onto target and
+// validates them. Required fields may be absent only when partial is set.
+func decodeFields(data []byte, target interface{}, partial bool) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil || members == nil {
+		return bodyError(data, err)
+	}
+
+	v := reflect.ValueOf(target).Elem()
+	t := v.Type()
+	errs := fieldErrors{}
+	known := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		known[name] = true
+		rules := parseFieldRules(t.Field(i).Tag.Get("validate"))
+		field := v.Field(i)
+
+		raw, present := members[name]
+		switch {
+		case !present:
+			if rules.required && !partial {
+				errs.add(name, name+" is required")
+			}
+			continue
+		case bytes.Equal(bytes.TrimSpace(raw), []byte("null")):
+			if !rules.nullable {
+				errs.add(name, name+" cannot be null")
+				continue
+			}
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+
+		if err := decodeValue(raw, field); err != nil {
+			errs.add(name, decodeErrorMessage(name, field.Type(), err))
+			continue
+		}
+		checkFieldRules(name, field, rules, errs)
+	}
+
+	for name := range members {
+		if !known[name] {
+			errs.add(name, "unknown field "+name)
+		}
+	}
+
+	if checker, ok := target.(requestChecker); ok {
+		checker.check(errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// bodyError describes why data is not a JSON object
+func bodyError(data []byte, err error) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return errors.New("Request body is required")
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("Request body is not valid JSON: %s at offset %d", syntaxErr.Error(), syntaxErr.Offset)
+	}
+	return errors.New("Request body must be a JSON object")
+}
+
+// decodeValue decodes raw into field, replacing its current value. Objects
+// nested in the value may not have unknown members either.
+func decodeValue(raw json.RawMessage, field reflect.Value) error {
+	field.Set(reflect.Zero(field.Type()))
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(field.Addr().Interface())
+}
+
+// decodeErrorMessage describes a value of field name that could not be decoded into t
+func decodeErrorMessage(name string, t reflect.Type, err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("%s.%s must be %s", name, typeErr.Field, typeDescription(typeErr.Type))
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Sprintf("%s has unknown field %s", name, strings.Trim(field, `"`))
+	}
+	return name + " must be " + typeDescription(t)
+}
+
+// typeDescription names the kind of JSON value that decodes into t
+func typeDescription(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// checkFieldRules applies rules to the decoded value of field name
+func checkFieldRules(name string, field reflect.Value, rules fieldRules, errs fieldErrors) {
+	value := field
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		s := value.String()
+		if rules.trim {
+			s = strings.TrimSpace(s)
+			value.SetString(s)
+		}
+		if rules.required && s == "" {
+			errs.add(name, name+" is required")
+		}
+		if rules.max != nil && len(s) > *rules.max {
+			errs.add(name, fmt.Sprintf("%s must be %d characters or less", name, *rules.max))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := value.Int()
+		if rules.min != nil && n < int64(*rules.min) {
+			if *rules.min == 0 {
+				errs.add(name, name+" cannot be negative")
+			} else {
+				errs.add(name, fmt.Sprintf("%s must be greater than %d", name, *rules.min-1))
+			}
+		}
+		if rules.max != nil && n > int64(*rules.max) {
+			errs.add(name, fmt.Sprintf("%s must be %d or less", name, *rules.max))
+		}
+	case reflect.Map, reflect.Slice:
+		if rules.required && value.Len() == 0 {
+			errs.add(name, name+" is required")
+		}
+		if rules.max != nil && value.Len() > *rules.max {
+			errs.add(name, fmt.Sprintf("%s can have at most %d entries", name, *rules.max))
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"codewithumam-tugas1/database"
+)
+
+const maxAttributeValueLength = 255
+
+// Variants manages HTTP requests for product variants
+type Variants struct {
+	db     *sql.DB
+	tables database.Tables
+}
+
+// NewVariants creates a new variants service
+func NewVariants(db *sql.DB, tables database.Tables) *Variants {
+	return &Variants{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// variantRequest is the request body for creating or updating a variant
+type variantRequest struct {
+	Name       string            `json:"name" validate:"required,trim,max=255"`
+	Attributes map[string]string `json:"attributes" validate:"nullable,max=20"`
+	Price      int               `json:"price" validate:"required,min=1"`
+	Stock      int               `json:"stock" validate:"min=0"`
+	Barcode    string            `json:"barcode" validate:"nullable,trim"`
+}
+
+func (req *variantRequest) check(errs fieldErrors) {
+	for key, value := range req.Attributes {
+		if strings.TrimSpace(key) == "" {
+			errs.add("attributes", "attribute names cannot be empty")
+		}
+		if len(key) > maxNameLength || len(value) > maxAttributeValueLength {
+			errs.add("attributes", "attribute names and values must be 255 characters or less")
+		}
+	}
+	checkProductCodes(errs, "", req.Barcode)
+}
+
+// parseVariantPath reads the product id and, when present, the variant id from the path
+func parseVariantPath(r *http.Request) (productID, variantID int, err error) {
+	productID, err = strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, 0, err
+	}
+	if raw := r.PathValue("variantId"); raw != "" {
+		variantID, err = strconv.Atoi(raw)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return productID, variantID, nil
+}
+
+// Create handles POST /products/{id}/variants
+func (v *Variants) Create(w http.ResponseWriter, r *http.Request) {
+	productID, _, err := parseVariantPath(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req variantRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	variant, err := database.CreateVariant(v.db, v.tables, database.ProductVariant{
+		ProductID:  productID,
+		Name:       req.Name,
+		Attributes: req.Attributes,
+		Price:      req.Price,
+		Stock:      req.Stock,
+		Barcode:    req.Barcode,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrProductNotFound):
+			writeError(w, r, http.StatusNotFound, codeProductNotFound, "Product not found")
+		case errors.Is(err, database.ErrDuplicateProductCode):
+			writeError(w, r, http.StatusConflict, codeDuplicateCode, "Barcode already exists")
+		default:
+			writeDatabaseError(w, r, err, "Failed to create variant")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(variant)
+}
+
+// Update handles PUT /products/{id}/variants/{variantId}
+func (v *Variants) Update(w http.ResponseWriter, r *http.Request) {
+	productID, variantID, err := parseVariantPath(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	var req variantRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	variant, err := database.UpdateVariant(v.db, v.tables, database.ProductVariant{
+		ID:         variantID,
+		ProductID:  productID,
+		Name:       req.Name,
+		Attributes: req.Attributes,
+		Price:      req.Price,
+		Stock:      req.Stock,
+		Barcode:    req.Barcode,
+	})
+	if err != nil {
+		var stockErr *database.StockError
+		switch {
+		case errors.Is(err, database.ErrVariantNotFound):
+			writeError(w, r, http.StatusNotFound, codeVariantNotFound, "Variant not found")
+		case errors.Is(err, database.ErrDuplicateProductCode):
+			writeError(w, r, http.StatusConflict, codeDuplicateCode, "Barcode already exists")
+		case errors.As(err, &stockErr):
+			writeStockError(w, r, stockErr)
+		default:
+			writeDatabaseError(w, r, err, "Failed to update variant")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(variant)
+}
+
+// Delete handles DELETE /products/{id}/variants/{variantId}
+func (v *Variants) Delete(w http.ResponseWriter, r *http.Request) {
+	productID, variantID, err := parseVariantPath(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	err = database.DeleteVariant(v.db, v.tables, productID, variantID)
+	if err != nil {
+		if errors.Is(err, database.ErrVariantNotFound) {
+			writeError(w, r, http.StatusNotFound, codeVariantNotFound, "Variant not found")
+			return
+		}
+		writeDatabaseError(w, r, err, "Failed to delete variant")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
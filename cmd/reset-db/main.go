@@ -35,10 +35,12 @@ func main() {
 	dropSQL := `
 	DROP TABLE IF EXISTS transaction_detail_test;
 	DROP TABLE IF EXISTS transaction_test;
+	DROP TABLE IF EXISTS product_variant_test;
 	DROP TABLE IF EXISTS product_test;
 	DROP TABLE IF EXISTS category_test;
 	DROP TABLE IF EXISTS transaction_detail;
 	DROP TABLE IF EXISTS "transaction";
+	DROP TABLE IF EXISTS product_variant;
 	DROP TABLE IF EXISTS product;
 	DROP TABLE IF EXISTS category;
 	`
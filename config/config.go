@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,6 +17,8 @@ type DatabaseConfig struct {
 	Password string `yaml:"db_password"`
 	DBPort   string `yaml:"db_port"`
 	Port     string `yaml:"port"`
+	// VoidWindowMinutes is how long after checkout a transaction can be voided
+	VoidWindowMinutes int `yaml:"void_window_minutes"`
 }
 
 // LoadConfig loads configuration from secrets.yml if it exists, otherwise uses environment variables
@@ -94,5 +97,17 @@ func LoadConfig() (*DatabaseConfig, error) {
 		}
 	}
 
+	if cfg.VoidWindowMinutes <= 0 {
+		if env := os.Getenv("VOID_WINDOW_MINUTES"); env != "" {
+			minutes, err := strconv.Atoi(env)
+			if err != nil || minutes <= 0 {
+				return nil, fmt.Errorf("invalid VOID_WINDOW_MINUTES: %q", env)
+			}
+			cfg.VoidWindowMinutes = minutes
+		} else {
+			cfg.VoidWindowMinutes = 15
+		}
+	}
+
 	return cfg, nil
 }
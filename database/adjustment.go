@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidAdjustment = errors.New("invalid stock adjustment")
+
+// Reasons a stock adjustment can be made for
+const (
+	AdjustmentDamaged = "damaged"
+	AdjustmentExpired = "expired"
+	AdjustmentRecount = "recount"
+	AdjustmentTheft   = "theft"
+	AdjustmentGift    = "gift"
+)
+
+// AdjustmentReasons lists the valid reasons of a stock adjustment
+var AdjustmentReasons = []string{AdjustmentDamaged, AdjustmentExpired, AdjustmentRecount, AdjustmentTheft, AdjustmentGift}
+
+// ValidAdjustmentReason reports whether reason is one of AdjustmentReasons
+func ValidAdjustmentReason(reason string) bool {
+	for _, r := range AdjustmentReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// StockAdjustment is a relative change of a product's stock, or of one of its
+// variants when VariantID is set, at an outlet made outside a sale. Balance is
+// the total stock after the adjustment.
+type StockAdjustment struct {
+	ID        int       `json:"id" db:"id"`
+	ProductID int       `json:"product_id" db:"product_id"`
+	VariantID int       `json:"variant_id,omitempty" db:"variant_id"`
+	OutletID  int       `json:"outlet_id" db:"outlet_id"`
+	Delta     int       `json:"delta" db:"delta"`
+	Reason    string    `json:"reason" db:"reason"`
+	Note      string    `json:"note" db:"note"`
+	Balance   int       `json:"balance" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AdjustStock adds adj.Delta to the stock of adj.ProductID (or adj.VariantID)
+// while holding a row lock, so concurrent checkouts cannot interleave. The
+// adjustment is recorded together with an inventory movement referencing it.
+// The delta applies to adj.OutletID, or to DefaultOutletID when it is not set.
+// An adjustment that would make the outlet's stock negative returns a *StockError.
+func AdjustStock(db *sql.DB, tables Tables, adj StockAdjustment) (StockAdjustment, error) {
+	if adj.Delta == 0 || !ValidAdjustmentReason(adj.Reason) {
+		return StockAdjustment{}, ErrInvalidAdjustment
+	}
+	if adj.OutletID == 0 {
+		adj.OutletID = DefaultOutletID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return StockAdjustment{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var productID int
+	lockQuery := fmt.Sprintf("SELECT id FROM %s WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", tables.Product)
+	if err := tx.QueryRow(lockQuery, adj.ProductID).Scan(&productID); err != nil {
+		if err == sql.ErrNoRows {
+			return StockAdjustment{}, ErrProductNotFound
+		}
+		return StockAdjustment{}, fmt.Errorf("failed to query product: %w", translateError(err))
+	}
+	if adj.VariantID != 0 {
+		var exists bool
+		variantQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL)", tables.ProductVariant)
+		if err := tx.QueryRow(variantQuery, adj.VariantID, adj.ProductID).Scan(&exists); err != nil {
+			return StockAdjustment{}, fmt.Errorf("failed to query variant: %w", translateError(err))
+		}
+		if !exists {
+			return StockAdjustment{}, ErrVariantNotFound
+		}
+	}
+	if err := checkOutlet(tx, tables.Outlet, adj.OutletID); err != nil {
+		return StockAdjustment{}, err
+	}
+
+	adj, err = postAdjustment(tx, tables, adj)
+	if err != nil {
+		return StockAdjustment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockAdjustment{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return adj, nil
+}
+
+// postAdjustment applies adj to the stock of its outlet within tx and records
+// it together with an inventory movement referencing it
+func postAdjustment(tx *sql.Tx, tables Tables, adj StockAdjustment) (StockAdjustment, error) {
+	balance, err := changeStock(tx, tables, adj.OutletID, adj.ProductID, adj.VariantID, adj.Delta)
+	if err != nil {
+		return StockAdjustment{}, err
+	}
+	adj.Balance = balance
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (product_id, variant_id, outlet_id, delta, reason, note) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6) RETURNING id, created_at", tables.StockAdjustment)
+	err = tx.QueryRow(insertQuery, adj.ProductID, adj.VariantID, adj.OutletID, adj.Delta, adj.Reason, adj.Note).Scan(&adj.ID, &adj.CreatedAt)
+	if err != nil {
+		return StockAdjustment{}, fmt.Errorf("failed to create stock adjustment: %w", translateError(err))
+	}
+
+	err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: adj.ProductID, VariantID: adj.VariantID, OutletID: adj.OutletID, Delta: adj.Delta, Balance: adj.Balance, Reason: MovementAdjustment, ReferenceID: adj.ID})
+	if err != nil {
+		return StockAdjustment{}, err
+	}
+	return adj, nil
+}
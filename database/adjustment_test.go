@@ -0,0 +1,114 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAdjustStock(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Roti Tawar", Price: 15000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	adj, err := AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, Delta: -3, Reason: AdjustmentExpired, Note: "past best-before date"})
+	if err != nil {
+		t.Fatalf("AdjustStock failed: %v", err)
+	}
+	if adj.ID == 0 || adj.Balance != 7 {
+		t.Errorf("Expected adjustment with balance 7, got %+v", adj)
+	}
+
+	updated, err := GetProductByID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 7 || updated.Version != prod.Version {
+		t.Errorf("Expected stock 7 at version %d, got stock %d at version %d", prod.Version, updated.Stock, updated.Version)
+	}
+
+	page, err := GetStockHistory(db, "inventory_movement_test", "product_test", prod.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if m := page.Data[0]; m.Reason != MovementAdjustment || m.Delta != -3 || m.Balance != 7 || m.ReferenceID != adj.ID {
+		t.Errorf("Unexpected adjustment movement: %+v", m)
+	}
+
+	_, err = AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, Delta: -8, Reason: AdjustmentTheft})
+	var stockErr *StockError
+	if !errors.As(err, &stockErr) || stockErr.Available != 7 || stockErr.Requested != 8 {
+		t.Errorf("Expected StockError with 7 available, got %v", err)
+	}
+
+	_, err = AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, Delta: 1, Reason: "found"})
+	if err != ErrInvalidAdjustment {
+		t.Errorf("Expected ErrInvalidAdjustment for unknown reason, got %v", err)
+	}
+	_, err = AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, Reason: AdjustmentRecount})
+	if err != ErrInvalidAdjustment {
+		t.Errorf("Expected ErrInvalidAdjustment for zero delta, got %v", err)
+	}
+
+	updated, err = GetProductByID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 7 {
+		t.Errorf("Expected rejected adjustments to leave stock 7, got %d", updated.Stock)
+	}
+
+	if err := DeleteProduct(db, TestTables, prod.ID, 0); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	_, err = AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, Delta: 1, Reason: AdjustmentRecount})
+	if err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound for deleted product, got %v", err)
+	}
+}
+
+func TestAdjustVariantStock(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kemeja", Price: 120000})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	variant, err := CreateVariant(db, TestTables, ProductVariant{ProductID: prod.ID, Name: "L", Price: 120000, Stock: 2})
+	if err != nil {
+		t.Fatalf("CreateVariant failed: %v", err)
+	}
+
+	adj, err := AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, VariantID: variant.ID, Delta: 5, Reason: AdjustmentRecount, Note: "shelf count"})
+	if err != nil {
+		t.Fatalf("AdjustStock failed: %v", err)
+	}
+	if adj.Balance != 7 {
+		t.Errorf("Expected variant balance 7, got %d", adj.Balance)
+	}
+
+	variants, err := GetVariantsByProductID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetVariantsByProductID failed: %v", err)
+	}
+	if variants[0].Stock != 7 {
+		t.Errorf("Expected variant stock 7, got %d", variants[0].Stock)
+	}
+
+	_, err = AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID + 1, VariantID: variant.ID, Delta: 1, Reason: AdjustmentRecount})
+	if err != ErrProductNotFound && err != ErrVariantNotFound {
+		t.Errorf("Expected not found for mismatched product, got %v", err)
+	}
+
+	if err := DeleteVariant(db, TestTables, prod.ID, variant.ID); err != nil {
+		t.Fatalf("DeleteVariant failed: %v", err)
+	}
+	_, err = AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, VariantID: variant.ID, Delta: 1, Reason: AdjustmentRecount})
+	if err != ErrVariantNotFound {
+		t.Errorf("Expected ErrVariantNotFound for deleted variant, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package database
+
+// ValidBarcode reports whether code is a GTIN barcode with a correct check digit.
+// Accepted formats are EAN-8, UPC-A (12 digits), EAN-13 and GTIN-14.
+func ValidBarcode(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		if i == len(code)-1 {
+			break
+		}
+		digit := int(c - '0')
+		// Weights alternate 3,1,3,1... starting from the digit next to the check digit
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	check := (10 - sum%10) % 10
+	return int(code[len(code)-1]-'0') == check
+}
@@ -0,0 +1,28 @@
+package database
+
+import "testing"
+
+// TestValidBarcode tests check digit validation for supported GTIN formats
+func TestValidBarcode(t *testing.T) {
+	cases := []struct {
+		code  string
+		valid bool
+	}{
+		{"8998866200578", true},  // EAN-13
+		{"4006381333931", true},  // EAN-13
+		{"4006381333932", false}, // EAN-13 wrong check digit
+		{"036000291452", true},   // UPC-A
+		{"036000291453", false},  // UPC-A wrong check digit
+		{"96385074", true},       // EAN-8
+		{"10012345678902", true}, // GTIN-14
+		{"", false},
+		{"12345", false},
+		{"40063813339A1", false},
+	}
+
+	for _, tc := range cases {
+		if got := ValidBarcode(tc.code); got != tc.valid {
+			t.Errorf("ValidBarcode(%q) = %v, want %v", tc.code, got, tc.valid)
+		}
+	}
+}
@@ -1,8 +1,59 @@
 package database
 
-// Category represents a category entity in the database
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrCategoryNotFound       = errors.New("category not found")
+	ErrCategoryCycle          = errors.New("category cannot be its own ancestor")
+	ErrParentCategoryNotFound = errors.New("parent category not found")
+	ErrCategoryInUse          = errors.New("category has products or subcategories")
+	ErrCategoryDeleted        = errors.New("category is deleted")
+)
+
+// Category represents a category entity in the database.
+// Description is nil when the category has none; ParentID is nil for
+// top-level categories.
 type Category struct {
-	ID          int    `json:"id" db:"id"`
-	Name        string `json:"name" db:"name"`
-	Description string `json:"description" db:"description"`
+	ID          int     `json:"id" db:"id"`
+	Name        string  `json:"name" db:"name"`
+	Description *string `json:"description" db:"description"`
+	ParentID    *int    `json:"parent_id" db:"parent_id"`
+	// Version is incremented on every write and used for optimistic locking
+	Version int `json:"version" db:"version"`
+	// DeletedAt is set when the category has been soft-deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// CategoryNode is a category with its subcategories, as returned by GetCategoryTree
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// CategoryListParams controls pagination and ordering of the category list.
+// Sort may be "id" (default) or "name". Soft-deleted categories are only
+// listed when IncludeDeleted is set.
+type CategoryListParams struct {
+	Limit          int
+	Cursor         string
+	Sort           string
+	Desc           bool
+	IncludeDeleted bool
+}
+
+const categoryColumns = "id, name, description, parent_id, version, deleted_at"
+
+// scanFields returns scan destinations matching categoryColumns
+func (c *Category) scanFields() []interface{} {
+	return []interface{}{&c.ID, &c.Name, &c.Description, &c.ParentID, &c.Version, &c.DeletedAt}
+}
+
+// categorySubtreeQuery returns a subquery selecting the ids of category
+// $<param> and all of its descendants in categoryTable
+func categorySubtreeQuery(categoryTable, param string) string {
+	return "WITH RECURSIVE subtree AS (SELECT id FROM " + categoryTable + " WHERE id = " + param +
+		" UNION ALL SELECT c.id FROM " + categoryTable + " c JOIN subtree s ON c.parent_id = s.id) SELECT id FROM subtree"
 }
@@ -74,12 +74,25 @@ func teardownTestDB(t *testing.T, db *sql.DB) {
 	}
 }
 
+// stringPtr returns a pointer to s, for optional string arguments
+func stringPtr(s string) *string {
+	return &s
+}
+
+// stringValue returns the string p points to, or "" when p is nil
+func stringValue(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
 // TestCreateCategory tests the Create function
 func TestCreateCategory(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Electronics", "Electronic devices")
+	cat, err := Create(db, "category_test", "Electronics", stringPtr("Electronic devices"), nil)
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
@@ -92,8 +105,8 @@ func TestCreateCategory(t *testing.T) {
 		t.Errorf("Expected name 'Electronics', got '%s'", cat.Name)
 	}
 
-	if cat.Description != "Electronic devices" {
-		t.Errorf("Expected description 'Electronic devices', got '%s'", cat.Description)
+	if stringValue(cat.Description) != "Electronic devices" {
+		t.Errorf("Expected description 'Electronic devices', got '%s'", stringValue(cat.Description))
 	}
 }
 
@@ -103,7 +116,7 @@ func TestGetByID(t *testing.T) {
 	defer teardownTestDB(t, db)
 
 	// Create a category first
-	created, err := Create(db, "category_test", "Books", "All types of books")
+	created, err := Create(db, "category_test", "Books", stringPtr("All types of books"), nil)
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
@@ -122,8 +135,8 @@ func TestGetByID(t *testing.T) {
 		t.Errorf("Expected name 'Books', got '%s'", cat.Name)
 	}
 
-	if cat.Description != "All types of books" {
-		t.Errorf("Expected description 'All types of books', got '%s'", cat.Description)
+	if stringValue(cat.Description) != "All types of books" {
+		t.Errorf("Expected description 'All types of books', got '%s'", stringValue(cat.Description))
 	}
 }
 
@@ -137,8 +150,8 @@ func TestGetByIDNotFound(t *testing.T) {
 		t.Error("Expected error for non-existent category, got nil")
 	}
 
-	if err.Error() != "category not found" {
-		t.Errorf("Expected 'category not found' error, got '%v'", err)
+	if err != ErrCategoryNotFound {
+		t.Errorf("Expected ErrCategoryNotFound, got '%v'", err)
 	}
 }
 
@@ -148,12 +161,12 @@ func TestGetAll(t *testing.T) {
 	defer teardownTestDB(t, db)
 
 	// Create multiple categories
-	_, err := Create(db, "category_test", "Electronics", "Electronic devices")
+	_, err := Create(db, "category_test", "Electronics", stringPtr("Electronic devices"), nil)
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
 
-	_, err = Create(db, "category_test", "Books", "All types of books")
+	_, err = Create(db, "category_test", "Books", stringPtr("All types of books"), nil)
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
@@ -203,19 +216,61 @@ func TestGetAllEmpty(t *testing.T) {
 	}
 }
 
+// TestListCategoriesPagination tests cursor pagination of categories sorted by name
+func TestListCategoriesPagination(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	for _, name := range []string{"Drinks", "Books", "Electronics"} {
+		if _, err := Create(db, "category_test", name, nil, nil); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	first, err := ListCategories(db, "category_test", CategoryListParams{Limit: 2, Sort: "name"})
+	if err != nil {
+		t.Fatalf("ListCategories failed: %v", err)
+	}
+	if first.Total != 3 {
+		t.Errorf("Expected total 3, got %d", first.Total)
+	}
+	if len(first.Data) != 2 || first.Data[0].Name != "Books" || first.Data[1].Name != "Drinks" {
+		t.Fatalf("Unexpected first page: %+v", first.Data)
+	}
+	if first.NextCursor == "" {
+		t.Fatal("Expected next_cursor on first page")
+	}
+
+	second, err := ListCategories(db, "category_test", CategoryListParams{Limit: 2, Sort: "name", Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("ListCategories failed: %v", err)
+	}
+	if len(second.Data) != 1 || second.Data[0].Name != "Electronics" {
+		t.Errorf("Unexpected second page: %+v", second.Data)
+	}
+	if second.NextCursor != "" {
+		t.Errorf("Expected empty next_cursor on last page, got %q", second.NextCursor)
+	}
+
+	_, err = ListCategories(db, "category_test", CategoryListParams{Cursor: "not-a-cursor"})
+	if err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
 // TestUpdateCategory tests the Update function
 func TestUpdateCategory(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
 
 	// Create a category
-	created, err := Create(db, "category_test", "Electronics", "Electronic devices")
+	created, err := Create(db, "category_test", "Electronics", stringPtr("Electronic devices"), nil)
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
 
 	// Update it
-	updated, err := Update(db, "category_test", created.ID, "Updated Electronics", "Updated description")
+	updated, err := Update(db, "category_test", created.ID, "Updated Electronics", stringPtr("Updated description"), nil, 0)
 	if err != nil {
 		t.Fatalf("Update failed: %v", err)
 	}
@@ -228,8 +283,8 @@ func TestUpdateCategory(t *testing.T) {
 		t.Errorf("Expected name 'Updated Electronics', got '%s'", updated.Name)
 	}
 
-	if updated.Description != "Updated description" {
-		t.Errorf("Expected description 'Updated description', got '%s'", updated.Description)
+	if stringValue(updated.Description) != "Updated description" {
+		t.Errorf("Expected description 'Updated description', got '%s'", stringValue(updated.Description))
 	}
 
 	// Verify by fetching
@@ -248,13 +303,13 @@ func TestUpdateCategoryNotFound(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
 
-	_, err := Update(db, "category_test", 9999, "Name", "Description")
+	_, err := Update(db, "category_test", 9999, "Name", stringPtr("Description"), nil, 0)
 	if err == nil {
 		t.Error("Expected error for non-existent category, got nil")
 	}
 
-	if err.Error() != "category not found" {
-		t.Errorf("Expected 'category not found' error, got '%v'", err)
+	if err != ErrCategoryNotFound {
+		t.Errorf("Expected ErrCategoryNotFound, got '%v'", err)
 	}
 }
 
@@ -264,13 +319,13 @@ func TestDeleteCategory(t *testing.T) {
 	defer teardownTestDB(t, db)
 
 	// Create a category
-	created, err := Create(db, "category_test", "Electronics", "Electronic devices")
+	created, err := Create(db, "category_test", "Electronics", stringPtr("Electronic devices"), nil)
 	if err != nil {
 		t.Fatalf("Create failed: %v", err)
 	}
 
 	// Delete it
-	err = Delete(db, "category_test", created.ID)
+	err = Delete(db, "category_test", "product_test", created.ID, 0)
 	if err != nil {
 		t.Fatalf("Delete failed: %v", err)
 	}
@@ -287,13 +342,13 @@ func TestDeleteCategoryNotFound(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
 
-	err := Delete(db, "category_test", 9999)
+	err := Delete(db, "category_test", "product_test", 9999, 0)
 	if err == nil {
 		t.Error("Expected error for non-existent category, got nil")
 	}
 
-	if err.Error() != "category not found" {
-		t.Errorf("Expected 'category not found' error, got '%v'", err)
+	if err != ErrCategoryNotFound {
+		t.Errorf("Expected ErrCategoryNotFound, got '%v'", err)
 	}
 }
 
@@ -303,12 +358,12 @@ func TestMultipleOperations(t *testing.T) {
 	defer teardownTestDB(t, db)
 
 	// Create multiple categories
-	cat1, err := Create(db, "category_test", "Electronics", "Electronic devices")
+	cat1, err := Create(db, "category_test", "Electronics", stringPtr("Electronic devices"), nil)
 	if err != nil {
 		t.Fatalf("Create cat1 failed: %v", err)
 	}
 
-	cat2, err := Create(db, "category_test", "Books", "All types of books")
+	cat2, err := Create(db, "category_test", "Books", stringPtr("All types of books"), nil)
 	if err != nil {
 		t.Fatalf("Create cat2 failed: %v", err)
 	}
@@ -324,13 +379,13 @@ func TestMultipleOperations(t *testing.T) {
 	}
 
 	// Update one
-	_, err = Update(db, "category_test", cat1.ID, "Updated Electronics", "Updated")
+	_, err = Update(db, "category_test", cat1.ID, "Updated Electronics", stringPtr("Updated"), nil, 0)
 	if err != nil {
 		t.Fatalf("Update failed: %v", err)
 	}
 
 	// Delete one
-	err = Delete(db, "category_test", cat2.ID)
+	err = Delete(db, "category_test", "product_test", cat2.ID, 0)
 	if err != nil {
 		t.Fatalf("Delete failed: %v", err)
 	}
@@ -356,7 +411,7 @@ func TestCategoryInputValidation(t *testing.T) {
 	defer teardownTestDB(t, db)
 
 	// Test whitespace-only name (validation happens at API layer, but document expected behavior)
-	cat, err := Create(db, "category_test", "   ", "Valid description")
+	cat, err := Create(db, "category_test", "   ", stringPtr("Valid description"), nil)
 	if err != nil {
 		t.Logf("Whitespace name validation at API layer (expected)")
 		return
@@ -377,7 +432,7 @@ func TestCategoryMaxLength(t *testing.T) {
 	for i := 0; i < 255; i++ {
 		longName += "a"
 	}
-	cat, err := Create(db, "category_test", longName, "Valid")
+	cat, err := Create(db, "category_test", longName, stringPtr("Valid"), nil)
 	if err != nil {
 		t.Fatalf("Create with 255 char name failed: %v", err)
 	}
@@ -387,7 +442,7 @@ func TestCategoryMaxLength(t *testing.T) {
 
 	// Create with 256 chars name (validation at API layer)
 	tooLongName := longName + "a"
-	cat2, err := Create(db, "category_test", tooLongName, "Valid")
+	cat2, err := Create(db, "category_test", tooLongName, stringPtr("Valid"), nil)
 	if err != nil {
 		t.Logf("Database returned error for 256 char name: %v (validation at API layer)", err)
 		return
@@ -403,13 +458,13 @@ func TestCategoryUpdateValidation(t *testing.T) {
 	defer teardownTestDB(t, db)
 
 	// Create initial category
-	cat, err := Create(db, "category_test", "InitialCat", "Initial description")
+	cat, err := Create(db, "category_test", "InitialCat", stringPtr("Initial description"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
 	// Test valid update
-	updated, err := Update(db, "category_test", cat.ID, "UpdatedCat", "Updated description")
+	updated, err := Update(db, "category_test", cat.ID, "UpdatedCat", stringPtr("Updated description"), nil, 0)
 	if err != nil {
 		t.Fatalf("Valid update failed: %v", err)
 	}
@@ -418,18 +473,199 @@ func TestCategoryUpdateValidation(t *testing.T) {
 	}
 
 	// Test update with whitespace name (database layer allows, validation at API layer)
-	updated2, err := Update(db, "category_test", cat.ID, "   ", "Test")
+	updated2, err := Update(db, "category_test", cat.ID, "   ", stringPtr("Test"), nil, 0)
 	if err != nil {
 		t.Logf("Update with whitespace name failed: %v (validation at API layer)", err)
 		return
 	}
 	t.Logf("Update with whitespace name succeeded at DB layer: %q (API layer should validate)", updated2.Name)
 
-	// Test update with empty description (database layer allows, validation at API layer)
-	_, err = Update(db, "category_test", cat.ID, "CatName", "")
+	// A nil description is stored as NULL, not as an empty string
+	updated3, err := Update(db, "category_test", cat.ID, "CatName", nil, nil, 0)
 	if err != nil {
-		t.Logf("Update with empty description failed: %v (validation at API layer)", err)
-		return
+		t.Fatalf("Update without description failed: %v", err)
+	}
+	if updated3.Description != nil {
+		t.Errorf("Expected nil description, got %q", *updated3.Description)
+	}
+	var isNull bool
+	if err := db.QueryRow("SELECT description IS NULL FROM category_test WHERE id = $1", cat.ID).Scan(&isNull); err != nil {
+		t.Fatalf("Failed to read description: %v", err)
+	}
+	if !isNull {
+		t.Error("Expected description to be stored as NULL")
+	}
+}
+
+// TestCategoryHierarchy tests parent links, cycle prevention and the category tree
+func TestCategoryHierarchy(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	minuman, err := Create(db, "category_test", "Minuman", nil, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	kopi, err := Create(db, "category_test", "Kopi", nil, &minuman.ID)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	kopiSusu, err := Create(db, "category_test", "Kopi Susu", nil, &kopi.ID)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if kopiSusu.ParentID == nil || *kopiSusu.ParentID != kopi.ID {
+		t.Errorf("Expected parent_id %d, got %v", kopi.ID, kopiSusu.ParentID)
+	}
+
+	missing := 9999
+	if _, err := Create(db, "category_test", "Teh", nil, &missing); err != ErrParentCategoryNotFound {
+		t.Errorf("Expected ErrParentCategoryNotFound, got %v", err)
+	}
+
+	// Moving a category under itself or a descendant must fail
+	if _, err := Update(db, "category_test", kopi.ID, "Kopi", nil, &kopi.ID, 0); err != ErrCategoryCycle {
+		t.Errorf("Expected ErrCategoryCycle for self parent, got %v", err)
+	}
+	if _, err := Update(db, "category_test", minuman.ID, "Minuman", nil, &kopiSusu.ID, 0); err != ErrCategoryCycle {
+		t.Errorf("Expected ErrCategoryCycle for descendant parent, got %v", err)
+	}
+
+	tree, err := GetCategoryTree(db, "category_test")
+	if err != nil {
+		t.Fatalf("GetCategoryTree failed: %v", err)
+	}
+	if len(tree) != 1 || tree[0].ID != minuman.ID {
+		t.Fatalf("Expected single root Minuman, got %+v", tree)
+	}
+	if len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 || tree[0].Children[0].Children[0].ID != kopiSusu.ID {
+		t.Errorf("Expected Minuman > Kopi > Kopi Susu, got %+v", tree[0])
+	}
+
+	// Moving to the root clears the parent
+	moved, err := Update(db, "category_test", kopiSusu.ID, "Kopi Susu", nil, nil, 0)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if moved.ParentID != nil {
+		t.Errorf("Expected nil parent_id, got %d", *moved.ParentID)
+	}
+
+	// A category with subcategories cannot be deleted
+	if err := Delete(db, "category_test", "product_test", minuman.ID, 0); err != ErrCategoryInUse {
+		t.Errorf("Expected ErrCategoryInUse deleting category with subcategories, got %v", err)
+	}
+}
+
+// TestSoftDeleteCategory tests soft deletion, restore and include_deleted listing
+func TestSoftDeleteCategory(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	parent, err := Create(db, "category_test", "Minuman", nil, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	child, err := Create(db, "category_test", "Kopi", nil, &parent.ID)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if _, err := CreateProduct(db, TestTables, Product{Name: "Kopi Hitam", Price: 10000, Stock: 1, CategoryID: child.ID}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if err := Delete(db, "category_test", "product_test", child.ID, 0); err != ErrCategoryInUse {
+		t.Fatalf("Expected ErrCategoryInUse for category with products, got %v", err)
+	}
+
+	products, err := GetAllProducts(db, TestTables)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if err := DeleteProduct(db, TestTables, products[0].ID, 0); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+
+	// Deleted products no longer block their category, and children go before parents
+	if err := Delete(db, "category_test", "product_test", child.ID, 0); err != nil {
+		t.Fatalf("Delete child failed: %v", err)
+	}
+	if err := Delete(db, "category_test", "product_test", parent.ID, 0); err != nil {
+		t.Fatalf("Delete parent failed: %v", err)
+	}
+
+	if _, err := GetByID(db, "category_test", parent.ID); err == nil {
+		t.Error("Expected deleted category to be hidden from GetByID")
+	}
+	all, err := GetAll(db, "category_test")
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("Expected no active categories, got %d", len(all))
+	}
+
+	page, err := ListCategories(db, "category_test", CategoryListParams{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("ListCategories failed: %v", err)
+	}
+	if page.Total != 2 || page.Data[0].DeletedAt == nil {
+		t.Errorf("Expected 2 deleted categories with deleted_at, got %+v", page)
+	}
+
+	// The child cannot come back before its parent
+	if _, err := RestoreCategory(db, "category_test", child.ID); err != ErrCategoryDeleted {
+		t.Errorf("Expected ErrCategoryDeleted restoring under deleted parent, got %v", err)
+	}
+	restored, err := RestoreCategory(db, "category_test", parent.ID)
+	if err != nil {
+		t.Fatalf("RestoreCategory failed: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Errorf("Expected deleted_at to be cleared, got %v", restored.DeletedAt)
+	}
+	if _, err := RestoreCategory(db, "category_test", child.ID); err != nil {
+		t.Errorf("RestoreCategory child failed: %v", err)
+	}
+
+	if _, err := RestoreCategory(db, "category_test", 9999); err != ErrCategoryNotFound {
+		t.Errorf("Expected ErrCategoryNotFound, got %v", err)
+	}
+}
+
+// TestCategoryVersion tests that writes bump the version and stale versions are rejected
+func TestCategoryVersion(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	created, err := Create(db, "category_test", "Minuman", nil, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if created.Version != 1 {
+		t.Fatalf("Expected version 1, got %d", created.Version)
+	}
+
+	updated, err := Update(db, "category_test", created.ID, "Minuman Dingin", nil, nil, created.Version)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("Expected version 2, got %d", updated.Version)
+	}
+
+	// A second writer still holding version 1 must not overwrite the change
+	if _, err := Update(db, "category_test", created.ID, "Minuman Panas", nil, nil, created.Version); err != ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+	if err := Delete(db, "category_test", "product_test", created.ID, created.Version); err != ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch on delete, got %v", err)
+	}
+	if _, err := Update(db, "category_test", 9999, "Name", nil, nil, 1); err != ErrCategoryNotFound {
+		t.Errorf("Expected ErrCategoryNotFound, got %v", err)
+	}
+
+	if err := Delete(db, "category_test", "product_test", created.ID, updated.Version); err != nil {
+		t.Fatalf("Delete failed: %v", err)
 	}
-	t.Logf("Update with empty description succeeded at DB layer (API layer should validate)")
 }
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Postgres errors that callers may need to tell apart are translated to these
+// sentinels by translateError. The original *pq.Error stays in the chain.
+var (
+	// ErrForeignKeyViolation is returned when a write references a missing row
+	// or removes a row that is still referenced (23503)
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	// ErrUniqueViolation is returned when a write duplicates a unique value (23505)
+	ErrUniqueViolation = errors.New("unique violation")
+	// ErrSerializationFailure is returned when a transaction lost a race with a
+	// concurrent one (40001) or was chosen as a deadlock victim (40P01). The
+	// transaction can be retried.
+	ErrSerializationFailure = errors.New("serialization failure")
+)
+
+// translateError wraps a Postgres error with the matching sentinel error so it
+// can be checked with errors.Is. Other errors are returned unchanged.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case "23503":
+		return fmt.Errorf("%w: %w", ErrForeignKeyViolation, err)
+	case "23505":
+		return fmt.Errorf("%w: %w", ErrUniqueViolation, err)
+	case "40001", "40P01":
+		return fmt.Errorf("%w: %w", ErrSerializationFailure, err)
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation (23505)
+func isUniqueViolation(err error) bool {
+	return errors.Is(translateError(err), ErrUniqueViolation)
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign_key_violation (23503)
+func isForeignKeyViolation(err error) bool {
+	return errors.Is(translateError(err), ErrForeignKeyViolation)
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// TestTranslateError tests that Postgres error codes map to sentinel errors
+func TestTranslateError(t *testing.T) {
+	cases := []struct {
+		code pq.ErrorCode
+		want error
+	}{
+		{"23503", ErrForeignKeyViolation},
+		{"23505", ErrUniqueViolation},
+		{"40001", ErrSerializationFailure},
+		{"40P01", ErrSerializationFailure},
+	}
+
+	for _, tc := range cases {
+		pqErr := &pq.Error{Code: tc.code}
+		err := fmt.Errorf("failed to update product: %w", translateError(pqErr))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("translateError(%s) = %v, want %v", tc.code, err, tc.want)
+		}
+		var got *pq.Error
+		if !errors.As(err, &got) || got != pqErr {
+			t.Errorf("translateError(%s) lost the original *pq.Error", tc.code)
+		}
+	}
+
+	other := &pq.Error{Code: "22001"}
+	if err := translateError(other); err != other {
+		t.Errorf("Expected unmapped code to be returned unchanged, got %v", err)
+	}
+	plain := errors.New("connection refused")
+	if err := translateError(plain); err != plain {
+		t.Errorf("Expected non-Postgres error to be returned unchanged, got %v", err)
+	}
+}
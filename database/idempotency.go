@@ -0,0 +1,63 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrIdempotencyConflict = errors.New("idempotency key was used for a different request")
+
+// requestHash returns the hex SHA-256 of the JSON encoding of req
+func requestHash(req interface{}) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// claimIdempotencyKey locks key for the rest of the database transaction tx,
+// waiting while another database transaction holds it. If a checkout was
+// already stored under the key it returns the stored response, or
+// ErrIdempotencyConflict when the hash differs; otherwise it returns nil and
+// the caller stores its checkout with recordIdempotencyKey.
+func claimIdempotencyKey(tx *sql.Tx, keyTable, key, hash string) ([]byte, error) {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended($1, 0))", keyTable+":"+key); err != nil {
+		return nil, fmt.Errorf("failed to lock idempotency key: %w", translateError(err))
+	}
+
+	var storedHash string
+	var response []byte
+	selectQuery := fmt.Sprintf("SELECT request_hash, response FROM %s WHERE idempotency_key = $1", keyTable)
+	err := tx.QueryRow(selectQuery, key).Scan(&storedHash, &response)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query idempotency key: %w", translateError(err))
+	}
+	if storedHash != hash {
+		return nil, ErrIdempotencyConflict
+	}
+	return response, nil
+}
+
+// recordIdempotencyKey stores key with the request hash, the transaction
+// created under it and the JSON encoding of the transaction as the response
+// to replay for retries
+func recordIdempotencyKey(tx *sql.Tx, keyTable, key, hash string, transaction Transaction) ([]byte, error) {
+	response, err := json.Marshal(transaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction: %w", err)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (idempotency_key, request_hash, transaction_id, response) VALUES ($1, $2, $3, $4)", keyTable)
+	if _, err := tx.Exec(query, key, hash, transaction.ID, response); err != nil {
+		return nil, fmt.Errorf("failed to record idempotency key: %w", translateError(err))
+	}
+	return response, nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Reasons recorded on inventory movements
+const (
+	MovementSale        = "sale"
+	MovementManualEdit  = "manual_edit"
+	MovementAdjustment  = "adjustment"
+	MovementReturn      = "return"
+	MovementReceipt     = "receipt"
+	MovementTransferOut = "transfer_out"
+	MovementTransferIn  = "transfer_in"
+	MovementVoid        = "void"
+)
+
+// InventoryMovement is one entry of the stock ledger. Delta is the change in
+// stock at OutletID and Balance the total stock of the product, or of the
+// variant when VariantID is set, after the change. ReferenceID points at the
+// record that caused the movement, such as the transaction of a sale.
+type InventoryMovement struct {
+	ID          int       `json:"id" db:"id"`
+	ProductID   int       `json:"product_id" db:"product_id"`
+	VariantID   int       `json:"variant_id,omitempty" db:"variant_id"`
+	OutletID    int       `json:"outlet_id" db:"outlet_id"`
+	Delta       int       `json:"delta" db:"delta"`
+	Balance     int       `json:"balance" db:"balance"`
+	Reason      string    `json:"reason" db:"reason"`
+	ReferenceID int       `json:"reference_id,omitempty" db:"reference_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+const movementColumns = "id, product_id, COALESCE(variant_id, 0), outlet_id, delta, balance, reason, COALESCE(reference_id, 0), created_at"
+
+// scanFields returns scan destinations matching movementColumns
+func (m *InventoryMovement) scanFields() []interface{} {
+	return []interface{}{&m.ID, &m.ProductID, &m.VariantID, &m.OutletID, &m.Delta, &m.Balance, &m.Reason, &m.ReferenceID, &m.CreatedAt}
+}
+
+// recordMovement appends m to the stock ledger. It must run in the database
+// transaction that changed the stock. Movements without a delta are skipped
+// and movements without an outlet are recorded at DefaultOutletID.
+func recordMovement(tx *sql.Tx, movementTable string, m InventoryMovement) error {
+	if m.Delta == 0 {
+		return nil
+	}
+	if m.OutletID == 0 {
+		m.OutletID = DefaultOutletID
+	}
+	query := fmt.Sprintf("INSERT INTO %s (product_id, variant_id, outlet_id, delta, balance, reason, reference_id) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, NULLIF($7, 0))", movementTable)
+	_, err := tx.Exec(query, m.ProductID, m.VariantID, m.OutletID, m.Delta, m.Balance, m.Reason, m.ReferenceID)
+	if err != nil {
+		return fmt.Errorf("failed to record inventory movement: %w", translateError(err))
+	}
+	return nil
+}
+
+// GetStockHistory retrieves a page of the inventory movements of a product and
+// its variants, newest first. The history of soft-deleted products stays readable.
+func GetStockHistory(db *sql.DB, movementTable, productTable string, productID, limit int, cursor string) (Page[InventoryMovement], error) {
+	var exists bool
+	existsQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)", productTable)
+	if err := db.QueryRow(existsQuery, productID).Scan(&exists); err != nil {
+		return Page[InventoryMovement]{}, fmt.Errorf("failed to query product: %w", err)
+	}
+	if !exists {
+		return Page[InventoryMovement]{}, ErrProductNotFound
+	}
+
+	page := Page[InventoryMovement]{Data: []InventoryMovement{}}
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE product_id = $1", movementTable)
+	if err := db.QueryRow(countQuery, productID).Scan(&page.Total); err != nil {
+		return Page[InventoryMovement]{}, fmt.Errorf("failed to count inventory movements: %w", err)
+	}
+
+	const sortKey = "id:DESC"
+	conds := []string{"product_id = $1"}
+	args := []interface{}{productID}
+	if cursor != "" {
+		c, err := decodeCursor(cursor, sortKey)
+		if err != nil {
+			return Page[InventoryMovement]{}, err
+		}
+		args = append(args, c.ID)
+		conds = append(conds, fmt.Sprintf("id < $%d", len(args)))
+	}
+
+	limit = normalizeLimit(limit)
+	args = append(args, limit+1)
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY id DESC LIMIT $%d", movementColumns, movementTable, whereClause(conds), len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Page[InventoryMovement]{}, fmt.Errorf("failed to query inventory movements: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m InventoryMovement
+		if err := rows.Scan(m.scanFields()...); err != nil {
+			return Page[InventoryMovement]{}, fmt.Errorf("failed to scan inventory movement: %w", err)
+		}
+		page.Data = append(page.Data, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page[InventoryMovement]{}, fmt.Errorf("error iterating inventory movements: %w", err)
+	}
+
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		last := page.Data[limit-1]
+		page.NextCursor = encodeCursor(sortKey, strconv.Itoa(last.ID), last.ID)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import "testing"
+
+func TestStockHistory(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Teh Botol", Price: 5000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	if _, err := UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: "Teh Botol", Price: 5500, Stock: 7}, 0); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+	// A write that keeps the stock leaves no movement
+	if _, err := UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: "Teh Botol", Price: 6000, Stock: 7}, 0); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 2}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	page, err := GetStockHistory(db, "inventory_movement_test", "product_test", prod.ID, 2, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if page.Total != 3 || len(page.Data) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected 2 of 3 movements with a next cursor, got %d of %d (cursor %q)", len(page.Data), page.Total, page.NextCursor)
+	}
+	sale := page.Data[0]
+	if sale.Reason != MovementSale || sale.Delta != -2 || sale.Balance != 5 || sale.ReferenceID != trx.ID {
+		t.Errorf("Unexpected sale movement: %+v", sale)
+	}
+	edit := page.Data[1]
+	if edit.Reason != MovementManualEdit || edit.Delta != -3 || edit.Balance != 7 {
+		t.Errorf("Unexpected manual edit movement: %+v", edit)
+	}
+
+	page, err = GetStockHistory(db, "inventory_movement_test", "product_test", prod.ID, 2, page.NextCursor)
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if len(page.Data) != 1 || page.NextCursor != "" {
+		t.Fatalf("Expected a last page with 1 movement, got %d (cursor %q)", len(page.Data), page.NextCursor)
+	}
+	if opening := page.Data[0]; opening.Delta != 10 || opening.Balance != 10 {
+		t.Errorf("Unexpected opening movement: %+v", opening)
+	}
+
+	// A failed checkout records nothing
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 99}}, nil); err == nil {
+		t.Fatal("Expected checkout to fail")
+	}
+	page, err = GetStockHistory(db, "inventory_movement_test", "product_test", prod.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if page.Total != 3 {
+		t.Errorf("Expected 3 movements after failed checkout, got %d", page.Total)
+	}
+
+	_, err = GetStockHistory(db, "inventory_movement_test", "product_test", 9999, 0, "")
+	if err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+func TestStockHistoryVariant(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kaos Polos", Price: 50000})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	variant, err := CreateVariant(db, TestTables, ProductVariant{ProductID: prod.ID, Name: "M", Price: 50000, Stock: 4})
+	if err != nil {
+		t.Fatalf("CreateVariant failed: %v", err)
+	}
+	variant.Stock = 6
+	if _, err := UpdateVariant(db, TestTables, variant); err != nil {
+		t.Fatalf("UpdateVariant failed: %v", err)
+	}
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{VariantID: variant.ID, Quantity: 1}}, nil); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	page, err := GetStockHistory(db, "inventory_movement_test", "product_test", prod.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if len(page.Data) != 3 {
+		t.Fatalf("Expected 3 movements, got %d", len(page.Data))
+	}
+	for i, want := range []struct{ delta, balance int }{{-1, 5}, {2, 6}, {4, 4}} {
+		m := page.Data[i]
+		if m.VariantID != variant.ID || m.Delta != want.delta || m.Balance != want.balance {
+			t.Errorf("Movement %d: expected variant %d delta %d balance %d, got %+v", i, variant.ID, want.delta, want.balance, m)
+		}
+	}
+}
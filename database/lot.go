@@ -0,0 +1,243 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidLot = errors.New("invalid lot")
+
+// Lot is a batch of a product, or of one of its variants when VariantID is
+// set, at an outlet that shares an expiry date. Lots hold part or all of the
+// outlet's stock; stock outside lots has no expiry date. Every decrease of
+// the outlet's stock takes from its lots first-expired-first-out.
+type Lot struct {
+	ID          int       `json:"id" db:"id"`
+	OutletID    int       `json:"outlet_id" db:"outlet_id"`
+	ProductID   int       `json:"product_id" db:"product_id"`
+	VariantID   int       `json:"variant_id,omitempty" db:"variant_id"`
+	ProductName string    `json:"product_name,omitempty" db:"-"`
+	LotNumber   string    `json:"lot_number" db:"lot_number"`
+	ExpiryDate  string    `json:"expiry_date" db:"expiry_date"`
+	Quantity    int       `json:"quantity" db:"quantity"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// lotDateLayout is the format of lot expiry dates
+const lotDateLayout = "2006-01-02"
+
+const lotColumns = "l.id, l.outlet_id, l.product_id, l.variant_id, l.lot_number, to_char(l.expiry_date, 'YYYY-MM-DD'), l.quantity, l.created_at"
+
+// scanFields returns scan destinations matching lotColumns
+func (l *Lot) scanFields() []interface{} {
+	return []interface{}{&l.ID, &l.OutletID, &l.ProductID, &l.VariantID, &l.LotNumber, &l.ExpiryDate, &l.Quantity, &l.CreatedAt}
+}
+
+// LotUsage is a quantity taken from a lot, such as by a checkout line
+type LotUsage struct {
+	LotID      int    `json:"lot_id" db:"lot_id"`
+	LotNumber  string `json:"lot_number" db:"-"`
+	ExpiryDate string `json:"expiry_date" db:"-"`
+	Quantity   int    `json:"quantity" db:"quantity"`
+}
+
+// validLotDate reports whether date is a YYYY-MM-DD date
+func validLotDate(date string) bool {
+	_, err := time.Parse(lotDateLayout, date)
+	return err == nil
+}
+
+// GetLots retrieves the lots of a product that still hold stock, at all
+// outlets, ordered by expiry date
+func GetLots(db *sql.DB, tables Tables, productID int) ([]Lot, error) {
+	var exists bool
+	existsQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)", tables.Product)
+	if err := db.QueryRow(existsQuery, productID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to query product: %w", err)
+	}
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s l WHERE l.product_id = $1 AND l.quantity > 0 ORDER BY l.expiry_date, l.id", lotColumns, tables.Lot)
+	return queryLots(db, query, false, productID)
+}
+
+// GetExpiringLots retrieves the lots that still hold stock and expire on or
+// before cutoff, including lots that have already expired, ordered by expiry
+// date. A non-zero outletID limits the lots to that outlet.
+func GetExpiringLots(db *sql.DB, tables Tables, cutoff time.Time, outletID int) ([]Lot, error) {
+	query := fmt.Sprintf("SELECT %s, p.name FROM %s l JOIN %s p ON l.product_id = p.id WHERE l.quantity > 0 AND l.expiry_date <= $1 AND ($2 = 0 OR l.outlet_id = $2) ORDER BY l.expiry_date, l.product_id, l.id", lotColumns, tables.Lot, tables.Product)
+	return queryLots(db, query, true, cutoff.Format(lotDateLayout), outletID)
+}
+
+// queryLots runs a query selecting lotColumns, followed by the product name
+// when withName is set, and returns the lots
+func queryLots(db *sql.DB, query string, withName bool, args ...interface{}) ([]Lot, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lots: %w", err)
+	}
+	defer rows.Close()
+
+	lots := []Lot{}
+	for rows.Next() {
+		var l Lot
+		dest := l.scanFields()
+		if withName {
+			dest = append(dest, &l.ProductName)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan lot: %w", err)
+		}
+		lots = append(lots, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating lots: %w", err)
+	}
+
+	return lots, nil
+}
+
+// CreateLot records that lot.Quantity of the stock already at lot.OutletID,
+// or at DefaultOutletID when it is not set, belongs to a lot. Only stock
+// outside other lots can be assigned; asking for more returns a *StockError
+// with the stock outside lots as available. An existing lot number of the
+// same product at the outlet grows by the quantity if its expiry date matches
+// and returns ErrInvalidLot otherwise.
+func CreateLot(db *sql.DB, tables Tables, lot Lot) (Lot, error) {
+	if lot.LotNumber == "" || lot.Quantity <= 0 || !validLotDate(lot.ExpiryDate) {
+		return Lot{}, ErrInvalidLot
+	}
+	if lot.OutletID == 0 {
+		lot.OutletID = DefaultOutletID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Lot{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var productID int
+	lockQuery := fmt.Sprintf("SELECT id FROM %s WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", tables.Product)
+	if err := tx.QueryRow(lockQuery, lot.ProductID).Scan(&productID); err != nil {
+		if err == sql.ErrNoRows {
+			return Lot{}, ErrProductNotFound
+		}
+		return Lot{}, fmt.Errorf("failed to query product: %w", translateError(err))
+	}
+	if lot.VariantID != 0 {
+		variantQuery := fmt.Sprintf("SELECT id FROM %s WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL FOR UPDATE", tables.ProductVariant)
+		if err := tx.QueryRow(variantQuery, lot.VariantID, lot.ProductID).Scan(&productID); err != nil {
+			if err == sql.ErrNoRows {
+				return Lot{}, ErrVariantNotFound
+			}
+			return Lot{}, fmt.Errorf("failed to query variant: %w", translateError(err))
+		}
+	}
+	if err := checkOutlet(tx, tables.Outlet, lot.OutletID); err != nil {
+		return Lot{}, err
+	}
+
+	quantity, err := changeOutletStock(tx, tables.OutletStock, lot.OutletID, lot.ProductID, lot.VariantID, 0)
+	if err != nil {
+		return Lot{}, err
+	}
+	var inLots int
+	lotsQuery := fmt.Sprintf("SELECT COALESCE(SUM(quantity), 0) FROM %s WHERE outlet_id = $1 AND product_id = $2 AND variant_id = $3", tables.Lot)
+	if err := tx.QueryRow(lotsQuery, lot.OutletID, lot.ProductID, lot.VariantID).Scan(&inLots); err != nil {
+		return Lot{}, fmt.Errorf("failed to query lots: %w", translateError(err))
+	}
+	if lot.Quantity > quantity-inLots {
+		return Lot{}, &StockError{ProductID: lot.ProductID, VariantID: lot.VariantID, OutletID: lot.OutletID, Requested: lot.Quantity, Available: quantity - inLots}
+	}
+
+	created, err := addLot(tx, tables.Lot, lot)
+	if err != nil {
+		return Lot{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Lot{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return created, nil
+}
+
+// addLot adds lot.Quantity to a lot, creating it if needed. A lot number that
+// exists with another expiry date returns ErrInvalidLot.
+func addLot(tx *sql.Tx, lotTable string, lot Lot) (Lot, error) {
+	var added Lot
+	query := fmt.Sprintf("INSERT INTO %s AS l (outlet_id, product_id, variant_id, lot_number, expiry_date, quantity) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (outlet_id, product_id, variant_id, lot_number) DO UPDATE SET quantity = l.quantity + EXCLUDED.quantity WHERE l.expiry_date = EXCLUDED.expiry_date RETURNING %s", lotTable, lotColumns)
+	err := tx.QueryRow(query, lot.OutletID, lot.ProductID, lot.VariantID, lot.LotNumber, lot.ExpiryDate, lot.Quantity).Scan(added.scanFields()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Lot{}, ErrInvalidLot
+		}
+		return Lot{}, fmt.Errorf("failed to add lot: %w", translateError(err))
+	}
+	return added, nil
+}
+
+// takeLots takes quantity of a product, or of its variant when variantID is
+// set, out of its lots at an outlet, first-expired-first-out, and returns the
+// quantities taken per lot. What the lots cannot cover comes from stock
+// outside lots. The caller must hold the lock of the product or variant row
+// and take the same quantity from the outlet's stock.
+func takeLots(tx *sql.Tx, lotTable string, outletID, productID, variantID, quantity int) ([]LotUsage, error) {
+	return drawLots(tx, lotTable, outletID, productID, variantID, quantity, false)
+}
+
+// sellLots is takeLots for a sale, which must not hand out expired goods:
+// lots past their expiry date are skipped. remaining is the outlet's stock
+// after the sale; when it is less than the stock held in expired lots, the
+// sale needs expired stock and returns a *StockError.
+func sellLots(tx *sql.Tx, lotTable string, outletID, productID, variantID, quantity, remaining int) ([]LotUsage, error) {
+	var expired int
+	query := fmt.Sprintf("SELECT COALESCE(SUM(quantity), 0) FROM %s WHERE outlet_id = $1 AND product_id = $2 AND variant_id = $3 AND expiry_date < CURRENT_DATE", lotTable)
+	if err := tx.QueryRow(query, outletID, productID, variantID).Scan(&expired); err != nil {
+		return nil, fmt.Errorf("failed to query expired lots: %w", translateError(err))
+	}
+	if remaining < expired {
+		return nil, &StockError{ProductID: productID, VariantID: variantID, OutletID: outletID, Requested: quantity, Available: remaining + quantity - expired}
+	}
+	return drawLots(tx, lotTable, outletID, productID, variantID, quantity, true)
+}
+
+// drawLots implements takeLots and sellLots
+func drawLots(tx *sql.Tx, lotTable string, outletID, productID, variantID, quantity int, skipExpired bool) ([]LotUsage, error) {
+	query := fmt.Sprintf("SELECT id, lot_number, to_char(expiry_date, 'YYYY-MM-DD'), quantity FROM %s WHERE outlet_id = $1 AND product_id = $2 AND variant_id = $3 AND quantity > 0 AND (NOT $4 OR expiry_date >= CURRENT_DATE) ORDER BY expiry_date, id FOR UPDATE", lotTable)
+	rows, err := tx.Query(query, outletID, productID, variantID, skipExpired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lots: %w", translateError(err))
+	}
+
+	var usages []LotUsage
+	for rows.Next() && quantity > 0 {
+		var u LotUsage
+		if err := rows.Scan(&u.LotID, &u.LotNumber, &u.ExpiryDate, &u.Quantity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan lot: %w", err)
+		}
+		if u.Quantity > quantity {
+			u.Quantity = quantity
+		}
+		quantity -= u.Quantity
+		usages = append(usages, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating lots: %w", translateError(err))
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE %s SET quantity = quantity - $1 WHERE id = $2", lotTable)
+	for _, u := range usages {
+		if _, err := tx.Exec(updateQuery, u.Quantity, u.LotID); err != nil {
+			return nil, fmt.Errorf("failed to update lot: %w", translateError(err))
+		}
+	}
+	return usages, nil
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLotsFirstExpiredFirstOut(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	milk, err := CreateProduct(db, TestTables, Product{Name: "Susu UHT", Price: 6000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	late, err := CreateLot(db, TestTables, Lot{ProductID: milk.ID, LotNumber: "B-0301", ExpiryDate: "2099-03-01", Quantity: 3})
+	if err != nil {
+		t.Fatalf("CreateLot failed: %v", err)
+	}
+	early, err := CreateLot(db, TestTables, Lot{ProductID: milk.ID, LotNumber: "B-0115", ExpiryDate: "2099-01-15", Quantity: 4})
+	if err != nil {
+		t.Fatalf("CreateLot failed: %v", err)
+	}
+	if early.OutletID != DefaultOutletID || early.Quantity != 4 {
+		t.Errorf("Unexpected lot: %+v", early)
+	}
+
+	// Only the 3 units outside lots can be assigned
+	_, err = CreateLot(db, TestTables, Lot{ProductID: milk.ID, LotNumber: "B-0401", ExpiryDate: "2099-04-01", Quantity: 4})
+	if stockErr, ok := err.(*StockError); !ok || stockErr.Available != 3 {
+		t.Errorf("Expected *StockError with 3 available, got %v", err)
+	}
+	if _, err := CreateLot(db, TestTables, Lot{ProductID: milk.ID, LotNumber: "B-0301", ExpiryDate: "2099-05-01", Quantity: 1}); err != ErrInvalidLot {
+		t.Errorf("Expected ErrInvalidLot for a lot number with another expiry date, got %v", err)
+	}
+
+	transaction, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: milk.ID, Quantity: 5}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	lots := transaction.Details[0].Lots
+	if len(lots) != 2 || lots[0].LotID != early.ID || lots[0].Quantity != 4 || lots[1].LotID != late.ID || lots[1].Quantity != 1 {
+		t.Errorf("Expected 4 from the early lot and 1 from the late lot, got %+v", lots)
+	}
+
+	remaining, err := GetLots(db, TestTables, milk.ID)
+	if err != nil {
+		t.Fatalf("GetLots failed: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].ID != late.ID || remaining[0].Quantity != 2 {
+		t.Errorf("Expected only the late lot with 2 left, got %+v", remaining)
+	}
+
+	expiring, err := GetExpiringLots(db, TestTables, time.Date(2099, 2, 28, 0, 0, 0, 0, time.UTC), 0)
+	if err != nil {
+		t.Fatalf("GetExpiringLots failed: %v", err)
+	}
+	if len(expiring) != 0 {
+		t.Errorf("Expected no lots expiring before the late lot, got %+v", expiring)
+	}
+	expiring, err = GetExpiringLots(db, TestTables, time.Date(2099, 3, 1, 0, 0, 0, 0, time.UTC), 0)
+	if err != nil {
+		t.Fatalf("GetExpiringLots failed: %v", err)
+	}
+	if len(expiring) != 1 || expiring[0].ProductName != "Susu UHT" {
+		t.Errorf("Expected the late lot to be expiring, got %+v", expiring)
+	}
+
+	// Lowering the stock empties the lots before the stock outside lots
+	if _, err := UpdateProduct(db, TestTables, Product{ID: milk.ID, Name: milk.Name, Price: milk.Price, Stock: 2}, 0); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+	remaining, err = GetLots(db, TestTables, milk.ID)
+	if err != nil {
+		t.Fatalf("GetLots failed: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("Expected no lots left, got %+v", remaining)
+	}
+}
+
+func TestTransferLots(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	warehouse, err := CreateOutlet(db, "outlet_test", Outlet{Name: "Gudang Belakang"})
+	if err != nil {
+		t.Fatalf("CreateOutlet failed: %v", err)
+	}
+	yogurt, err := CreateProduct(db, TestTables, Product{Name: "Yogurt", Price: 9000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := CreateLot(db, TestTables, Lot{ProductID: yogurt.ID, LotNumber: "Y-01", ExpiryDate: "2099-01-10", Quantity: 3}); err != nil {
+		t.Fatalf("CreateLot failed: %v", err)
+	}
+	if _, err := CreateLot(db, TestTables, Lot{ProductID: yogurt.ID, LotNumber: "Y-02", ExpiryDate: "2099-02-10", Quantity: 4}); err != nil {
+		t.Fatalf("CreateLot failed: %v", err)
+	}
+
+	transfer, err := CreateStockTransfer(db, TestTables, StockTransfer{FromOutletID: DefaultOutletID, ToOutletID: warehouse.ID, Lines: []StockTransferLine{{ProductID: yogurt.ID, Quantity: 6}}})
+	if err != nil {
+		t.Fatalf("CreateStockTransfer failed: %v", err)
+	}
+	if _, err := ShipStockTransfer(db, TestTables, transfer.ID); err != nil {
+		t.Fatalf("ShipStockTransfer failed: %v", err)
+	}
+	// 3 from Y-01 and 3 from Y-02 were shipped; one unit goes missing
+	if _, err := ReceiveStockTransfer(db, TestTables, transfer.ID, []TransferReceiptLine{{ProductID: yogurt.ID, Quantity: 5}}); err != nil {
+		t.Fatalf("ReceiveStockTransfer failed: %v", err)
+	}
+
+	lots, err := GetLots(db, TestTables, yogurt.ID)
+	if err != nil {
+		t.Fatalf("GetLots failed: %v", err)
+	}
+	received := map[string]Lot{}
+	for _, lot := range lots {
+		if lot.OutletID == warehouse.ID {
+			received[lot.LotNumber] = lot
+		}
+	}
+	if len(received) != 2 || received["Y-01"].Quantity != 3 || received["Y-01"].ExpiryDate != "2099-01-10" || received["Y-02"].Quantity != 2 {
+		t.Errorf("Expected Y-01 with 3 and Y-02 with 2 at the warehouse, got %+v", received)
+	}
+}
+
+func TestCheckoutSkipsExpiredLots(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	bread, err := CreateProduct(db, TestTables, Product{Name: "Roti Tawar", Price: 15000, Stock: 6})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	expired, err := CreateLot(db, TestTables, Lot{ProductID: bread.ID, LotNumber: "R-OLD", ExpiryDate: "2020-01-01", Quantity: 2})
+	if err != nil {
+		t.Fatalf("CreateLot failed: %v", err)
+	}
+	fresh, err := CreateLot(db, TestTables, Lot{ProductID: bread.ID, LotNumber: "R-NEW", ExpiryDate: "2099-06-01", Quantity: 2})
+	if err != nil {
+		t.Fatalf("CreateLot failed: %v", err)
+	}
+
+	// 2 from the fresh lot and 1 from outside lots; the expired lot is left alone
+	transaction, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: bread.ID, Quantity: 3}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	lots := transaction.Details[0].Lots
+	if len(lots) != 1 || lots[0].LotID != fresh.ID || lots[0].Quantity != 2 {
+		t.Errorf("Expected 2 from the fresh lot only, got %+v", lots)
+	}
+
+	// Only 1 of the 3 left is not expired
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: bread.ID, Quantity: 2}}, nil)
+	if stockErr, ok := err.(*StockError); !ok || stockErr.Available != 1 {
+		t.Errorf("Expected *StockError with 1 available, got %v", err)
+	}
+
+	remaining, err := GetLots(db, TestTables, bread.ID)
+	if err != nil {
+		t.Fatalf("GetLots failed: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].ID != expired.ID || remaining[0].Quantity != 2 {
+		t.Errorf("Expected only the expired lot with 2 left, got %+v", remaining)
+	}
+}
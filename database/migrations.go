@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
 // Migrate creates the category table if it does not exist
@@ -11,8 +12,13 @@ func Migrate(db *sql.DB) error {
 	CREATE TABLE IF NOT EXISTS category (
 		id SERIAL PRIMARY KEY,
 		name VARCHAR(255) NOT NULL,
-		description TEXT
+		description TEXT,
+		parent_id INTEGER REFERENCES category(id)
 	);
+	ALTER TABLE category ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES category(id);
+	ALTER TABLE category ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	ALTER TABLE category ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE category ADD COLUMN IF NOT EXISTS search_doc TSVECTOR GENERATED ALWAYS AS (setweight(to_tsvector('simple', name), 'B') || setweight(to_tsvector('simple', COALESCE(description, '')), 'C')) STORED;
 	`
 
 	_, err := db.Exec(createTableSQL)
@@ -24,6 +30,7 @@ func Migrate(db *sql.DB) error {
 	createIndexSQL := `
 	CREATE INDEX IF NOT EXISTS idx_category_id ON category(id);
 	CREATE INDEX IF NOT EXISTS idx_category_name ON category(name);
+	CREATE INDEX IF NOT EXISTS idx_category_parent_id ON category(parent_id);
 	`
 
 	_, err = db.Exec(createIndexSQL)
@@ -38,7 +45,9 @@ func Migrate(db *sql.DB) error {
 		name VARCHAR(255) NOT NULL,
 		price INTEGER NOT NULL DEFAULT 0,
 		stock INTEGER NOT NULL DEFAULT 0,
-		category_id INTEGER REFERENCES category(id)
+		category_id INTEGER REFERENCES category(id),
+		sku VARCHAR(64),
+		barcode VARCHAR(32)
 	);
 	`
 
@@ -47,10 +56,40 @@ func Migrate(db *sql.DB) error {
 		return fmt.Errorf("failed to create product table: %w", err)
 	}
 
+	alterProductSQL := `
+	ALTER TABLE product ADD COLUMN IF NOT EXISTS sku VARCHAR(64);
+	ALTER TABLE product ADD COLUMN IF NOT EXISTS barcode VARCHAR(32);
+	ALTER TABLE product ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	ALTER TABLE product ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE product ADD COLUMN IF NOT EXISTS reorder_point INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE product ADD COLUMN IF NOT EXISTS reorder_qty INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE product ADD COLUMN IF NOT EXISTS search_doc TSVECTOR GENERATED ALWAYS AS (setweight(to_tsvector('simple', name), 'A')) STORED;
+	`
+
+	_, err = db.Exec(alterProductSQL)
+	if err != nil {
+		return fmt.Errorf("failed to alter product table: %w", err)
+	}
+
+	// pg_trgm provides trigram similarity for fuzzy product search
+	_, err = db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm")
+	if err != nil {
+		return fmt.Errorf("failed to create pg_trgm extension: %w", err)
+	}
+
 	// Create product indexes
 	createProductIndexSQL := `
 	CREATE INDEX IF NOT EXISTS idx_product_id ON product(id);
 	CREATE INDEX IF NOT EXISTS idx_product_name ON product(name);
+	CREATE INDEX IF NOT EXISTS idx_product_category_id ON product(category_id);
+	CREATE INDEX IF NOT EXISTS idx_product_price_id ON product(price, id);
+	CREATE INDEX IF NOT EXISTS idx_product_stock_id ON product(stock, id);
+	CREATE INDEX IF NOT EXISTS idx_product_name_trgm ON product USING GIN (name gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS idx_product_search_doc ON product USING GIN (search_doc);
+	CREATE INDEX IF NOT EXISTS idx_category_name_trgm ON category USING GIN (name gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS idx_category_search_doc ON category USING GIN (search_doc);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_product_sku ON product(sku) WHERE sku IS NOT NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_product_barcode ON product(barcode) WHERE barcode IS NOT NULL;
 	`
 
 	_, err = db.Exec(createProductIndexSQL)
@@ -58,6 +97,11 @@ func Migrate(db *sql.DB) error {
 		return fmt.Errorf("failed to create product indexes: %w", err)
 	}
 
+	// Create product_variant table
+	if err := createProductVariantTable(db, "product_variant", "product"); err != nil {
+		return err
+	}
+
 	// Create transaction table
 	createTransactionSQL := `
 	CREATE TABLE IF NOT EXISTS "transaction" (
@@ -95,6 +139,9 @@ func Migrate(db *sql.DB) error {
 	ALTER TABLE transaction_detail DROP CONSTRAINT IF EXISTS transaction_detail_product_id_fkey;
 	ALTER TABLE transaction_detail ADD COLUMN IF NOT EXISTS product_description TEXT NOT NULL DEFAULT '';
 	ALTER TABLE transaction_detail ADD COLUMN IF NOT EXISTS unit_price INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transaction_detail ADD COLUMN IF NOT EXISTS variant_id INTEGER;
+	ALTER TABLE transaction_detail ADD COLUMN IF NOT EXISTS variant_name VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE transaction_detail ADD COLUMN IF NOT EXISTS category_id INTEGER;
 	`
 
 	_, err = db.Exec(alterTransactionDetailSQL)
@@ -118,6 +165,66 @@ func Migrate(db *sql.DB) error {
 		return fmt.Errorf("failed to create transaction indexes: %w", err)
 	}
 
+	// Create inventory_movement table
+	if err := createInventoryMovementTable(db, "inventory_movement", "product"); err != nil {
+		return err
+	}
+
+	// Create stock_adjustment table
+	if err := createStockAdjustmentTable(db, "stock_adjustment", "product"); err != nil {
+		return err
+	}
+
+	// Create supplier, purchase_order and purchase_order_line tables
+	if err := createPurchaseOrderTables(db, "supplier", "purchase_order", "purchase_order_line", "product"); err != nil {
+		return err
+	}
+
+	// Create outlet and outlet_stock tables
+	if err := createOutletTables(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Create stock_transfer and stock_transfer_line tables
+	if err := createStockTransferTables(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Create stock_take and stock_take_line tables
+	if err := createStockTakeTables(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Create product_lot, transaction_detail_lot and stock_transfer_line_lot tables
+	if err := createLotTables(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Create checkout_idempotency_key table
+	if err := createIdempotencyKeyTable(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Create transaction_payment table
+	if err := createPaymentTable(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Create transaction_return and transaction_return_line tables
+	if err := createReturnTables(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Add void columns to transaction table
+	if err := createVoidColumns(db, DefaultTables); err != nil {
+		return err
+	}
+
+	// Create shift table
+	if err := createShiftTable(db, DefaultTables); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -127,8 +234,13 @@ func MigrateTest(db *sql.DB) error {
 	CREATE TABLE IF NOT EXISTS category_test (
 		id SERIAL PRIMARY KEY,
 		name VARCHAR(255) NOT NULL,
-		description TEXT
+		description TEXT,
+		parent_id INTEGER REFERENCES category_test(id)
 	);
+	ALTER TABLE category_test ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES category_test(id);
+	ALTER TABLE category_test ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	ALTER TABLE category_test ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE category_test ADD COLUMN IF NOT EXISTS search_doc TSVECTOR GENERATED ALWAYS AS (setweight(to_tsvector('simple', name), 'B') || setweight(to_tsvector('simple', COALESCE(description, '')), 'C')) STORED;
 	`
 
 	_, err := db.Exec(createTableSQL)
@@ -140,6 +252,7 @@ func MigrateTest(db *sql.DB) error {
 	createIndexSQL := `
 	CREATE INDEX IF NOT EXISTS idx_category_test_id ON category_test(id);
 	CREATE INDEX IF NOT EXISTS idx_category_test_name ON category_test(name);
+	CREATE INDEX IF NOT EXISTS idx_category_test_parent_id ON category_test(parent_id);
 	`
 
 	_, err = db.Exec(createIndexSQL)
@@ -154,7 +267,9 @@ func MigrateTest(db *sql.DB) error {
 		name VARCHAR(255) NOT NULL,
 		price INTEGER NOT NULL DEFAULT 0,
 		stock INTEGER NOT NULL DEFAULT 0,
-		category_id INTEGER
+		category_id INTEGER,
+		sku VARCHAR(64),
+		barcode VARCHAR(32)
 	);
 	`
 
@@ -163,10 +278,39 @@ func MigrateTest(db *sql.DB) error {
 		return fmt.Errorf("failed to create product_test table: %w", err)
 	}
 
+	alterProductTestSQL := `
+	ALTER TABLE product_test ADD COLUMN IF NOT EXISTS sku VARCHAR(64);
+	ALTER TABLE product_test ADD COLUMN IF NOT EXISTS barcode VARCHAR(32);
+	ALTER TABLE product_test ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	ALTER TABLE product_test ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE product_test ADD COLUMN IF NOT EXISTS reorder_point INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE product_test ADD COLUMN IF NOT EXISTS reorder_qty INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE product_test ADD COLUMN IF NOT EXISTS search_doc TSVECTOR GENERATED ALWAYS AS (setweight(to_tsvector('simple', name), 'A')) STORED;
+	`
+
+	_, err = db.Exec(alterProductTestSQL)
+	if err != nil {
+		return fmt.Errorf("failed to alter product_test table: %w", err)
+	}
+
+	_, err = db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm")
+	if err != nil {
+		return fmt.Errorf("failed to create pg_trgm extension: %w", err)
+	}
+
 	// Create product_test indexes
 	createProductIndexSQL := `
 	CREATE INDEX IF NOT EXISTS idx_product_test_id ON product_test(id);
 	CREATE INDEX IF NOT EXISTS idx_product_test_name ON product_test(name);
+	CREATE INDEX IF NOT EXISTS idx_product_test_category_id ON product_test(category_id);
+	CREATE INDEX IF NOT EXISTS idx_product_test_price_id ON product_test(price, id);
+	CREATE INDEX IF NOT EXISTS idx_product_test_stock_id ON product_test(stock, id);
+	CREATE INDEX IF NOT EXISTS idx_product_test_name_trgm ON product_test USING GIN (name gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS idx_product_test_search_doc ON product_test USING GIN (search_doc);
+	CREATE INDEX IF NOT EXISTS idx_category_test_name_trgm ON category_test USING GIN (name gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS idx_category_test_search_doc ON category_test USING GIN (search_doc);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_product_test_sku ON product_test(sku) WHERE sku IS NOT NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_product_test_barcode ON product_test(barcode) WHERE barcode IS NOT NULL;
 	`
 
 	_, err = db.Exec(createProductIndexSQL)
@@ -174,6 +318,11 @@ func MigrateTest(db *sql.DB) error {
 		return fmt.Errorf("failed to create product_test indexes: %w", err)
 	}
 
+	// Create product_variant_test table
+	if err := createProductVariantTable(db, "product_variant_test", "product_test"); err != nil {
+		return err
+	}
+
 	// Create transaction_test table
 	createTransactionTestSQL := `
 	CREATE TABLE IF NOT EXISTS transaction_test (
@@ -211,6 +360,9 @@ func MigrateTest(db *sql.DB) error {
 	ALTER TABLE transaction_detail_test DROP CONSTRAINT IF EXISTS transaction_detail_test_product_id_fkey;
 	ALTER TABLE transaction_detail_test ADD COLUMN IF NOT EXISTS product_description TEXT NOT NULL DEFAULT '';
 	ALTER TABLE transaction_detail_test ADD COLUMN IF NOT EXISTS unit_price INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transaction_detail_test ADD COLUMN IF NOT EXISTS variant_id INTEGER;
+	ALTER TABLE transaction_detail_test ADD COLUMN IF NOT EXISTS variant_name VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE transaction_detail_test ADD COLUMN IF NOT EXISTS category_id INTEGER;
 	`
 
 	_, err = db.Exec(alterTransactionDetailTestSQL)
@@ -234,14 +386,504 @@ func MigrateTest(db *sql.DB) error {
 		return fmt.Errorf("failed to create transaction_test indexes: %w", err)
 	}
 
+	// Create inventory_movement_test table
+	if err := createInventoryMovementTable(db, "inventory_movement_test", "product_test"); err != nil {
+		return err
+	}
+
+	// Create stock_adjustment_test table
+	if err := createStockAdjustmentTable(db, "stock_adjustment_test", "product_test"); err != nil {
+		return err
+	}
+
+	// Create supplier_test, purchase_order_test and purchase_order_line_test tables
+	if err := createPurchaseOrderTables(db, "supplier_test", "purchase_order_test", "purchase_order_line_test", "product_test"); err != nil {
+		return err
+	}
+
+	// Create outlet_test and outlet_stock_test tables
+	if err := createOutletTables(db, TestTables); err != nil {
+		return err
+	}
+
+	// Create stock_transfer_test and stock_transfer_line_test tables
+	if err := createStockTransferTables(db, TestTables); err != nil {
+		return err
+	}
+
+	// Create stock_take_test and stock_take_line_test tables
+	if err := createStockTakeTables(db, TestTables); err != nil {
+		return err
+	}
+
+	// Create product_lot_test, transaction_detail_lot_test and stock_transfer_line_lot_test tables
+	if err := createLotTables(db, TestTables); err != nil {
+		return err
+	}
+
+	// Create checkout_idempotency_key_test table
+	if err := createIdempotencyKeyTable(db, TestTables); err != nil {
+		return err
+	}
+
+	// Create transaction_payment_test table
+	if err := createPaymentTable(db, TestTables); err != nil {
+		return err
+	}
+
+	// Create transaction_return_test and transaction_return_line_test tables
+	if err := createReturnTables(db, TestTables); err != nil {
+		return err
+	}
+
+	// Add void columns to transaction_test table
+	if err := createVoidColumns(db, TestTables); err != nil {
+		return err
+	}
+
+	// Create shift_test table
+	if err := createShiftTable(db, TestTables); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // DropTestTable drops the category_test table (for cleanup in tests)
 func DropTestTable(db *sql.DB) error {
-	_, err := db.Exec("DROP TABLE IF EXISTS transaction_detail_test; DROP TABLE IF EXISTS transaction_test; DROP TABLE IF EXISTS product_test; DROP TABLE IF EXISTS category_test;")
+	_, err := db.Exec("DROP TABLE IF EXISTS shift_test; DROP TABLE IF EXISTS transaction_return_line_test; DROP TABLE IF EXISTS transaction_return_test; DROP TABLE IF EXISTS transaction_payment_test; DROP TABLE IF EXISTS checkout_idempotency_key_test; DROP TABLE IF EXISTS stock_transfer_line_lot_test; DROP TABLE IF EXISTS transaction_detail_lot_test; DROP TABLE IF EXISTS product_lot_test; DROP TABLE IF EXISTS stock_take_line_test; DROP TABLE IF EXISTS stock_take_test; DROP TABLE IF EXISTS stock_transfer_line_test; DROP TABLE IF EXISTS stock_transfer_test; DROP TABLE IF EXISTS purchase_order_line_test; DROP TABLE IF EXISTS purchase_order_test; DROP TABLE IF EXISTS supplier_test; DROP TABLE IF EXISTS outlet_stock_test; DROP TABLE IF EXISTS stock_adjustment_test; DROP TABLE IF EXISTS inventory_movement_test; DROP TABLE IF EXISTS transaction_detail_test; DROP TABLE IF EXISTS transaction_test; DROP TABLE IF EXISTS outlet_test; DROP TABLE IF EXISTS product_variant_test; DROP TABLE IF EXISTS product_test; DROP TABLE IF EXISTS category_test;")
 	if err != nil {
 		return fmt.Errorf("failed to drop category_test table: %w", err)
 	}
 	return nil
 }
+
+// createProductVariantTable creates a product variant table referencing
+// productTable. Deleted variants are kept with deleted_at set so the sales
+// that refer to them stay valid.
+func createProductVariantTable(db *sql.DB, variantTable, productTable string) error {
+	createVariantSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		product_id INTEGER NOT NULL REFERENCES %[2]s(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL,
+		attributes JSONB NOT NULL DEFAULT '{}',
+		price INTEGER NOT NULL DEFAULT 0,
+		stock INTEGER NOT NULL DEFAULT 0,
+		barcode VARCHAR(32)
+	);
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_product_id ON %[1]s(product_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_%[1]s_barcode ON %[1]s(barcode) WHERE barcode IS NOT NULL;
+	`, variantTable, productTable)
+
+	_, err := db.Exec(createVariantSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", variantTable, err)
+	}
+	return createBarcodeTriggers(db, productTable, variantTable)
+}
+
+// createBarcodeTriggers makes product and variant barcodes share one unique
+// namespace: a barcode written to either table that the other table already
+// holds fails with unique_violation. Writers of the same barcode are
+// serialized with an advisory lock. Existing barcodes held by both tables
+// fail the migration, since lookups and checkout could not tell them apart.
+func createBarcodeTriggers(db *sql.DB, productTable, variantTable string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT p.barcode FROM %s p JOIN %s v ON v.barcode = p.barcode ORDER BY p.barcode", productTable, variantTable))
+	if err != nil {
+		return fmt.Errorf("failed to check barcodes: %w", err)
+	}
+	defer rows.Close()
+	var duplicates []string
+	for rows.Next() {
+		var barcode string
+		if err := rows.Scan(&barcode); err != nil {
+			return fmt.Errorf("failed to scan barcode: %w", err)
+		}
+		duplicates = append(duplicates, barcode)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating barcodes: %w", err)
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("barcodes used by both a product in %s and a variant in %s: %s", productTable, variantTable, strings.Join(duplicates, ", "))
+	}
+
+	for _, t := range [][2]string{{productTable, variantTable}, {variantTable, productTable}} {
+		createTriggerSQL := fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION %[1]s_check_barcode() RETURNS trigger AS $$
+		BEGIN
+			IF NEW.barcode IS NOT NULL THEN
+				PERFORM pg_advisory_xact_lock(hashtext(NEW.barcode));
+				IF EXISTS (SELECT 1 FROM %[2]s WHERE barcode = NEW.barcode) THEN
+					RAISE EXCEPTION 'barcode %% already in use', NEW.barcode USING ERRCODE = 'unique_violation';
+				END IF;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS %[1]s_check_barcode ON %[1]s;
+		CREATE TRIGGER %[1]s_check_barcode BEFORE INSERT OR UPDATE OF barcode ON %[1]s
+			FOR EACH ROW EXECUTE FUNCTION %[1]s_check_barcode();
+		`, t[0], t[1])
+		if _, err := db.Exec(createTriggerSQL); err != nil {
+			return fmt.Errorf("failed to create %s barcode trigger: %w", t[0], err)
+		}
+	}
+	return nil
+}
+
+// createInventoryMovementTable creates a stock ledger table referencing productTable.
+// variant_id has no foreign key so movements outlive deleted variants.
+func createInventoryMovementTable(db *sql.DB, movementTable, productTable string) error {
+	createMovementSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		product_id INTEGER NOT NULL REFERENCES %[2]s(id),
+		variant_id INTEGER,
+		delta INTEGER NOT NULL,
+		balance INTEGER NOT NULL,
+		reason VARCHAR(32) NOT NULL,
+		reference_id INTEGER,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_product_id_id ON %[1]s(product_id, id);
+	`, movementTable, productTable)
+
+	_, err := db.Exec(createMovementSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", movementTable, err)
+	}
+	return nil
+}
+
+// createStockAdjustmentTable creates a stock adjustment table referencing productTable
+func createStockAdjustmentTable(db *sql.DB, adjustmentTable, productTable string) error {
+	createAdjustmentSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		product_id INTEGER NOT NULL REFERENCES %[2]s(id),
+		variant_id INTEGER,
+		delta INTEGER NOT NULL,
+		reason VARCHAR(32) NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_product_id ON %[1]s(product_id);
+	`, adjustmentTable, productTable)
+
+	_, err := db.Exec(createAdjustmentSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", adjustmentTable, err)
+	}
+	return nil
+}
+
+// createPurchaseOrderTables creates the supplier, purchase order and purchase
+// order line tables. Lines reference productTable.
+func createPurchaseOrderTables(db *sql.DB, supplierTable, orderTable, lineTable, productTable string) error {
+	createPurchaseOrderSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		phone VARCHAR(32) NOT NULL DEFAULT '',
+		email VARCHAR(255) NOT NULL DEFAULT ''
+	);
+	CREATE TABLE IF NOT EXISTS %[2]s (
+		id SERIAL PRIMARY KEY,
+		supplier_id INTEGER NOT NULL REFERENCES %[1]s(id),
+		status VARCHAR(32) NOT NULL DEFAULT 'draft',
+		note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS %[3]s (
+		id SERIAL PRIMARY KEY,
+		purchase_order_id INTEGER NOT NULL REFERENCES %[2]s(id) ON DELETE CASCADE,
+		product_id INTEGER NOT NULL REFERENCES %[4]s(id),
+		quantity INTEGER NOT NULL,
+		received_quantity INTEGER NOT NULL DEFAULT 0,
+		unit_cost INTEGER NOT NULL DEFAULT 0,
+		UNIQUE (purchase_order_id, product_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[2]s_supplier_id ON %[2]s(supplier_id);
+	CREATE INDEX IF NOT EXISTS idx_%[2]s_status ON %[2]s(status);
+	`, supplierTable, orderTable, lineTable, productTable)
+
+	_, err := db.Exec(createPurchaseOrderSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s tables: %w", orderTable, err)
+	}
+	return nil
+}
+
+// createOutletTables creates the outlet and outlet stock tables, seeds the
+// default outlet and moves existing stock to it. Transactions, inventory
+// movements and stock adjustments gain an outlet_id defaulting to it.
+// Product-level stock is stored with variant_id 0. The outlet sequence is only
+// moved past the seeded outlet when it is inserted, and stock is only moved
+// while the outlet stock table is still empty, so later startups leave both
+// alone.
+func createOutletTables(db *sql.DB, tables Tables) error {
+	createOutletSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		address TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	WITH seeded AS (
+		INSERT INTO %[1]s (id, name) VALUES (%[8]d, 'Main') ON CONFLICT DO NOTHING RETURNING id
+	)
+	SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), GREATEST(s.id, (SELECT COALESCE(MAX(id), 0) FROM %[1]s))) FROM seeded s;
+	CREATE TABLE IF NOT EXISTS %[2]s (
+		outlet_id INTEGER NOT NULL REFERENCES %[1]s(id),
+		product_id INTEGER NOT NULL REFERENCES %[3]s(id) ON DELETE CASCADE,
+		variant_id INTEGER NOT NULL DEFAULT 0,
+		quantity INTEGER NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+		PRIMARY KEY (outlet_id, product_id, variant_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[2]s_product_id ON %[2]s(product_id, variant_id);
+	INSERT INTO %[2]s (outlet_id, product_id, variant_id, quantity)
+		SELECT %[8]d, p.id, 0, p.stock FROM %[3]s p
+		WHERE NOT EXISTS (SELECT 1 FROM %[2]s)
+		UNION ALL
+		SELECT %[8]d, v.product_id, v.id, v.stock FROM %[4]s v
+		WHERE NOT EXISTS (SELECT 1 FROM %[2]s);
+	ALTER TABLE %[5]s ADD COLUMN IF NOT EXISTS outlet_id INTEGER NOT NULL DEFAULT %[8]d REFERENCES %[1]s(id);
+	ALTER TABLE %[6]s ADD COLUMN IF NOT EXISTS outlet_id INTEGER NOT NULL DEFAULT %[8]d REFERENCES %[1]s(id);
+	ALTER TABLE %[7]s ADD COLUMN IF NOT EXISTS outlet_id INTEGER NOT NULL DEFAULT %[8]d REFERENCES %[1]s(id);
+	`, tables.Outlet, tables.OutletStock, tables.Product, tables.ProductVariant, tables.Transaction, tables.InventoryMovement, tables.StockAdjustment, DefaultOutletID)
+
+	_, err := db.Exec(createOutletSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s tables: %w", tables.Outlet, err)
+	}
+	return nil
+}
+
+// createStockTransferTables creates the stock transfer and transfer line
+// tables. A transfer moves stock between two different outlets; lines store
+// product-level stock with variant_id 0 like the outlet stock table.
+func createStockTransferTables(db *sql.DB, tables Tables) error {
+	createTransferSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		from_outlet_id INTEGER NOT NULL REFERENCES %[3]s(id),
+		to_outlet_id INTEGER NOT NULL REFERENCES %[3]s(id),
+		status VARCHAR(32) NOT NULL DEFAULT 'draft',
+		note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		shipped_at TIMESTAMPTZ,
+		received_at TIMESTAMPTZ,
+		CHECK (from_outlet_id <> to_outlet_id)
+	);
+	CREATE TABLE IF NOT EXISTS %[2]s (
+		id SERIAL PRIMARY KEY,
+		stock_transfer_id INTEGER NOT NULL REFERENCES %[1]s(id) ON DELETE CASCADE,
+		product_id INTEGER NOT NULL REFERENCES %[4]s(id),
+		variant_id INTEGER NOT NULL DEFAULT 0,
+		quantity INTEGER NOT NULL CHECK (quantity > 0),
+		received_quantity INTEGER CHECK (received_quantity >= 0),
+		UNIQUE (stock_transfer_id, product_id, variant_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_status ON %[1]s(status);
+	`, tables.StockTransfer, tables.TransferLine, tables.Outlet, tables.Product)
+
+	_, err := db.Exec(createTransferSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s tables: %w", tables.StockTransfer, err)
+	}
+	return nil
+}
+
+// createStockTakeTables creates the stock take and stock take line tables.
+// An outlet has at most one open stock take at a time.
+func createStockTakeTables(db *sql.DB, tables Tables) error {
+	createStockTakeSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		outlet_id INTEGER NOT NULL REFERENCES %[3]s(id),
+		status VARCHAR(32) NOT NULL DEFAULT 'open',
+		note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		finalized_at TIMESTAMPTZ
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_%[1]s_open_outlet_id ON %[1]s(outlet_id) WHERE status = 'open';
+	CREATE TABLE IF NOT EXISTS %[2]s (
+		id SERIAL PRIMARY KEY,
+		stock_take_id INTEGER NOT NULL REFERENCES %[1]s(id) ON DELETE CASCADE,
+		product_id INTEGER NOT NULL REFERENCES %[4]s(id),
+		snapshot_quantity INTEGER NOT NULL,
+		expected_quantity INTEGER,
+		counted_quantity INTEGER CHECK (counted_quantity >= 0),
+		counted_at TIMESTAMPTZ,
+		UNIQUE (stock_take_id, product_id)
+	);
+	`, tables.StockTake, tables.StockTakeLine, tables.Outlet, tables.Product)
+
+	_, err := db.Exec(createStockTakeSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s tables: %w", tables.StockTake, err)
+	}
+	return nil
+}
+
+// createLotTables creates the product lot table and the tables of the lots
+// each transaction detail and stock transfer line took its stock from. A lot
+// number is unique per product, variant and outlet.
+func createLotTables(db *sql.DB, tables Tables) error {
+	createLotSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		outlet_id INTEGER NOT NULL REFERENCES %[3]s(id),
+		product_id INTEGER NOT NULL REFERENCES %[4]s(id),
+		variant_id INTEGER NOT NULL DEFAULT 0,
+		lot_number VARCHAR(64) NOT NULL,
+		expiry_date DATE NOT NULL,
+		quantity INTEGER NOT NULL CHECK (quantity >= 0),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (outlet_id, product_id, variant_id, lot_number)
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_expiry_date ON %[1]s(expiry_date) WHERE quantity > 0;
+	CREATE TABLE IF NOT EXISTS %[2]s (
+		transaction_detail_id INTEGER NOT NULL REFERENCES %[5]s(id) ON DELETE CASCADE,
+		lot_id INTEGER NOT NULL REFERENCES %[1]s(id),
+		quantity INTEGER NOT NULL CHECK (quantity > 0),
+		PRIMARY KEY (transaction_detail_id, lot_id)
+	);
+	CREATE TABLE IF NOT EXISTS %[6]s (
+		stock_transfer_line_id INTEGER NOT NULL REFERENCES %[7]s(id) ON DELETE CASCADE,
+		lot_id INTEGER NOT NULL REFERENCES %[1]s(id),
+		quantity INTEGER NOT NULL CHECK (quantity > 0),
+		PRIMARY KEY (stock_transfer_line_id, lot_id)
+	);
+	`, tables.Lot, tables.TransactionLot, tables.Outlet, tables.Product, tables.TransactionDetail, tables.TransferLot, tables.TransferLine)
+
+	_, err := db.Exec(createLotSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s tables: %w", tables.Lot, err)
+	}
+	return nil
+}
+
+// createIdempotencyKeyTable creates the table of checkout idempotency keys.
+// A key is stored with the transaction and response of the checkout made
+// under it when that checkout commits.
+func createIdempotencyKeyTable(db *sql.DB, tables Tables) error {
+	createKeySQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		idempotency_key VARCHAR(255) PRIMARY KEY,
+		request_hash CHAR(64) NOT NULL,
+		transaction_id INTEGER NOT NULL REFERENCES %[2]s(id) ON DELETE CASCADE,
+		response BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	`, tables.IdempotencyKey, tables.Transaction)
+
+	_, err := db.Exec(createKeySQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", tables.IdempotencyKey, err)
+	}
+	return nil
+}
+
+// createPaymentTable creates the payment table and adds the paid and change
+// amounts to the transaction table. Transactions made before payments were
+// recorded keep 0 for both.
+func createPaymentTable(db *sql.DB, tables Tables) error {
+	createPaymentSQL := fmt.Sprintf(`
+	ALTER TABLE %[2]s ADD COLUMN IF NOT EXISTS paid_amount INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE %[2]s ADD COLUMN IF NOT EXISTS change_amount INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		transaction_id INTEGER NOT NULL REFERENCES %[2]s(id) ON DELETE CASCADE,
+		method VARCHAR(32) NOT NULL,
+		amount INTEGER NOT NULL CHECK (amount > 0),
+		change_amount INTEGER NOT NULL DEFAULT 0 CHECK (change_amount >= 0 AND change_amount <= amount),
+		reference VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_transaction_id ON %[1]s(transaction_id);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_created_at ON %[1]s(created_at);
+	`, tables.Payment, tables.Transaction)
+
+	_, err := db.Exec(createPaymentSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", tables.Payment, err)
+	}
+	return nil
+}
+
+// createReturnTables creates the tables of transaction returns and their
+// lines. Each line returns part of a transaction detail at its unit price.
+// credited_amount is the part of a refund taken off the outstanding balance
+// of the transaction instead of paid back.
+func createReturnTables(db *sql.DB, tables Tables) error {
+	createReturnSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		transaction_id INTEGER NOT NULL REFERENCES %[3]s(id) ON DELETE CASCADE,
+		refund_amount INTEGER NOT NULL DEFAULT 0,
+		credited_amount INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_transaction_id ON %[1]s(transaction_id);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_created_at ON %[1]s(created_at);
+	CREATE TABLE IF NOT EXISTS %[2]s (
+		id SERIAL PRIMARY KEY,
+		return_id INTEGER NOT NULL REFERENCES %[1]s(id) ON DELETE CASCADE,
+		transaction_detail_id INTEGER NOT NULL REFERENCES %[4]s(id) ON DELETE CASCADE,
+		unit_price INTEGER NOT NULL,
+		quantity INTEGER NOT NULL CHECK (quantity > 0),
+		subtotal INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[2]s_return_id ON %[2]s(return_id);
+	CREATE INDEX IF NOT EXISTS idx_%[2]s_transaction_detail_id ON %[2]s(transaction_detail_id);
+	`, tables.Return, tables.ReturnLine, tables.Transaction, tables.TransactionDetail)
+
+	_, err := db.Exec(createReturnSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s tables: %w", tables.Return, err)
+	}
+	return nil
+}
+
+// createVoidColumns adds the void details to the transaction table. A
+// transaction is voided once voided_at is set.
+func createVoidColumns(db *sql.DB, tables Tables) error {
+	alterTransactionSQL := fmt.Sprintf(`
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS voided_at TIMESTAMPTZ;
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS voided_by VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS void_reason TEXT NOT NULL DEFAULT '';
+	`, tables.Transaction)
+
+	_, err := db.Exec(alterTransactionSQL)
+	if err != nil {
+		return fmt.Errorf("failed to alter %s table: %w", tables.Transaction, err)
+	}
+	return nil
+}
+
+// createShiftTable creates the shift table. An outlet has at most one open
+// shift at a time.
+func createShiftTable(db *sql.DB, tables Tables) error {
+	createShiftSQL := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		outlet_id INTEGER NOT NULL REFERENCES %[2]s(id),
+		opened_by VARCHAR(255) NOT NULL,
+		opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		closed_by VARCHAR(255) NOT NULL DEFAULT '',
+		closed_at TIMESTAMPTZ
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_%[1]s_open_outlet_id ON %[1]s(outlet_id) WHERE closed_at IS NULL;
+	`, tables.Shift, tables.Outlet)
+
+	_, err := db.Exec(createShiftSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", tables.Shift, err)
+	}
+	return nil
+}
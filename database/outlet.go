@@ -0,0 +1,242 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrOutletNotFound = errors.New("outlet not found")
+
+// DefaultOutletID is the outlet created by the migrations. It holds the stock
+// that existed before outlets were introduced and receives every stock change
+// that does not name an outlet, such as product edits.
+const DefaultOutletID = 1
+
+// Outlet is a location that holds stock, such as a store or a warehouse. The
+// stock of a product at all outlets sums to the product's stock.
+type Outlet struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Address   string    `json:"address" db:"address"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+const outletColumns = "id, name, address, created_at"
+
+// scanFields returns scan destinations matching outletColumns
+func (o *Outlet) scanFields() []interface{} {
+	return []interface{}{&o.ID, &o.Name, &o.Address, &o.CreatedAt}
+}
+
+// OutletStock is the stock of a product at one outlet
+type OutletStock struct {
+	OutletID int `json:"outlet_id" db:"outlet_id"`
+	Quantity int `json:"quantity" db:"quantity"`
+}
+
+// GetOutlets retrieves all outlets ordered by ID
+func GetOutlets(db *sql.DB, tableName string) ([]Outlet, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY id", outletColumns, tableName)
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outlets: %w", err)
+	}
+	defer rows.Close()
+
+	outlets := []Outlet{}
+	for rows.Next() {
+		var o Outlet
+		if err := rows.Scan(o.scanFields()...); err != nil {
+			return nil, fmt.Errorf("failed to scan outlet: %w", err)
+		}
+		outlets = append(outlets, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outlets: %w", err)
+	}
+
+	return outlets, nil
+}
+
+// GetOutletByID retrieves an outlet by ID
+func GetOutletByID(db *sql.DB, tableName string, id int) (Outlet, error) {
+	var o Outlet
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", outletColumns, tableName)
+	err := db.QueryRow(query, id).Scan(o.scanFields()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Outlet{}, ErrOutletNotFound
+		}
+		return Outlet{}, fmt.Errorf("failed to query outlet: %w", err)
+	}
+	return o, nil
+}
+
+// CreateOutlet inserts a new outlet and returns it. Outlet names are unique.
+func CreateOutlet(db *sql.DB, tableName string, o Outlet) (Outlet, error) {
+	var created Outlet
+	query := fmt.Sprintf("INSERT INTO %s (name, address) VALUES ($1, $2) RETURNING %s", tableName, outletColumns)
+	err := db.QueryRow(query, o.Name, o.Address).Scan(created.scanFields()...)
+	if err != nil {
+		return Outlet{}, fmt.Errorf("failed to create outlet: %w", translateError(err))
+	}
+	return created, nil
+}
+
+// UpdateOutlet replaces the name and address of outlet o.ID and returns it
+func UpdateOutlet(db *sql.DB, tableName string, o Outlet) (Outlet, error) {
+	var updated Outlet
+	query := fmt.Sprintf("UPDATE %s SET name = $1, address = $2 WHERE id = $3 RETURNING %s", tableName, outletColumns)
+	err := db.QueryRow(query, o.Name, o.Address, o.ID).Scan(updated.scanFields()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Outlet{}, ErrOutletNotFound
+		}
+		return Outlet{}, fmt.Errorf("failed to update outlet: %w", translateError(err))
+	}
+	return updated, nil
+}
+
+// checkOutlet returns ErrOutletNotFound unless outlet id exists
+func checkOutlet(q rowQuerier, outletTable string, id int) error {
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)", outletTable)
+	if err := q.QueryRow(query, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query outlet: %w", err)
+	}
+	if !exists {
+		return ErrOutletNotFound
+	}
+	return nil
+}
+
+// changeOutletStock adds delta to the stock of a product, or of its variant
+// when variantID is set, at an outlet and returns the outlet's new quantity.
+// The caller must hold the lock of the product or variant row, which also
+// serializes creating the outlet's stock row. A change that would make the
+// outlet's stock negative returns a *StockError.
+func changeOutletStock(tx *sql.Tx, outletStockTable string, outletID, productID, variantID, delta int) (int, error) {
+	var quantity int
+	lockQuery := fmt.Sprintf("SELECT quantity FROM %s WHERE outlet_id = $1 AND product_id = $2 AND variant_id = $3 FOR UPDATE", outletStockTable)
+	err := tx.QueryRow(lockQuery, outletID, productID, variantID).Scan(&quantity)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to query outlet stock: %w", translateError(err))
+	}
+	if delta == 0 {
+		return quantity, nil
+	}
+	if quantity+delta < 0 {
+		return 0, &StockError{ProductID: productID, VariantID: variantID, OutletID: outletID, Requested: -delta, Available: quantity}
+	}
+
+	upsertQuery := fmt.Sprintf("INSERT INTO %s (outlet_id, product_id, variant_id, quantity) VALUES ($1, $2, $3, $4) ON CONFLICT (outlet_id, product_id, variant_id) DO UPDATE SET quantity = EXCLUDED.quantity", outletStockTable)
+	if _, err := tx.Exec(upsertQuery, outletID, productID, variantID, quantity+delta); err != nil {
+		if isForeignKeyViolation(err) {
+			return 0, ErrOutletNotFound
+		}
+		return 0, fmt.Errorf("failed to update outlet stock: %w", translateError(err))
+	}
+	return quantity + delta, nil
+}
+
+// changeStock adds delta to the stock of a product, or of its variant when
+// variantID is set, at an outlet. It locks the product or variant row, keeps
+// its total stock in step and returns the new total. Soft-deleted products
+// are changed as well. A decrease is taken from the outlet's lots
+// first-expired-first-out. A change that would make the outlet's stock
+// negative returns a *StockError.
+func changeStock(tx *sql.Tx, tables Tables, outletID, productID, variantID, delta int) (int, error) {
+	balance, _, err := changeStockLots(tx, tables, outletID, productID, variantID, delta)
+	return balance, err
+}
+
+// changeStockLots is changeStock that also returns the quantities a decrease
+// took from each lot.
+func changeStockLots(tx *sql.Tx, tables Tables, outletID, productID, variantID, delta int) (int, []LotUsage, error) {
+	var stock int
+	var err error
+	if variantID != 0 {
+		lockQuery := fmt.Sprintf("SELECT stock FROM %s WHERE id = $1 AND product_id = $2 FOR UPDATE", tables.ProductVariant)
+		err = tx.QueryRow(lockQuery, variantID, productID).Scan(&stock)
+	} else {
+		lockQuery := fmt.Sprintf("SELECT stock FROM %s WHERE id = $1 FOR UPDATE", tables.Product)
+		err = tx.QueryRow(lockQuery, productID).Scan(&stock)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			if variantID != 0 {
+				return 0, nil, ErrVariantNotFound
+			}
+			return 0, nil, ErrProductNotFound
+		}
+		return 0, nil, fmt.Errorf("failed to query stock: %w", translateError(err))
+	}
+
+	if _, err := changeOutletStock(tx, tables.OutletStock, outletID, productID, variantID, delta); err != nil {
+		return 0, nil, err
+	}
+	var usages []LotUsage
+	if delta < 0 {
+		if usages, err = takeLots(tx, tables.Lot, outletID, productID, variantID, -delta); err != nil {
+			return 0, nil, err
+		}
+	}
+	if variantID != 0 {
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET stock = $1 WHERE id = $2", tables.ProductVariant), stock+delta, variantID)
+	} else {
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET stock = $1 WHERE id = $2", tables.Product), stock+delta, productID)
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to update stock: %w", translateError(err))
+	}
+	return stock + delta, usages, nil
+}
+
+// loadOutletStock sets the Outlets of each product to its product-level stock
+// per outlet, ordered by outlet. With a non-zero outletID only that outlet is
+// loaded and Stock is replaced by the outlet's quantity.
+func loadOutletStock(db *sql.DB, outletStockTable string, products []Product, outletID int) error {
+	if len(products) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(products))
+	ids := make([]int64, len(products))
+	for i := range products {
+		index[products[i].ID] = i
+		ids[i] = int64(products[i].ID)
+		products[i].Outlets = []OutletStock{}
+		if outletID != 0 {
+			products[i].Stock = 0
+		}
+	}
+
+	query := fmt.Sprintf("SELECT product_id, outlet_id, quantity FROM %s WHERE product_id = ANY($1) AND variant_id = 0 AND ($2 = 0 OR outlet_id = $2) ORDER BY outlet_id", outletStockTable)
+	rows, err := db.Query(query, pq.Array(ids), outletID)
+	if err != nil {
+		return fmt.Errorf("failed to query outlet stock: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var s OutletStock
+		if err := rows.Scan(&productID, &s.OutletID, &s.Quantity); err != nil {
+			return fmt.Errorf("failed to scan outlet stock: %w", err)
+		}
+		p := &products[index[productID]]
+		p.Outlets = append(p.Outlets, s)
+		if outletID != 0 {
+			p.Stock = s.Quantity
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating outlet stock: %w", err)
+	}
+	return nil
+}
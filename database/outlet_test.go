@@ -0,0 +1,96 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckoutAtOutlet(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	branch, err := CreateOutlet(db, "outlet_test", Outlet{Name: "Cabang Depok", Address: "Jl. Margonda Raya 1"})
+	if err != nil {
+		t.Fatalf("CreateOutlet failed: %v", err)
+	}
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kopi Sachet", Price: 2000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	_, err = AdjustStock(db, TestTables, StockAdjustment{ProductID: prod.ID, OutletID: branch.ID, Delta: 4, Reason: AdjustmentRecount, Note: "opening count"})
+	if err != nil {
+		t.Fatalf("AdjustStock failed: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, branch.ID, []CheckoutItem{{ProductID: prod.ID, Quantity: 3}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if trx.OutletID != branch.ID {
+		t.Errorf("Expected transaction at outlet %d, got %d", branch.ID, trx.OutletID)
+	}
+
+	_, err = Checkout(db, TestTables, branch.ID, []CheckoutItem{{ProductID: prod.ID, Quantity: 2}}, nil)
+	var stockErr *StockError
+	if !errors.As(err, &stockErr) || stockErr.OutletID != branch.ID || stockErr.Available != 1 {
+		t.Errorf("Expected StockError with 1 available at outlet %d, got %v", branch.ID, err)
+	}
+	if _, err := Checkout(db, TestTables, 9999, []CheckoutItem{{ProductID: prod.ID, Quantity: 1}}, nil); err != ErrOutletNotFound {
+		t.Errorf("Expected ErrOutletNotFound, got %v", err)
+	}
+
+	updated, err := GetProductByID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 11 {
+		t.Errorf("Expected total stock 11, got %d", updated.Stock)
+	}
+
+	page, err := ListProducts(db, TestTables, ProductListParams{})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	outlets := page.Data[0].Outlets
+	if len(outlets) != 2 || outlets[0] != (OutletStock{DefaultOutletID, 10}) || outlets[1] != (OutletStock{branch.ID, 1}) {
+		t.Errorf("Unexpected stock per outlet: %+v", outlets)
+	}
+
+	inStock := false
+	page, err = ListProducts(db, TestTables, ProductListParams{OutletID: branch.ID, InStock: &inStock})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("Expected no out-of-stock products at outlet %d, got %d", branch.ID, page.Total)
+	}
+	page, err = ListProducts(db, TestTables, ProductListParams{OutletID: branch.ID, Sort: "stock"})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if page.Data[0].Stock != 1 {
+		t.Errorf("Expected stock 1 at outlet %d, got %d", branch.ID, page.Data[0].Stock)
+	}
+
+	_, err = UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: prod.Name, Price: prod.Price}, 0)
+	if !errors.As(err, &stockErr) || stockErr.OutletID != DefaultOutletID {
+		t.Errorf("Expected StockError lowering stock below the other outlets, got %v", err)
+	}
+
+	now := time.Now().UTC()
+	summary, err := GetReportToday(db, TestTables, now, branch.ID)
+	if err != nil {
+		t.Fatalf("GetReportToday failed: %v", err)
+	}
+	if summary.TotalTransaksi != 1 || summary.TotalRevenue != 6000 {
+		t.Errorf("Expected 1 transaction of 6000 at outlet %d, got %+v", branch.ID, summary)
+	}
+	summary, err = GetReportToday(db, TestTables, now, DefaultOutletID)
+	if err != nil {
+		t.Fatalf("GetReportToday failed: %v", err)
+	}
+	if summary.TotalTransaksi != 0 {
+		t.Errorf("Expected no transactions at the default outlet, got %+v", summary)
+	}
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPageLimit is used when a list request does not specify a limit.
+	DefaultPageLimit = 20
+	// MaxPageLimit caps how many rows a single page may return.
+	MaxPageLimit = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// productSortColumns maps the public sort keys of the product list to columns.
+var productSortColumns = map[string]string{
+	"id":    "p.id",
+	"name":  "p.name",
+	"price": "p.price",
+	"stock": "p.stock",
+}
+
+// Page is a single page of a cursor-paginated list.
+// NextCursor is empty when there are no more rows after this page.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor"`
+	Total      int    `json:"total"`
+}
+
+// pageCursor marks the last row of a page: the value of the sort column
+// and the row ID used as a tie-breaker.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// encodeCursor builds an opaque cursor string for the given sort key and row.
+func encodeCursor(sort, value string, id int) string {
+	data, _ := json.Marshal(pageCursor{Sort: sort, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor string and checks it was produced for the same sort key.
+func decodeCursor(cursor, sort string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.ID <= 0 {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorValue converts a cursor value back to the type of its sort column.
+func cursorValue(c pageCursor, numeric bool) (interface{}, error) {
+	if !numeric {
+		return c.Value, nil
+	}
+	n, err := strconv.Atoi(c.Value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return n, nil
+}
+
+// sortDirection returns the ORDER BY direction and the keyset comparison operator.
+func sortDirection(desc bool) (string, string) {
+	if desc {
+		return "DESC", "<"
+	}
+	return "ASC", ">"
+}
+
+// whereClause joins conditions into a WHERE clause, or returns "" when there are none.
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// normalizeLimit applies the default and maximum page size.
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
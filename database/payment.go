@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidPayment           = errors.New("invalid payment")
+	ErrPaymentReferenceRequired = errors.New("payment reference required")
+	ErrTransactionSettled       = errors.New("transaction is already settled")
+)
+
+// ErrInsufficientPayment is an invalid payment that does not cover the
+// amount due
+var ErrInsufficientPayment = fmt.Errorf("%w: payments do not cover the amount due", ErrInvalidPayment)
+
+// Payment methods accepted at checkout
+const (
+	PaymentCash       = "cash"
+	PaymentQRIS       = "qris"
+	PaymentDebitCard  = "debit_card"
+	PaymentCreditCard = "credit_card"
+	PaymentEWallet    = "e_wallet"
+)
+
+// ValidPaymentMethod reports whether method is one of the payment methods
+func ValidPaymentMethod(method string) bool {
+	switch method {
+	case PaymentCash, PaymentQRIS, PaymentDebitCard, PaymentCreditCard, PaymentEWallet:
+		return true
+	}
+	return false
+}
+
+// referenceRequired reports whether payments of method must carry the
+// reference number of the card terminal or QRIS provider
+func referenceRequired(method string) bool {
+	return method == PaymentQRIS || method == PaymentDebitCard || method == PaymentCreditCard
+}
+
+// PaymentError reports payments that do not cover the transaction total.
+// It matches ErrInsufficientPayment, and so ErrInvalidPayment, with errors.Is.
+type PaymentError struct {
+	Total int
+	Paid  int
+}
+
+func (e *PaymentError) Error() string {
+	return fmt.Sprintf("insufficient payment: paid %d of %d", e.Paid, e.Total)
+}
+
+func (e *PaymentError) Unwrap() error {
+	return ErrInsufficientPayment
+}
+
+// CheckoutPayment is an amount handed over at checkout. Reference is the
+// approval or transaction number of a non-cash payment.
+type CheckoutPayment struct {
+	Method    string `json:"method"`
+	Amount    int    `json:"amount"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// Payment is a recorded payment of a transaction. Amount is what was handed
+// over and ChangeAmount the part of it given back, so a cash drawer holds the
+// Amount less ChangeAmount of its cash payments.
+type Payment struct {
+	ID            int       `json:"id" db:"id"`
+	TransactionID int       `json:"transaction_id" db:"transaction_id"`
+	Method        string    `json:"method" db:"method"`
+	Amount        int       `json:"amount" db:"amount"`
+	ChangeAmount  int       `json:"change_amount" db:"change_amount"`
+	Reference     string    `json:"reference,omitempty" db:"reference"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+const paymentColumns = "id, transaction_id, method, amount, change_amount, reference, created_at"
+
+// scanFields returns scan destinations matching paymentColumns
+func (p *Payment) scanFields() []interface{} {
+	return []interface{}{&p.ID, &p.TransactionID, &p.Method, &p.Amount, &p.ChangeAmount, &p.Reference, &p.CreatedAt}
+}
+
+// settlePayments checks payments against the amount due and returns them
+// with the change of each. Every payment needs a known method, a positive
+// amount and a reference of at most 255 bytes, which card and QRIS payments
+// cannot leave empty. Together they must cover due unless partial is set, in
+// which case a shortfall is left outstanding. Change is only given in cash,
+// so the overpayment cannot exceed the cash handed over; it is taken from the
+// cash payments in order.
+func settlePayments(payments []CheckoutPayment, due int, partial bool) ([]Payment, error) {
+	paid, cash := 0, 0
+	for _, p := range payments {
+		if !ValidPaymentMethod(p.Method) || p.Amount <= 0 || len(p.Reference) > 255 {
+			return nil, ErrInvalidPayment
+		}
+		if referenceRequired(p.Method) && p.Reference == "" {
+			return nil, ErrPaymentReferenceRequired
+		}
+		paid += p.Amount
+		if p.Method == PaymentCash {
+			cash += p.Amount
+		}
+	}
+	if paid < due && !partial {
+		return nil, &PaymentError{Total: due, Paid: paid}
+	}
+	change := max(paid-due, 0)
+	if change > cash {
+		return nil, ErrInvalidPayment
+	}
+
+	settled := make([]Payment, len(payments))
+	for i, p := range payments {
+		settled[i] = Payment{Method: p.Method, Amount: p.Amount, Reference: p.Reference}
+		if p.Method == PaymentCash && change > 0 {
+			settled[i].ChangeAmount = min(change, p.Amount)
+			change -= settled[i].ChangeAmount
+		}
+	}
+	return settled, nil
+}
+
+// insertPayments records payments of a transaction, setting their ids and
+// creation times
+func insertPayments(tx *sql.Tx, paymentTable string, transactionID int, payments []Payment) error {
+	query := fmt.Sprintf("INSERT INTO %s (transaction_id, method, amount, change_amount, reference) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at", paymentTable)
+	for i := range payments {
+		p := &payments[i]
+		p.TransactionID = transactionID
+		if err := tx.QueryRow(query, transactionID, p.Method, p.Amount, p.ChangeAmount, p.Reference).Scan(&p.ID, &p.CreatedAt); err != nil {
+			return fmt.Errorf("failed to record payment: %w", translateError(err))
+		}
+	}
+	return nil
+}
+
+// AddPayments pays towards the outstanding amount of a transaction, such as
+// one checked out without payments. The payments follow the rules of
+// checkout payments except that they may fall short, leaving the rest
+// outstanding for further payments. A transaction without an outstanding
+// amount returns ErrTransactionSettled and a voided transaction
+// ErrTransactionVoided.
+func AddPayments(db *sql.DB, tables Tables, transactionID int, payments []CheckoutPayment) (Transaction, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	trx := Transaction{ID: transactionID}
+	var voided bool
+	lockQuery := fmt.Sprintf("SELECT total_amount, paid_amount, change_amount, voided_at IS NOT NULL FROM %s WHERE id = $1 FOR UPDATE", tables.Transaction)
+	if err := tx.QueryRow(lockQuery, transactionID).Scan(&trx.TotalAmount, &trx.PaidAmount, &trx.ChangeAmount, &voided); err != nil {
+		if err == sql.ErrNoRows {
+			return Transaction{}, ErrTransactionNotFound
+		}
+		return Transaction{}, fmt.Errorf("failed to query transaction: %w", translateError(err))
+	}
+	if voided {
+		return Transaction{}, ErrTransactionVoided
+	}
+	if err := trx.loadRefunds(tx, tables.Return); err != nil {
+		return Transaction{}, err
+	}
+	trx.setSettlement()
+	if trx.OutstandingAmount <= 0 {
+		return Transaction{}, ErrTransactionSettled
+	}
+
+	settled, err := settlePayments(payments, trx.OutstandingAmount, true)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := insertPayments(tx, tables.Payment, transactionID, settled); err != nil {
+		return Transaction{}, err
+	}
+	for _, p := range settled {
+		trx.PaidAmount += p.Amount
+		trx.ChangeAmount += p.ChangeAmount
+	}
+	updateQuery := fmt.Sprintf("UPDATE %s SET paid_amount = $1, change_amount = $2 WHERE id = $3", tables.Transaction)
+	if _, err := tx.Exec(updateQuery, trx.PaidAmount, trx.ChangeAmount, transactionID); err != nil {
+		return Transaction{}, fmt.Errorf("failed to update transaction: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Transaction{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetTransaction(db, tables, transactionID)
+}
+
+// PaymentSummary totals the payments of one method. NetAmount, the amount
+// less the change given, is what the method should have collected.
+type PaymentSummary struct {
+	Method       string `json:"method"`
+	Transactions int    `json:"transactions"`
+	Amount       int    `json:"amount"`
+	ChangeAmount int    `json:"change_amount"`
+	NetAmount    int    `json:"net_amount"`
+}
+
+// GetPaymentSummaryBetween totals the payments received within [start, end)
+// per method, ordered by method, so each method can be reconciled against
+// the cash drawer or its settlement report. A non-zero outletID only counts
+// the payments of that outlet's transactions. Payments of voided
+// transactions are left out.
+func GetPaymentSummaryBetween(db *sql.DB, tables Tables, start, end time.Time, outletID int) ([]PaymentSummary, error) {
+	query := fmt.Sprintf("SELECT p.method, COUNT(DISTINCT p.transaction_id), SUM(p.amount), SUM(p.change_amount) FROM %s p JOIN %s t ON p.transaction_id = t.id WHERE p.created_at >= $1 AND p.created_at < $2 AND ($3 = 0 OR t.outlet_id = $3) AND t.voided_at IS NULL GROUP BY p.method ORDER BY p.method", tables.Payment, tables.Transaction)
+	rows, err := db.Query(query, start, end, outletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate payments: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []PaymentSummary{}
+	for rows.Next() {
+		var s PaymentSummary
+		if err := rows.Scan(&s.Method, &s.Transactions, &s.Amount, &s.ChangeAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan payment summary: %w", err)
+		}
+		s.NetAmount = s.Amount - s.ChangeAmount
+		summaries = append(summaries, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating payment summaries: %w", err)
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSettlePayments tests payment validation and where the change comes from
+func TestSettlePayments(t *testing.T) {
+	payments, err := settlePayments([]CheckoutPayment{
+		{Method: PaymentQRIS, Amount: 20000, Reference: "QR-778812"},
+		{Method: PaymentCash, Amount: 5000},
+		{Method: PaymentCash, Amount: 10000},
+	}, 27000, false)
+	if err != nil {
+		t.Fatalf("settlePayments failed: %v", err)
+	}
+	if payments[0].ChangeAmount != 0 || payments[1].ChangeAmount != 5000 || payments[2].ChangeAmount != 3000 {
+		t.Errorf("Unexpected change: %+v", payments)
+	}
+
+	var paymentErr *PaymentError
+	if _, err := settlePayments([]CheckoutPayment{{Method: PaymentCash, Amount: 5000}}, 8000, false); !errors.As(err, &paymentErr) || paymentErr.Paid != 5000 || paymentErr.Total != 8000 || !errors.Is(err, ErrInvalidPayment) {
+		t.Errorf("Expected PaymentError for a shortfall, got %v", err)
+	}
+	partial, err := settlePayments([]CheckoutPayment{{Method: PaymentCash, Amount: 5000}}, 8000, true)
+	if err != nil {
+		t.Fatalf("settlePayments failed for a partial payment: %v", err)
+	}
+	if partial[0].ChangeAmount != 0 {
+		t.Errorf("Expected no change on a partial payment, got %+v", partial)
+	}
+	if _, err := settlePayments([]CheckoutPayment{{Method: PaymentDebitCard, Amount: 10000, Reference: "APR-0042"}}, 8000, false); err != ErrInvalidPayment {
+		t.Errorf("Expected ErrInvalidPayment for an overpaid card, got %v", err)
+	}
+	if _, err := settlePayments([]CheckoutPayment{{Method: PaymentEWallet, Amount: 9000}, {Method: PaymentCash, Amount: 1000}}, 8000, false); err != ErrInvalidPayment {
+		t.Errorf("Expected ErrInvalidPayment for an overpaid e-wallet, got %v", err)
+	}
+	if _, err := settlePayments([]CheckoutPayment{{Method: PaymentQRIS, Amount: 8000}}, 8000, false); err != ErrPaymentReferenceRequired {
+		t.Errorf("Expected ErrPaymentReferenceRequired for QRIS without a reference, got %v", err)
+	}
+	if _, err := settlePayments([]CheckoutPayment{{Method: "cheque", Amount: 8000}}, 8000, false); err != ErrInvalidPayment {
+		t.Errorf("Expected ErrInvalidPayment for an unknown method, got %v", err)
+	}
+	if _, err := settlePayments([]CheckoutPayment{{Method: PaymentCash, Amount: 0}}, 0, false); err != ErrInvalidPayment {
+		t.Errorf("Expected ErrInvalidPayment for a zero amount, got %v", err)
+	}
+}
+
+func TestCheckoutWithPayments(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kopi Susu", Price: 18000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 2}}, []CheckoutPayment{{Method: PaymentCash, Amount: 50000}})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if trx.PaidAmount != 50000 || trx.ChangeAmount != 14000 || len(trx.Payments) != 1 || trx.Payments[0].ID == 0 {
+		t.Errorf("Unexpected cash payment: %+v", trx)
+	}
+
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 1}}, []CheckoutPayment{{Method: PaymentEWallet, Amount: 18000, Reference: "EW-1029"}}); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	// A shortfall rolls back the whole checkout
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 1}}, []CheckoutPayment{{Method: PaymentCash, Amount: 10000}}); !errors.Is(err, ErrInsufficientPayment) {
+		t.Errorf("Expected ErrInsufficientPayment, got %v", err)
+	}
+	updated, err := GetProductByID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 7 {
+		t.Errorf("Expected stock 7, got %d", updated.Stock)
+	}
+
+	loaded, err := GetTransaction(db, TestTables, trx.ID)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if loaded.ChangeAmount != 14000 || len(loaded.Payments) != 1 || loaded.Payments[0].ChangeAmount != 14000 {
+		t.Errorf("Unexpected loaded payments: %+v", loaded)
+	}
+
+	now := time.Now().UTC()
+	summaries, err := GetPaymentSummaryBetween(db, TestTables, now.Add(-time.Hour), now.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("GetPaymentSummaryBetween failed: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("Expected 2 payment methods, got %+v", summaries)
+	}
+	if s := summaries[0]; s.Method != PaymentCash || s.Transactions != 1 || s.Amount != 50000 || s.NetAmount != 36000 {
+		t.Errorf("Unexpected cash summary: %+v", s)
+	}
+	if s := summaries[1]; s.Method != PaymentEWallet || s.NetAmount != 18000 {
+		t.Errorf("Unexpected e-wallet summary: %+v", s)
+	}
+}
+
+func TestAddPaymentsSettlesOutstanding(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Roti Tawar", Price: 15000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 2}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if trx.SettledAmount != 0 || trx.OutstandingAmount != 30000 {
+		t.Errorf("Expected 30000 outstanding, got %+v", trx)
+	}
+
+	// A top-up short of the outstanding amount leaves the rest for later
+	topUp, err := AddPayments(db, TestTables, trx.ID, []CheckoutPayment{{Method: PaymentEWallet, Amount: 10000, Reference: "EW-77"}})
+	if err != nil {
+		t.Fatalf("AddPayments failed for a partial payment: %v", err)
+	}
+	if topUp.SettledAmount != 10000 || topUp.OutstandingAmount != 20000 {
+		t.Errorf("Expected 20000 outstanding after a partial payment, got %+v", topUp)
+	}
+
+	settled, err := AddPayments(db, TestTables, trx.ID, []CheckoutPayment{{Method: PaymentCash, Amount: 25000}})
+	if err != nil {
+		t.Fatalf("AddPayments failed: %v", err)
+	}
+	if settled.PaidAmount != 35000 || settled.ChangeAmount != 5000 || settled.SettledAmount != 30000 || settled.OutstandingAmount != 0 {
+		t.Errorf("Unexpected settlement: %+v", settled)
+	}
+	if len(settled.Payments) != 2 || settled.Payments[1].ChangeAmount != 5000 {
+		t.Errorf("Unexpected payments: %+v", settled.Payments)
+	}
+
+	if _, err := AddPayments(db, TestTables, trx.ID, []CheckoutPayment{{Method: PaymentCash, Amount: 1000}}); err != ErrTransactionSettled {
+		t.Errorf("Expected ErrTransactionSettled, got %v", err)
+	}
+	if _, err := AddPayments(db, TestTables, 999999, []CheckoutPayment{{Method: PaymentCash, Amount: 1000}}); err != ErrTransactionNotFound {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+}
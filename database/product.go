@@ -1,5 +1,7 @@
 package database
 
+import "time"
+
 // Product represents a product entity in the database. It includes
 // CategoryName and CategoryDescription when joined with category table.
 type Product struct {
@@ -8,6 +10,59 @@ type Product struct {
 	Price               int    `json:"price" db:"price"`
 	Stock               int    `json:"stock" db:"stock"`
 	CategoryID          int    `json:"category_id" db:"category_id"`
+	SKU                 string `json:"sku" db:"sku"`
+	Barcode             string `json:"barcode" db:"barcode"`
 	CategoryName        string `json:"category_name" db:"category_name"`
 	CategoryDescription string `json:"category_description" db:"category_description"`
+	// ReorderPoint is the stock at or below which the product is low on
+	// stock; 0 disables the check
+	ReorderPoint int `json:"reorder_point" db:"reorder_point"`
+	// ReorderQty is the smallest quantity ordered when restocking; orders
+	// are suggested in multiples of it
+	ReorderQty int `json:"reorder_qty" db:"reorder_qty"`
+	// Version is incremented on every edit of the product, but not on stock
+	// changes, and used for optimistic locking
+	Version int `json:"version" db:"version"`
+	// DeletedAt is set when the product has been soft-deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Variants is only loaded when a single product is fetched
+	Variants []ProductVariant `json:"variants,omitempty" db:"-"`
+	// Outlets is the stock per outlet and is only loaded by ListProducts
+	Outlets []OutletStock `json:"outlets,omitempty" db:"-"`
+}
+
+// productColumns lists the product columns read by product queries, in the
+// order of (*Product).scanFields. The product table must be aliased as p.
+const productColumns = "p.id, p.name, p.price, p.stock, p.category_id, COALESCE(p.sku, ''), COALESCE(p.barcode, ''), p.reorder_point, p.reorder_qty, p.version, p.deleted_at"
+
+// productSelect selects productColumns joined with the category name and
+// description. It takes the product and category table names.
+const productSelect = "SELECT " + productColumns + ", COALESCE(c.name, ''), COALESCE(c.description, '') FROM %s p LEFT JOIN %s c ON p.category_id = c.id"
+
+// scanFields returns scan destinations matching productColumns
+func (p *Product) scanFields() []interface{} {
+	return []interface{}{&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID, &p.SKU, &p.Barcode, &p.ReorderPoint, &p.ReorderQty, &p.Version, &p.DeletedAt}
+}
+
+// scanFieldsWithCategory returns scan destinations matching productSelect
+func (p *Product) scanFieldsWithCategory() []interface{} {
+	return append(p.scanFields(), &p.CategoryName, &p.CategoryDescription)
+}
+
+// ProductListParams controls filtering, ordering and pagination of the product list.
+// Sort may be "id" (default), "name", "price" or "stock". Nil filters are not applied.
+// CategoryID matches products in that category and in all of its subcategories.
+// Soft-deleted products are only listed when IncludeDeleted is set.
+// OutletID selects the outlet whose stock is listed; 0 lists every outlet.
+type ProductListParams struct {
+	Limit          int
+	Cursor         string
+	CategoryID     int
+	MinPrice       *int
+	MaxPrice       *int
+	InStock        *bool
+	Sort           string
+	Desc           bool
+	IncludeDeleted bool
+	OutletID       int
 }
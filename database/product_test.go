@@ -47,6 +47,38 @@ func setupProductTestDB(t *testing.T) *sql.DB {
 	if err != nil {
 		t.Fatalf("Failed to clean up transaction_test: %v", err)
 	}
+	_, err = db.Exec("DELETE FROM product_lot_test")
+	if err != nil {
+		t.Fatalf("Failed to clean up product_lot_test: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM stock_take_test")
+	if err != nil {
+		t.Fatalf("Failed to clean up stock_take_test: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM stock_transfer_test")
+	if err != nil {
+		t.Fatalf("Failed to clean up stock_transfer_test: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM purchase_order_line_test")
+	if err != nil {
+		t.Fatalf("Failed to clean up purchase_order_line_test: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM outlet_stock_test")
+	if err != nil {
+		t.Fatalf("Failed to clean up outlet_stock_test: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM stock_adjustment_test")
+	if err != nil {
+		t.Fatalf("Failed to clean up stock_adjustment_test: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM inventory_movement_test")
+	if err != nil {
+		t.Fatalf("Failed to clean up inventory_movement_test: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM outlet_test WHERE id <> $1", DefaultOutletID)
+	if err != nil {
+		t.Fatalf("Failed to clean up outlet_test: %v", err)
+	}
 	_, err = db.Exec("DELETE FROM product_test")
 	if err != nil {
 		t.Fatalf("Failed to clean up product_test: %v", err)
@@ -71,13 +103,13 @@ func TestProductCRUD(t *testing.T) {
 	defer teardownProductTestDB(t, db)
 
 	// create category first
-	cat, err := Create(db, "category_test", "Gadgets", "Gadgets category")
+	cat, err := Create(db, "category_test", "Gadgets", stringPtr("Gadgets category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
 	// Create product
-	prod, err := CreateProduct(db, "product_test", "category_test", "Phone", 299, 10, cat.ID)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Phone", Price: 299, Stock: 10, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("CreateProduct failed: %v", err)
 	}
@@ -91,7 +123,7 @@ func TestProductCRUD(t *testing.T) {
 	}
 
 	// Get by ID
-	fetched, err := GetProductByID(db, "product_test", "category_test", prod.ID)
+	fetched, err := GetProductByID(db, TestTables, prod.ID)
 	if err != nil {
 		t.Fatalf("GetProductByID failed: %v", err)
 	}
@@ -101,7 +133,7 @@ func TestProductCRUD(t *testing.T) {
 	}
 
 	// Update
-	updated, err := UpdateProduct(db, "product_test", "category_test", prod.ID, "Smartphone", 399, 5, cat.ID)
+	updated, err := UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: "Smartphone", Price: 399, Stock: 5, CategoryID: cat.ID}, 0)
 	if err != nil {
 		t.Fatalf("UpdateProduct failed: %v", err)
 	}
@@ -110,43 +142,159 @@ func TestProductCRUD(t *testing.T) {
 	}
 
 	// Delete
-	err = DeleteProduct(db, "product_test", prod.ID)
+	err = DeleteProduct(db, TestTables, prod.ID, 0)
 	if err != nil {
 		t.Fatalf("DeleteProduct failed: %v", err)
 	}
 
 	// Verify deletion
-	_, err = GetProductByID(db, "product_test", "category_test", prod.ID)
+	_, err = GetProductByID(db, TestTables, prod.ID)
 	if err == nil {
 		t.Error("Expected not found after deletion")
 	}
 }
 
+// TestSoftDeleteProduct tests that deleted products are hidden and can be restored
+func TestSoftDeleteProduct(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	cat, err := Create(db, "category_test", "Minuman", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Teh Botol", Price: 4000, Stock: 10, CategoryID: cat.ID, SKU: "TEH-BTL", Barcode: "089686010947"})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	if err := DeleteProduct(db, TestTables, prod.ID, 0); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	if err := DeleteProduct(db, TestTables, prod.ID, 0); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound deleting twice, got %v", err)
+	}
+
+	all, err := GetAllProducts(db, TestTables)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("Expected deleted product to be hidden, got %d products", len(all))
+	}
+	if _, err := GetProductByBarcode(db, TestTables, "089686010947"); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound by barcode, got %v", err)
+	}
+	matches, err := SearchProducts(db, TestTables, "teh", 10)
+	if err != nil {
+		t.Fatalf("SearchProducts failed: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Expected no search results for deleted product, got %d", len(matches))
+	}
+	if _, err := UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: "Teh", Price: 4000, Stock: 10, CategoryID: cat.ID}, 0); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound updating deleted product, got %v", err)
+	}
+
+	page, err := ListProducts(db, TestTables, ProductListParams{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if page.Total != 1 || page.Data[0].DeletedAt == nil {
+		t.Errorf("Expected deleted product with deleted_at, got %+v", page)
+	}
+
+	// The SKU stays reserved while the product is deleted
+	if _, err := CreateProduct(db, TestTables, Product{Name: "Teh Lain", Price: 4000, Stock: 10, CategoryID: cat.ID, SKU: "TEH-BTL"}); err != ErrDuplicateProductCode {
+		t.Errorf("Expected ErrDuplicateProductCode for reserved SKU, got %v", err)
+	}
+
+	restored, err := RestoreProduct(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("RestoreProduct failed: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.CategoryName != "Minuman" {
+		t.Errorf("Unexpected restored product: %+v", restored)
+	}
+	if _, err := GetProductByID(db, TestTables, prod.ID); err != nil {
+		t.Errorf("Expected restored product to be found, got %v", err)
+	}
+
+	if _, err := RestoreProduct(db, TestTables, 9999); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+// TestProductVersion tests optimistic locking on product updates and deletes,
+// and that stock changes leave the version alone
+func TestProductVersion(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Teh Botol", Price: 4000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if prod.Version != 1 {
+		t.Fatalf("Expected version 1, got %d", prod.Version)
+	}
+
+	updated, err := UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: "Teh Botol Sosro", Price: 4500, Stock: 10}, prod.Version)
+	if err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("Expected version 2, got %d", updated.Version)
+	}
+
+	if _, err := UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: "Teh", Price: 1, Stock: 1}, prod.Version); err != ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+
+	// A sale is not a catalog edit, so the version from before it still matches
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 1}}, nil); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	current, err := GetProductByID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if current.Version != updated.Version {
+		t.Errorf("Expected checkout to keep version %d, got %d", updated.Version, current.Version)
+	}
+	if err := DeleteProduct(db, TestTables, prod.ID, updated.Version); err != nil {
+		t.Errorf("DeleteProduct with the version from before checkout failed: %v", err)
+	}
+	if err := DeleteProduct(db, TestTables, prod.ID, updated.Version); err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound for deleted product, got %v", err)
+	}
+}
+
 // TestProductInputValidation tests input validation for products
 func TestProductInputValidation(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
 	// Create category for testing
-	cat, err := Create(db, "category_test", "TestCat", "Test category")
+	cat, err := Create(db, "category_test", "TestCat", stringPtr("Test category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
 	// Test zero price (should fail at API layer)
-	_, err = CreateProduct(db, "product_test", "category_test", "ZeroPrice", 0, 10, cat.ID)
+	_, err = CreateProduct(db, TestTables, Product{Name: "ZeroPrice", Stock: 10, CategoryID: cat.ID})
 	if err != nil {
 		t.Logf("Database validation: zero price rejected (also validated at API layer)")
 	}
 
 	// Test negative stock (should fail at API layer)
-	_, err = CreateProduct(db, "product_test", "category_test", "NegativeStock", 100, -5, cat.ID)
+	_, err = CreateProduct(db, TestTables, Product{Name: "NegativeStock", Price: 100, Stock: -5, CategoryID: cat.ID})
 	if err != nil {
 		t.Logf("Database validation: negative stock rejected (also validated at API layer)")
 	}
 
 	// Test with non-existent category (validation at API layer)
-	prod, err := CreateProduct(db, "product_test", "category_test", "OrphanProduct", 100, 5, 9999)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "OrphanProduct", Price: 100, Stock: 5, CategoryID: 9999})
 	if err != nil {
 		t.Logf("API layer validates category existence")
 		return
@@ -162,18 +310,18 @@ func TestProductUpdateValidation(t *testing.T) {
 	defer teardownProductTestDB(t, db)
 
 	// Create category and product
-	cat, err := Create(db, "category_test", "TestCat", "Test category")
+	cat, err := Create(db, "category_test", "TestCat", stringPtr("Test category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod, err := CreateProduct(db, "product_test", "category_test", "TestProduct", 100, 10, cat.ID)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "TestProduct", Price: 100, Stock: 10, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
 	// Test update with non-existent category
-	_, err = UpdateProduct(db, "product_test", "category_test", prod.ID, "Updated", 200, 5, 9999)
+	_, err = UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: "Updated", Price: 200, Stock: 5, CategoryID: 9999}, 0)
 	if err != nil {
 		t.Logf("API layer validates category on update")
 		return
@@ -181,3 +329,271 @@ func TestProductUpdateValidation(t *testing.T) {
 	// If update succeeds, category validation is at API layer
 	t.Logf("Update with invalid category succeeded at DB layer (API layer validates)")
 }
+
+// TestListProductsPagination walks through products page by page using next_cursor
+func TestListProductsPagination(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	prices := []int{500, 100, 300, 200, 400}
+	for i, price := range prices {
+		_, err := CreateProduct(db, TestTables, Product{Name: fmt.Sprintf("Item %d", i), Price: price, Stock: i, CategoryID: cat.ID})
+		if err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+	}
+
+	var seen []int
+	cursor := ""
+	for pageNum := 0; pageNum < 5; pageNum++ {
+		page, err := ListProducts(db, TestTables, ProductListParams{Limit: 2, Cursor: cursor, Sort: "price"})
+		if err != nil {
+			t.Fatalf("ListProducts failed: %v", err)
+		}
+		if page.Total != 5 {
+			t.Errorf("Expected total 5, got %d", page.Total)
+		}
+		for _, p := range page.Data {
+			seen = append(seen, p.Price)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	expected := []int{100, 200, 300, 400, 500}
+	if fmt.Sprint(seen) != fmt.Sprint(expected) {
+		t.Errorf("Expected prices %v, got %v", expected, seen)
+	}
+
+	desc, err := ListProducts(db, TestTables, ProductListParams{Limit: 1, Sort: "price", Desc: true})
+	if err != nil {
+		t.Fatalf("ListProducts desc failed: %v", err)
+	}
+	if len(desc.Data) != 1 || desc.Data[0].Price != 500 {
+		t.Errorf("Expected first product price 500 in desc order, got %+v", desc.Data)
+	}
+
+	// A cursor issued for one sort order cannot be reused for another
+	_, err = ListProducts(db, TestTables, ProductListParams{Cursor: desc.NextCursor, Sort: "name"})
+	if err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+// TestListProductsFilters tests category, price and stock filters
+func TestListProductsFilters(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	food, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	drinks, err := Create(db, "category_test", "Drinks", stringPtr("Drinks category"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	if _, err := CreateProduct(db, TestTables, Product{Name: "Bread", Price: 1000, CategoryID: food.ID}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := CreateProduct(db, TestTables, Product{Name: "Cake", Price: 5000, Stock: 3, CategoryID: food.ID}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := CreateProduct(db, TestTables, Product{Name: "Tea", Price: 2000, Stock: 10, CategoryID: drinks.ID}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	page, err := ListProducts(db, TestTables, ProductListParams{CategoryID: food.ID})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if page.Total != 2 || len(page.Data) != 2 {
+		t.Errorf("Expected 2 food products, got total %d, len %d", page.Total, len(page.Data))
+	}
+
+	minPrice, maxPrice := 1500, 4000
+	page, err = ListProducts(db, TestTables, ProductListParams{MinPrice: &minPrice, MaxPrice: &maxPrice})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if page.Total != 1 || page.Data[0].Name != "Tea" {
+		t.Errorf("Expected only Tea in price range, got %+v", page.Data)
+	}
+
+	inStock := true
+	page, err = ListProducts(db, TestTables, ProductListParams{CategoryID: food.ID, InStock: &inStock})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if page.Total != 1 || page.Data[0].Name != "Cake" {
+		t.Errorf("Expected only Cake in stock, got %+v", page.Data)
+	}
+
+	_, err = ListProducts(db, TestTables, ProductListParams{Sort: "color"})
+	if err != ErrInvalidSort {
+		t.Errorf("Expected ErrInvalidSort, got %v", err)
+	}
+}
+
+// TestListProductsCategoryDescendants tests that the category filter includes subcategories
+func TestListProductsCategoryDescendants(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	minuman, err := Create(db, "category_test", "Minuman", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	kopi, err := Create(db, "category_test", "Kopi", nil, &minuman.ID)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	kopiSusu, err := Create(db, "category_test", "Kopi Susu", nil, &kopi.ID)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	for _, p := range []struct {
+		name       string
+		categoryID int
+	}{
+		{"Air Mineral", minuman.ID},
+		{"Kopi Hitam", kopi.ID},
+		{"Es Kopi Susu", kopiSusu.ID},
+	} {
+		if _, err := CreateProduct(db, TestTables, Product{Name: p.name, Price: 5000, Stock: 1, CategoryID: p.categoryID}); err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+	}
+
+	expected := map[int]int{minuman.ID: 3, kopi.ID: 2, kopiSusu.ID: 1}
+	for categoryID, want := range expected {
+		page, err := ListProducts(db, TestTables, ProductListParams{CategoryID: categoryID})
+		if err != nil {
+			t.Fatalf("ListProducts failed: %v", err)
+		}
+		if page.Total != want || len(page.Data) != want {
+			t.Errorf("Category %d: expected %d products, got total %d, len %d", categoryID, want, page.Total, len(page.Data))
+		}
+	}
+}
+
+// TestSearchProducts tests prefix, typo-tolerant and category matches
+func TestSearchProducts(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	food, err := Create(db, "category_test", "Makanan", stringPtr("Mie instan dan makanan ringan"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	drinks, err := Create(db, "category_test", "Minuman", stringPtr("Teh, kopi dan jus"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	indomie, err := CreateProduct(db, TestTables, Product{Name: "Indomie Goreng", Price: 3500, Stock: 100, CategoryID: food.ID})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := CreateProduct(db, TestTables, Product{Name: "Chitato", Price: 10000, Stock: 20, CategoryID: food.ID}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	tehBotol, err := CreateProduct(db, TestTables, Product{Name: "Teh Botol", Price: 4000, Stock: 50, CategoryID: drinks.ID})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	// Partial word
+	matches, err := SearchProducts(db, TestTables, "indomi", 10)
+	if err != nil {
+		t.Fatalf("SearchProducts failed: %v", err)
+	}
+	if len(matches) == 0 || matches[0].ID != indomie.ID {
+		t.Fatalf("Expected Indomie Goreng as top match for 'indomi', got %+v", matches)
+	}
+
+	// Typo
+	matches, err = SearchProducts(db, TestTables, "indomei", 10)
+	if err != nil {
+		t.Fatalf("SearchProducts failed: %v", err)
+	}
+	if len(matches) == 0 || matches[0].ID != indomie.ID {
+		t.Errorf("Expected Indomie Goreng as top match for 'indomei', got %+v", matches)
+	}
+
+	// Category name
+	matches, err = SearchProducts(db, TestTables, "minuman", 10)
+	if err != nil {
+		t.Fatalf("SearchProducts failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != tehBotol.ID {
+		t.Errorf("Expected only Teh Botol for 'minuman', got %+v", matches)
+	}
+
+	// Punctuation only yields no terms
+	matches, err = SearchProducts(db, TestTables, "%&*", 10)
+	if err != nil {
+		t.Fatalf("SearchProducts failed: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches, got %+v", matches)
+	}
+}
+
+// TestProductBarcodeAndSKU tests barcode lookup and uniqueness of SKU and barcode
+func TestProductBarcodeAndSKU(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Indomie Goreng", Price: 3500, Stock: 100, SKU: "IDM-GRG-85", Barcode: "089686010947"})
+	if err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	if prod.SKU != "IDM-GRG-85" || prod.Barcode != "089686010947" {
+		t.Errorf("Expected sku and barcode to be stored, got %q and %q", prod.SKU, prod.Barcode)
+	}
+
+	fetched, err := GetProductByBarcode(db, TestTables, "089686010947")
+	if err != nil {
+		t.Fatalf("GetProductByBarcode failed: %v", err)
+	}
+	if fetched.ID != prod.ID {
+		t.Errorf("Expected product %d, got %d", prod.ID, fetched.ID)
+	}
+
+	_, err = GetProductByBarcode(db, TestTables, "4006381333931")
+	if err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+
+	// Products without codes do not collide with each other
+	if _, err := CreateProduct(db, TestTables, Product{Name: "No Code 1", Price: 100, Stock: 1}); err != nil {
+		t.Fatalf("CreateProduct without codes failed: %v", err)
+	}
+	if _, err := CreateProduct(db, TestTables, Product{Name: "No Code 2", Price: 100, Stock: 1}); err != nil {
+		t.Fatalf("CreateProduct without codes failed: %v", err)
+	}
+
+	_, err = CreateProduct(db, TestTables, Product{Name: "Duplicate SKU", Price: 100, Stock: 1, SKU: "IDM-GRG-85"})
+	if err != ErrDuplicateProductCode {
+		t.Errorf("Expected ErrDuplicateProductCode for duplicate SKU, got %v", err)
+	}
+
+	other, err := CreateProduct(db, TestTables, Product{Name: "Other", Price: 100, Stock: 1, SKU: "OTHER"})
+	if err != nil {
+		t.Fatalf("CreateProduct failed: %v", err)
+	}
+	_, err = UpdateProduct(db, TestTables, Product{ID: other.ID, Name: "Other", Price: 100, Stock: 1, SKU: "OTHER", Barcode: "089686010947"}, 0)
+	if err != ErrDuplicateProductCode {
+		t.Errorf("Expected ErrDuplicateProductCode for duplicate barcode, got %v", err)
+	}
+}
@@ -0,0 +1,466 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	ErrInvalidPurchaseOrder  = errors.New("invalid purchase order")
+	ErrPurchaseOrderStatus   = errors.New("purchase order status does not allow this change")
+	ErrInvalidReceipt        = errors.New("invalid goods receipt")
+	ErrReceiptExceedsOrder   = errors.New("received quantity exceeds ordered quantity")
+)
+
+// Statuses of a purchase order. A draft can be edited; once ordered, goods
+// can be received until every line is complete. Drafts and ordered purchase
+// orders without receipts can be cancelled.
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderOrdered           = "ordered"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+// PurchaseOrder is an order of stock from a supplier. TotalCost is the
+// expected cost of all lines.
+type PurchaseOrder struct {
+	ID         int       `json:"id" db:"id"`
+	SupplierID int       `json:"supplier_id" db:"supplier_id"`
+	Status     string    `json:"status" db:"status"`
+	Note       string    `json:"note" db:"note"`
+	TotalCost  int       `json:"total_cost" db:"-"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	// Lines is only loaded when a single purchase order is fetched
+	Lines []PurchaseOrderLine `json:"lines,omitempty" db:"-"`
+}
+
+// PurchaseOrderLine is a product ordered on a purchase order. Each product
+// appears at most once per order.
+type PurchaseOrderLine struct {
+	ID               int    `json:"id" db:"id"`
+	ProductID        int    `json:"product_id" db:"product_id"`
+	ProductName      string `json:"product_name" db:"-"`
+	Quantity         int    `json:"quantity" db:"quantity"`
+	ReceivedQuantity int    `json:"received_quantity" db:"received_quantity"`
+	UnitCost         int    `json:"unit_cost" db:"unit_cost"`
+}
+
+// ReceiptLine is a quantity of a product delivered for a purchase order. The
+// quantity goes into a lot when LotNumber and ExpiryDate are set.
+type ReceiptLine struct {
+	ProductID  int    `json:"product_id"`
+	Quantity   int    `json:"quantity"`
+	LotNumber  string `json:"lot_number,omitempty"`
+	ExpiryDate string `json:"expiry_date,omitempty"`
+}
+
+// ReceiptError reports a receipt line that would take the received quantity
+// of a product beyond the ordered quantity. It matches ErrReceiptExceedsOrder
+// with errors.Is.
+type ReceiptError struct {
+	ProductID int
+	Ordered   int
+	Received  int
+	Requested int
+}
+
+func (e *ReceiptError) Error() string {
+	return fmt.Sprintf("receipt of %d exceeds order for product %d: ordered %d, received %d", e.Requested, e.ProductID, e.Ordered, e.Received)
+}
+
+func (e *ReceiptError) Unwrap() error {
+	return ErrReceiptExceedsOrder
+}
+
+// PurchaseOrderListParams controls filtering and pagination of the purchase
+// order list, which is ordered by ID. Empty filters are not applied.
+type PurchaseOrderListParams struct {
+	Limit      int
+	Cursor     string
+	Desc       bool
+	Status     string
+	SupplierID int
+}
+
+// ValidPurchaseOrderStatus reports whether status is a purchase order status
+func ValidPurchaseOrderStatus(status string) bool {
+	switch status {
+	case PurchaseOrderDraft, PurchaseOrderOrdered, PurchaseOrderPartiallyReceived, PurchaseOrderReceived, PurchaseOrderCancelled:
+		return true
+	}
+	return false
+}
+
+// purchaseOrderSelect selects a purchase order with its expected total cost.
+// It takes the purchase order and purchase order line table names.
+const purchaseOrderSelect = "SELECT o.id, o.supplier_id, o.status, o.note, o.created_at, COALESCE((SELECT SUM(l.quantity * l.unit_cost) FROM %[2]s l WHERE l.purchase_order_id = o.id), 0) FROM %[1]s o"
+
+// scanFields returns scan destinations matching purchaseOrderSelect
+func (o *PurchaseOrder) scanFields() []interface{} {
+	return []interface{}{&o.ID, &o.SupplierID, &o.Status, &o.Note, &o.CreatedAt, &o.TotalCost}
+}
+
+// validPurchaseOrderLines reports whether lines is non-empty, lists each
+// product once and has positive quantities and non-negative costs
+func validPurchaseOrderLines(lines []PurchaseOrderLine) bool {
+	if len(lines) == 0 {
+		return false
+	}
+	seen := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		if line.ProductID <= 0 || line.Quantity <= 0 || line.UnitCost < 0 || seen[line.ProductID] {
+			return false
+		}
+		seen[line.ProductID] = true
+	}
+	return true
+}
+
+// insertPurchaseOrderLines adds lines to purchase order orderID. Deleted
+// products cannot be ordered and return ErrProductNotFound.
+func insertPurchaseOrderLines(tx *sql.Tx, tables Tables, orderID int, lines []PurchaseOrderLine) error {
+	productIDs := make([]int64, len(lines))
+	for i, line := range lines {
+		productIDs[i] = int64(line.ProductID)
+	}
+	var active int
+	activeQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = ANY($1) AND deleted_at IS NULL", tables.Product)
+	if err := tx.QueryRow(activeQuery, pq.Array(productIDs)).Scan(&active); err != nil {
+		return fmt.Errorf("failed to query products: %w", translateError(err))
+	}
+	if active != len(lines) {
+		return ErrProductNotFound
+	}
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (purchase_order_id, product_id, quantity, unit_cost) VALUES ($1, $2, $3, $4)", tables.PurchaseOrderLine)
+	for _, line := range lines {
+		if _, err := tx.Exec(insertQuery, orderID, line.ProductID, line.Quantity, line.UnitCost); err != nil {
+			return fmt.Errorf("failed to create purchase order line: %w", translateError(err))
+		}
+	}
+	return nil
+}
+
+// GetPurchaseOrder retrieves a purchase order with its lines
+func GetPurchaseOrder(db *sql.DB, tables Tables, id int) (PurchaseOrder, error) {
+	var o PurchaseOrder
+	query := fmt.Sprintf(purchaseOrderSelect+" WHERE o.id = $1", tables.PurchaseOrder, tables.PurchaseOrderLine)
+	if err := db.QueryRow(query, id).Scan(o.scanFields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return PurchaseOrder{}, ErrPurchaseOrderNotFound
+		}
+		return PurchaseOrder{}, fmt.Errorf("failed to query purchase order: %w", err)
+	}
+
+	linesQuery := fmt.Sprintf("SELECT l.id, l.product_id, COALESCE(p.name, ''), l.quantity, l.received_quantity, l.unit_cost FROM %s l LEFT JOIN %s p ON l.product_id = p.id WHERE l.purchase_order_id = $1 ORDER BY l.id", tables.PurchaseOrderLine, tables.Product)
+	rows, err := db.Query(linesQuery, id)
+	if err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to query purchase order lines: %w", err)
+	}
+	defer rows.Close()
+
+	o.Lines = []PurchaseOrderLine{}
+	for rows.Next() {
+		var line PurchaseOrderLine
+		if err := rows.Scan(&line.ID, &line.ProductID, &line.ProductName, &line.Quantity, &line.ReceivedQuantity, &line.UnitCost); err != nil {
+			return PurchaseOrder{}, fmt.Errorf("failed to scan purchase order line: %w", err)
+		}
+		o.Lines = append(o.Lines, line)
+	}
+
+	if err = rows.Err(); err != nil {
+		return PurchaseOrder{}, fmt.Errorf("error iterating purchase order lines: %w", err)
+	}
+
+	return o, nil
+}
+
+// ListPurchaseOrders retrieves a page of purchase orders without their lines
+func ListPurchaseOrders(db *sql.DB, tables Tables, params PurchaseOrderListParams) (Page[PurchaseOrder], error) {
+	dir, op := sortDirection(params.Desc)
+	sortKey := "id:" + dir
+
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if params.Status != "" {
+		conds = append(conds, "o.status = "+arg(params.Status))
+	}
+	if params.SupplierID != 0 {
+		conds = append(conds, "o.supplier_id = "+arg(params.SupplierID))
+	}
+
+	page := Page[PurchaseOrder]{Data: []PurchaseOrder{}}
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s o%s", tables.PurchaseOrder, whereClause(conds))
+	if err := db.QueryRow(countQuery, args...).Scan(&page.Total); err != nil {
+		return Page[PurchaseOrder]{}, fmt.Errorf("failed to count purchase orders: %w", err)
+	}
+
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor, sortKey)
+		if err != nil {
+			return Page[PurchaseOrder]{}, err
+		}
+		conds = append(conds, fmt.Sprintf("o.id %s %s", op, arg(c.ID)))
+	}
+
+	limit := normalizeLimit(params.Limit)
+	query := fmt.Sprintf(purchaseOrderSelect+"%[3]s ORDER BY o.id %[4]s LIMIT %[5]s", tables.PurchaseOrder, tables.PurchaseOrderLine, whereClause(conds), dir, arg(limit+1))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Page[PurchaseOrder]{}, fmt.Errorf("failed to query purchase orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o PurchaseOrder
+		if err := rows.Scan(o.scanFields()...); err != nil {
+			return Page[PurchaseOrder]{}, fmt.Errorf("failed to scan purchase order: %w", err)
+		}
+		page.Data = append(page.Data, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page[PurchaseOrder]{}, fmt.Errorf("error iterating purchase orders: %w", err)
+	}
+
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		last := page.Data[limit-1]
+		page.NextCursor = encodeCursor(sortKey, strconv.Itoa(last.ID), last.ID)
+	}
+
+	return page, nil
+}
+
+// CreatePurchaseOrder creates a draft purchase order with its lines and returns it
+func CreatePurchaseOrder(db *sql.DB, tables Tables, o PurchaseOrder) (PurchaseOrder, error) {
+	if !validPurchaseOrderLines(o.Lines) {
+		return PurchaseOrder{}, ErrInvalidPurchaseOrder
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (supplier_id, status, note) VALUES ($1, $2, $3) RETURNING id", tables.PurchaseOrder)
+	if err := tx.QueryRow(query, o.SupplierID, PurchaseOrderDraft, o.Note).Scan(&id); err != nil {
+		if isForeignKeyViolation(err) {
+			return PurchaseOrder{}, ErrSupplierNotFound
+		}
+		return PurchaseOrder{}, fmt.Errorf("failed to create purchase order: %w", translateError(err))
+	}
+
+	if err := insertPurchaseOrderLines(tx, tables, id, o.Lines); err != nil {
+		return PurchaseOrder{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetPurchaseOrder(db, tables, id)
+}
+
+// UpdatePurchaseOrder replaces the supplier, note and lines of draft purchase
+// order o.ID. Orders past draft return ErrPurchaseOrderStatus.
+func UpdatePurchaseOrder(db *sql.DB, tables Tables, o PurchaseOrder) (PurchaseOrder, error) {
+	if !validPurchaseOrderLines(o.Lines) {
+		return PurchaseOrder{}, ErrInvalidPurchaseOrder
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	lockQuery := fmt.Sprintf("SELECT status FROM %s WHERE id = $1 FOR UPDATE", tables.PurchaseOrder)
+	if err := tx.QueryRow(lockQuery, o.ID).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return PurchaseOrder{}, ErrPurchaseOrderNotFound
+		}
+		return PurchaseOrder{}, fmt.Errorf("failed to query purchase order: %w", translateError(err))
+	}
+	if status != PurchaseOrderDraft {
+		return PurchaseOrder{}, ErrPurchaseOrderStatus
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET supplier_id = $1, note = $2 WHERE id = $3", tables.PurchaseOrder), o.SupplierID, o.Note, o.ID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return PurchaseOrder{}, ErrSupplierNotFound
+		}
+		return PurchaseOrder{}, fmt.Errorf("failed to update purchase order: %w", translateError(err))
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE purchase_order_id = $1", tables.PurchaseOrderLine), o.ID)
+	if err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to delete purchase order lines: %w", translateError(err))
+	}
+	if err := insertPurchaseOrderLines(tx, tables, o.ID, o.Lines); err != nil {
+		return PurchaseOrder{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetPurchaseOrder(db, tables, o.ID)
+}
+
+// setPurchaseOrderStatus moves purchase order id to status to if its current
+// status is one of from, and returns ErrPurchaseOrderStatus otherwise
+func setPurchaseOrderStatus(db *sql.DB, tables Tables, id int, to string, from ...string) (PurchaseOrder, error) {
+	query := fmt.Sprintf("UPDATE %s SET status = $1 WHERE id = $2 AND status = ANY($3)", tables.PurchaseOrder)
+	result, err := db.Exec(query, to, id, pq.Array(from))
+	if err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to update purchase order: %w", translateError(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	o, err := GetPurchaseOrder(db, tables, id)
+	if err != nil {
+		return PurchaseOrder{}, err
+	}
+	if rowsAffected == 0 {
+		return PurchaseOrder{}, ErrPurchaseOrderStatus
+	}
+	return o, nil
+}
+
+// OrderPurchaseOrder marks a draft purchase order as sent to the supplier
+func OrderPurchaseOrder(db *sql.DB, tables Tables, id int) (PurchaseOrder, error) {
+	return setPurchaseOrderStatus(db, tables, id, PurchaseOrderOrdered, PurchaseOrderDraft)
+}
+
+// CancelPurchaseOrder cancels a purchase order that has not received any goods
+func CancelPurchaseOrder(db *sql.DB, tables Tables, id int) (PurchaseOrder, error) {
+	return setPurchaseOrderStatus(db, tables, id, PurchaseOrderCancelled, PurchaseOrderDraft, PurchaseOrderOrdered)
+}
+
+// ReceivePurchaseOrder books a delivery for an ordered purchase order. The
+// received quantities are added to the products' stock at outletID, or at
+// DefaultOutletID when it is 0, and recorded as receipt movements referencing
+// the purchase order, all in one database transaction.
+// The order becomes received once every line is complete and partially
+// received before that. Receiving more than was ordered returns a *ReceiptError.
+// Lines with a lot number are added to that lot at the outlet; a lot number
+// that exists with another expiry date returns ErrInvalidLot. A product that
+// has been deleted since it was ordered returns ErrProductNotFound.
+func ReceivePurchaseOrder(db *sql.DB, tables Tables, id, outletID int, lines []ReceiptLine) (PurchaseOrder, error) {
+	if len(lines) == 0 {
+		return PurchaseOrder{}, ErrInvalidReceipt
+	}
+	seen := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		if line.ProductID <= 0 || line.Quantity <= 0 || seen[line.ProductID] {
+			return PurchaseOrder{}, ErrInvalidReceipt
+		}
+		if (line.LotNumber != "" || line.ExpiryDate != "") && (line.LotNumber == "" || !validLotDate(line.ExpiryDate)) {
+			return PurchaseOrder{}, ErrInvalidLot
+		}
+		seen[line.ProductID] = true
+	}
+	if outletID == 0 {
+		outletID = DefaultOutletID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	lockQuery := fmt.Sprintf("SELECT status FROM %s WHERE id = $1 FOR UPDATE", tables.PurchaseOrder)
+	if err := tx.QueryRow(lockQuery, id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return PurchaseOrder{}, ErrPurchaseOrderNotFound
+		}
+		return PurchaseOrder{}, fmt.Errorf("failed to query purchase order: %w", translateError(err))
+	}
+	if status != PurchaseOrderOrdered && status != PurchaseOrderPartiallyReceived {
+		return PurchaseOrder{}, ErrPurchaseOrderStatus
+	}
+	if err := checkOutlet(tx, tables.Outlet, outletID); err != nil {
+		return PurchaseOrder{}, err
+	}
+
+	lineQuery := fmt.Sprintf("SELECT id, quantity, received_quantity FROM %s WHERE purchase_order_id = $1 AND product_id = $2", tables.PurchaseOrderLine)
+	activeQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND deleted_at IS NULL)", tables.Product)
+	updateLineQuery := fmt.Sprintf("UPDATE %s SET received_quantity = received_quantity + $1 WHERE id = $2", tables.PurchaseOrderLine)
+
+	for _, line := range lines {
+		var lineID, ordered, received int
+		if err := tx.QueryRow(lineQuery, id, line.ProductID).Scan(&lineID, &ordered, &received); err != nil {
+			if err == sql.ErrNoRows {
+				return PurchaseOrder{}, ErrInvalidReceipt
+			}
+			return PurchaseOrder{}, fmt.Errorf("failed to query purchase order line: %w", translateError(err))
+		}
+		if received+line.Quantity > ordered {
+			return PurchaseOrder{}, &ReceiptError{ProductID: line.ProductID, Ordered: ordered, Received: received, Requested: line.Quantity}
+		}
+
+		var active bool
+		if err := tx.QueryRow(activeQuery, line.ProductID).Scan(&active); err != nil {
+			return PurchaseOrder{}, fmt.Errorf("failed to query product: %w", translateError(err))
+		}
+		if !active {
+			return PurchaseOrder{}, ErrProductNotFound
+		}
+		balance, err := changeStock(tx, tables, outletID, line.ProductID, 0, line.Quantity)
+		if err != nil {
+			return PurchaseOrder{}, err
+		}
+		if line.LotNumber != "" {
+			if _, err := addLot(tx, tables.Lot, Lot{OutletID: outletID, ProductID: line.ProductID, LotNumber: line.LotNumber, ExpiryDate: line.ExpiryDate, Quantity: line.Quantity}); err != nil {
+				return PurchaseOrder{}, err
+			}
+		}
+		if _, err := tx.Exec(updateLineQuery, line.Quantity, lineID); err != nil {
+			return PurchaseOrder{}, fmt.Errorf("failed to update purchase order line: %w", translateError(err))
+		}
+
+		err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: line.ProductID, OutletID: outletID, Delta: line.Quantity, Balance: balance, Reason: MovementReceipt, ReferenceID: id})
+		if err != nil {
+			return PurchaseOrder{}, err
+		}
+	}
+
+	var complete bool
+	completeQuery := fmt.Sprintf("SELECT bool_and(received_quantity >= quantity) FROM %s WHERE purchase_order_id = $1", tables.PurchaseOrderLine)
+	if err := tx.QueryRow(completeQuery, id).Scan(&complete); err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to query purchase order lines: %w", translateError(err))
+	}
+	status = PurchaseOrderPartiallyReceived
+	if complete {
+		status = PurchaseOrderReceived
+	}
+	if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET status = $1 WHERE id = $2", tables.PurchaseOrder), status, id); err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to update purchase order: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PurchaseOrder{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetPurchaseOrder(db, tables, id)
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPurchaseOrderReceipt(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	supplier, err := CreateSupplier(db, "supplier_test", Supplier{Name: "PT Sumber Makmur", Phone: "021-555-0101"})
+	if err != nil {
+		t.Fatalf("CreateSupplier failed: %v", err)
+	}
+	rice, err := CreateProduct(db, TestTables, Product{Name: "Beras 5kg", Price: 75000, Stock: 4})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	oil, err := CreateProduct(db, TestTables, Product{Name: "Minyak Goreng 1L", Price: 18000})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	order, err := CreatePurchaseOrder(db, TestTables, PurchaseOrder{
+		SupplierID: supplier.ID,
+		Note:       "Weekly restock",
+		Lines: []PurchaseOrderLine{
+			{ProductID: rice.ID, Quantity: 10, UnitCost: 60000},
+			{ProductID: oil.ID, Quantity: 24, UnitCost: 14000},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreatePurchaseOrder failed: %v", err)
+	}
+	if order.Status != PurchaseOrderDraft || len(order.Lines) != 2 || order.TotalCost != 10*60000+24*14000 {
+		t.Errorf("Unexpected purchase order: %+v", order)
+	}
+
+	_, err = ReceivePurchaseOrder(db, TestTables, order.ID, 0, []ReceiptLine{{ProductID: rice.ID, Quantity: 1}})
+	if err != ErrPurchaseOrderStatus {
+		t.Errorf("Expected ErrPurchaseOrderStatus for draft, got %v", err)
+	}
+
+	if _, err := OrderPurchaseOrder(db, TestTables, order.ID); err != nil {
+		t.Fatalf("OrderPurchaseOrder failed: %v", err)
+	}
+	_, err = UpdatePurchaseOrder(db, TestTables, PurchaseOrder{ID: order.ID, SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: rice.ID, Quantity: 1}}})
+	if err != ErrPurchaseOrderStatus {
+		t.Errorf("Expected ErrPurchaseOrderStatus updating an ordered purchase order, got %v", err)
+	}
+
+	order, err = ReceivePurchaseOrder(db, TestTables, order.ID, 0, []ReceiptLine{{ProductID: rice.ID, Quantity: 10}, {ProductID: oil.ID, Quantity: 12}})
+	if err != nil {
+		t.Fatalf("ReceivePurchaseOrder failed: %v", err)
+	}
+	if order.Status != PurchaseOrderPartiallyReceived || order.Lines[1].ReceivedQuantity != 12 {
+		t.Errorf("Expected partially received order, got %+v", order)
+	}
+
+	updated, err := GetProductByID(db, TestTables, rice.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 14 {
+		t.Errorf("Expected rice stock 14, got %d", updated.Stock)
+	}
+
+	page, err := GetStockHistory(db, "inventory_movement_test", "product_test", oil.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if m := page.Data[0]; m.Reason != MovementReceipt || m.Delta != 12 || m.Balance != 12 || m.ReferenceID != order.ID {
+		t.Errorf("Unexpected receipt movement: %+v", m)
+	}
+
+	_, err = ReceivePurchaseOrder(db, TestTables, order.ID, 0, []ReceiptLine{{ProductID: oil.ID, Quantity: 13}})
+	var receiptErr *ReceiptError
+	if !errors.As(err, &receiptErr) || receiptErr.Ordered != 24 || receiptErr.Received != 12 {
+		t.Errorf("Expected ReceiptError for over-receipt, got %v", err)
+	}
+	_, err = ReceivePurchaseOrder(db, TestTables, order.ID, 0, []ReceiptLine{{ProductID: 9999, Quantity: 1}})
+	if err != ErrInvalidReceipt {
+		t.Errorf("Expected ErrInvalidReceipt for product not on the order, got %v", err)
+	}
+	if _, err := CancelPurchaseOrder(db, TestTables, order.ID); err != ErrPurchaseOrderStatus {
+		t.Errorf("Expected ErrPurchaseOrderStatus cancelling a partially received order, got %v", err)
+	}
+
+	if err := DeleteProduct(db, TestTables, oil.ID, 0); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+	_, err = ReceivePurchaseOrder(db, TestTables, order.ID, 0, []ReceiptLine{{ProductID: oil.ID, Quantity: 12}})
+	if err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound receiving a deleted product, got %v", err)
+	}
+	if _, err := RestoreProduct(db, TestTables, oil.ID); err != nil {
+		t.Fatalf("RestoreProduct failed: %v", err)
+	}
+
+	order, err = ReceivePurchaseOrder(db, TestTables, order.ID, 0, []ReceiptLine{{ProductID: oil.ID, Quantity: 12}})
+	if err != nil {
+		t.Fatalf("ReceivePurchaseOrder failed: %v", err)
+	}
+	if order.Status != PurchaseOrderReceived {
+		t.Errorf("Expected received order, got %s", order.Status)
+	}
+}
+
+func TestPurchaseOrderValidation(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	supplier, err := CreateSupplier(db, "supplier_test", Supplier{Name: "CV Tani Jaya"})
+	if err != nil {
+		t.Fatalf("CreateSupplier failed: %v", err)
+	}
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Gula 1kg", Price: 16000})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	_, err = CreatePurchaseOrder(db, TestTables, PurchaseOrder{SupplierID: 9999, Lines: []PurchaseOrderLine{{ProductID: prod.ID, Quantity: 1}}})
+	if err != ErrSupplierNotFound {
+		t.Errorf("Expected ErrSupplierNotFound, got %v", err)
+	}
+	_, err = CreatePurchaseOrder(db, TestTables, PurchaseOrder{SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: prod.ID, Quantity: 1}, {ProductID: prod.ID, Quantity: 2}}})
+	if err != ErrInvalidPurchaseOrder {
+		t.Errorf("Expected ErrInvalidPurchaseOrder for duplicate product, got %v", err)
+	}
+	_, err = CreatePurchaseOrder(db, TestTables, PurchaseOrder{SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: 9999, Quantity: 1}}})
+	if err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+
+	order, err := CreatePurchaseOrder(db, TestTables, PurchaseOrder{SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: prod.ID, Quantity: 5, UnitCost: 12000}}})
+	if err != nil {
+		t.Fatalf("CreatePurchaseOrder failed: %v", err)
+	}
+	order, err = UpdatePurchaseOrder(db, TestTables, PurchaseOrder{ID: order.ID, SupplierID: supplier.ID, Note: "Bigger batch", Lines: []PurchaseOrderLine{{ProductID: prod.ID, Quantity: 8, UnitCost: 11500}}})
+	if err != nil {
+		t.Fatalf("UpdatePurchaseOrder failed: %v", err)
+	}
+	if len(order.Lines) != 1 || order.Lines[0].Quantity != 8 || order.Note != "Bigger batch" {
+		t.Errorf("Unexpected updated purchase order: %+v", order)
+	}
+
+	order, err = CancelPurchaseOrder(db, TestTables, order.ID)
+	if err != nil {
+		t.Fatalf("CancelPurchaseOrder failed: %v", err)
+	}
+	if order.Status != PurchaseOrderCancelled {
+		t.Errorf("Expected cancelled order, got %s", order.Status)
+	}
+	if _, err := OrderPurchaseOrder(db, TestTables, order.ID); err != ErrPurchaseOrderStatus {
+		t.Errorf("Expected ErrPurchaseOrderStatus ordering a cancelled order, got %v", err)
+	}
+	if _, err := OrderPurchaseOrder(db, TestTables, 9999); err != ErrPurchaseOrderNotFound {
+		t.Errorf("Expected ErrPurchaseOrderNotFound, got %v", err)
+	}
+
+	page, err := ListPurchaseOrders(db, TestTables, PurchaseOrderListParams{Status: PurchaseOrderCancelled})
+	if err != nil {
+		t.Fatalf("ListPurchaseOrders failed: %v", err)
+	}
+	if page.Total != 1 || page.Data[0].ID != order.ID || page.Data[0].TotalCost != 8*11500 {
+		t.Errorf("Unexpected purchase order list: %+v", page)
+	}
+}
@@ -2,12 +2,42 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 )
 
-// GetAll retrieves all categories from the database
+// ErrDuplicateProductCode is returned when a product SKU is already used by
+// another product, or a barcode by another product or variant
+var ErrDuplicateProductCode = errors.New("sku or barcode already in use")
+
+// ErrVersionMismatch is returned when a write expected a version other than the stored one
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// rowQuerier is implemented by *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// missingOrStale is called after a versioned write matched no row. It returns
+// ErrVersionMismatch if the active row exists (so only the version differed),
+// and notFound otherwise.
+func missingOrStale(q rowQuerier, tableName string, id int, notFound error) error {
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND deleted_at IS NULL)", tableName)
+	if err := q.QueryRow(query, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check version: %w", err)
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return notFound
+}
+
+// GetAll retrieves all categories that are not soft-deleted
 func GetAll(db *sql.DB, tableName string) ([]Category, error) {
-	query := fmt.Sprintf("SELECT id, name, description FROM %s", tableName)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE deleted_at IS NULL", categoryColumns, tableName)
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query categories: %w", err)
@@ -17,7 +47,7 @@ func GetAll(db *sql.DB, tableName string) ([]Category, error) {
 	var categories []Category
 	for rows.Next() {
 		var cat Category
-		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Description); err != nil {
+		if err := rows.Scan(cat.scanFields()...); err != nil {
 			return nil, fmt.Errorf("failed to scan category: %w", err)
 		}
 		categories = append(categories, cat)
@@ -30,70 +60,282 @@ func GetAll(db *sql.DB, tableName string) ([]Category, error) {
 	return categories, nil
 }
 
-// GetByID retrieves a category by ID from the database
+// ListCategories retrieves a page of categories ordered by params.Sort
+func ListCategories(db *sql.DB, tableName string, params CategoryListParams) (Page[Category], error) {
+	sortColumn := "id"
+	sortName := "id"
+	if params.Sort == "name" {
+		sortColumn = "name"
+		sortName = "name"
+	}
+	dir, op := sortDirection(params.Desc)
+	sortKey := sortName + ":" + dir
+
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !params.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+
+	page := Page[Category]{Data: []Category{}}
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", tableName, whereClause(conds))
+	if err := db.QueryRow(countQuery, args...).Scan(&page.Total); err != nil {
+		return Page[Category]{}, fmt.Errorf("failed to count categories: %w", err)
+	}
+
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor, sortKey)
+		if err != nil {
+			return Page[Category]{}, err
+		}
+		v, err := cursorValue(c, sortName == "id")
+		if err != nil {
+			return Page[Category]{}, err
+		}
+		conds = append(conds, fmt.Sprintf("(%s, id) %s (%s, %s)", sortColumn, op, arg(v), arg(c.ID)))
+	}
+
+	limit := normalizeLimit(params.Limit)
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, id %s LIMIT %s", categoryColumns, tableName, whereClause(conds), sortColumn, dir, dir, arg(limit+1))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Page[Category]{}, fmt.Errorf("failed to query categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cat Category
+		if err := rows.Scan(cat.scanFields()...); err != nil {
+			return Page[Category]{}, fmt.Errorf("failed to scan category: %w", err)
+		}
+		page.Data = append(page.Data, cat)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page[Category]{}, fmt.Errorf("error iterating categories: %w", err)
+	}
+
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		last := page.Data[limit-1]
+		value := strconv.Itoa(last.ID)
+		if sortName == "name" {
+			value = last.Name
+		}
+		page.NextCursor = encodeCursor(sortKey, value, last.ID)
+	}
+
+	return page, nil
+}
+
+// GetByID retrieves a category by ID from the database. Soft-deleted categories are not found.
 func GetByID(db *sql.DB, tableName string, id int) (Category, error) {
 	var cat Category
-	query := fmt.Sprintf("SELECT id, name, description FROM %s WHERE id = $1", tableName)
-	err := db.QueryRow(query, id).Scan(&cat.ID, &cat.Name, &cat.Description)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1 AND deleted_at IS NULL", categoryColumns, tableName)
+	err := db.QueryRow(query, id).Scan(cat.scanFields()...)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return Category{}, fmt.Errorf("category not found")
+			return Category{}, ErrCategoryNotFound
 		}
 		return Category{}, fmt.Errorf("failed to query category: %w", err)
 	}
 	return cat, nil
 }
 
-// Create inserts a new category into the database and returns the created category
-func Create(db *sql.DB, tableName string, name, description string) (Category, error) {
+// Create inserts a new category into the database and returns the created category.
+// description may be nil to store NULL, and parentID nil to create a top-level category.
+func Create(db *sql.DB, tableName string, name string, description *string, parentID *int) (Category, error) {
 	var cat Category
-	query := fmt.Sprintf("INSERT INTO %s (name, description) VALUES ($1, $2) RETURNING id, name, description", tableName)
-	err := db.QueryRow(query, name, description).Scan(&cat.ID, &cat.Name, &cat.Description)
+	query := fmt.Sprintf("INSERT INTO %s (name, description, parent_id) VALUES ($1, $2, $3) RETURNING %s", tableName, categoryColumns)
+	err := db.QueryRow(query, name, description, parentID).Scan(cat.scanFields()...)
 	if err != nil {
-		return Category{}, fmt.Errorf("failed to create category: %w", err)
+		if isForeignKeyViolation(err) {
+			return Category{}, ErrParentCategoryNotFound
+		}
+		return Category{}, fmt.Errorf("failed to create category: %w", translateError(err))
 	}
 	return cat, nil
 }
 
-// Update modifies an existing category in the database
-func Update(db *sql.DB, tableName string, id int, name, description string) (Category, error) {
+// Update modifies an existing category in the database and increments its version.
+// A nil description clears the stored one. Moving a category under itself or one of its descendants returns ErrCategoryCycle.
+// A non-zero expectedVersion must match the stored version or ErrVersionMismatch is returned.
+func Update(db *sql.DB, tableName string, id int, name string, description *string, parentID *int, expectedVersion int) (Category, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Category{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if parentID != nil {
+		if *parentID == id {
+			return Category{}, ErrCategoryCycle
+		}
+
+		// Serialize re-parenting so two concurrent moves cannot form a cycle together
+		_, err = tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", tableName))
+		if err != nil {
+			return Category{}, fmt.Errorf("failed to lock category table: %w", translateError(err))
+		}
+
+		var cycle bool
+		cycleQuery := fmt.Sprintf("SELECT $1 IN (%s)", categorySubtreeQuery(tableName, "$2"))
+		if err := tx.QueryRow(cycleQuery, *parentID, id).Scan(&cycle); err != nil {
+			return Category{}, fmt.Errorf("failed to check category hierarchy: %w", err)
+		}
+		if cycle {
+			return Category{}, ErrCategoryCycle
+		}
+	}
+
 	var cat Category
-	query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2 WHERE id = $3 RETURNING id, name, description", tableName)
-	err := db.QueryRow(query, name, description, id).Scan(&cat.ID, &cat.Name, &cat.Description)
+	query := fmt.Sprintf("UPDATE %s SET name = $1, description = $2, parent_id = $3, version = version + 1 WHERE id = $4 AND deleted_at IS NULL AND ($5 = 0 OR version = $5) RETURNING %s", tableName, categoryColumns)
+	err = tx.QueryRow(query, name, description, parentID, id, expectedVersion).Scan(cat.scanFields()...)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return Category{}, fmt.Errorf("category not found")
+			return Category{}, missingOrStale(tx, tableName, id, ErrCategoryNotFound)
+		}
+		if isForeignKeyViolation(err) {
+			return Category{}, ErrParentCategoryNotFound
 		}
-		return Category{}, fmt.Errorf("failed to update category: %w", err)
+		return Category{}, fmt.Errorf("failed to update category: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Category{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
 	}
 	return cat, nil
 }
 
-// Delete removes a category from the database
-func Delete(db *sql.DB, tableName string, id int) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", tableName)
-	result, err := db.Exec(query, id)
+// GetCategoryTree retrieves all categories nested under their parents.
+// Roots and children are ordered by name.
+func GetCategoryTree(db *sql.DB, tableName string) ([]*CategoryNode, error) {
+	categories, err := GetAll(db, tableName)
 	if err != nil {
-		return fmt.Errorf("failed to delete category: %w", err)
+		return nil, err
 	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Name != categories[j].Name {
+			return categories[i].Name < categories[j].Name
+		}
+		return categories[i].ID < categories[j].ID
+	})
 
-	rowsAffected, err := result.RowsAffected()
+	nodes := make(map[int]*CategoryNode, len(categories))
+	for _, cat := range categories {
+		nodes[cat.ID] = &CategoryNode{Category: cat, Children: []*CategoryNode{}}
+	}
+
+	roots := []*CategoryNode{}
+	for _, cat := range categories {
+		node := nodes[cat.ID]
+		if cat.ParentID != nil {
+			if parent, ok := nodes[*cat.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	return roots, nil
+}
+
+// Delete soft-deletes a category. A category that still has active products
+// or subcategories cannot be deleted and returns ErrCategoryInUse.
+// A non-zero expectedVersion must match the stored version or ErrVersionMismatch is returned.
+func Delete(db *sql.DB, tableName, productTableName string, id int, expectedVersion int) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("category not found")
+	// Locking the row blocks products and subcategories from being attached concurrently
+	var version int
+	lockQuery := fmt.Sprintf("SELECT version FROM %s WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", tableName)
+	if err := tx.QueryRow(lockQuery, id).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrCategoryNotFound
+		}
+		return fmt.Errorf("failed to delete category: %w", translateError(err))
+	}
+	if expectedVersion != 0 && expectedVersion != version {
+		return ErrVersionMismatch
+	}
+
+	var inUse bool
+	inUseQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE category_id = $1 AND deleted_at IS NULL) OR EXISTS (SELECT 1 FROM %s WHERE parent_id = $1 AND deleted_at IS NULL)", productTableName, tableName)
+	if err := tx.QueryRow(inUseQuery, id).Scan(&inUse); err != nil {
+		return fmt.Errorf("failed to check category usage: %w", err)
+	}
+	if inUse {
+		return ErrCategoryInUse
 	}
 
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at = NOW(), version = version + 1 WHERE id = $1", tableName), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
 	return nil
 }
 
+// RestoreCategory clears the soft deletion of a category and returns it.
+// A category whose parent is still deleted returns ErrCategoryDeleted.
+func RestoreCategory(db *sql.DB, tableName string, id int) (Category, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Category{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var parentID *int
+	lockQuery := fmt.Sprintf("SELECT parent_id FROM %s WHERE id = $1 FOR UPDATE", tableName)
+	if err := tx.QueryRow(lockQuery, id).Scan(&parentID); err != nil {
+		if err == sql.ErrNoRows {
+			return Category{}, ErrCategoryNotFound
+		}
+		return Category{}, fmt.Errorf("failed to query category: %w", err)
+	}
+
+	// The share lock keeps the parent from being deleted until the restore commits
+	if parentID != nil {
+		var parentDeleted bool
+		parentQuery := fmt.Sprintf("SELECT deleted_at IS NOT NULL FROM %s WHERE id = $1 FOR SHARE", tableName)
+		if err := tx.QueryRow(parentQuery, *parentID).Scan(&parentDeleted); err != nil {
+			return Category{}, fmt.Errorf("failed to query parent category: %w", err)
+		}
+		if parentDeleted {
+			return Category{}, ErrCategoryDeleted
+		}
+	}
+
+	var cat Category
+	query := fmt.Sprintf("UPDATE %s SET deleted_at = NULL, version = version + 1 WHERE id = $1 RETURNING %s", tableName, categoryColumns)
+	if err := tx.QueryRow(query, id).Scan(cat.scanFields()...); err != nil {
+		return Category{}, fmt.Errorf("failed to restore category: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Category{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return cat, nil
+}
+
 // Product queries
 
 // GetAllProducts retrieves all products with category info
-func GetAllProducts(db *sql.DB, tableName, categoryTableName string) ([]Product, error) {
-	query := fmt.Sprintf(`SELECT p.id, p.name, p.price, p.stock, p.category_id, COALESCE(c.name, ''), COALESCE(c.description, '') FROM %s p LEFT JOIN %s c ON p.category_id = c.id`, tableName, categoryTableName)
+func GetAllProducts(db *sql.DB, tables Tables) ([]Product, error) {
+	query := fmt.Sprintf(productSelect+" WHERE p.deleted_at IS NULL", tables.Product, tables.Category)
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query products: %w", err)
@@ -103,7 +345,7 @@ func GetAllProducts(db *sql.DB, tableName, categoryTableName string) ([]Product,
 	var products []Product
 	for rows.Next() {
 		var p Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID, &p.CategoryName, &p.CategoryDescription); err != nil {
+		if err := rows.Scan(p.scanFieldsWithCategory()...); err != nil {
 			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
 		products = append(products, p)
@@ -116,69 +358,324 @@ func GetAllProducts(db *sql.DB, tableName, categoryTableName string) ([]Product,
 	return products, nil
 }
 
-// GetProductByID retrieves a product by ID with category info
-func GetProductByID(db *sql.DB, tableName, categoryTableName string, id int) (Product, error) {
+// ListProducts retrieves a page of products with category info and their stock
+// per outlet, applying the filters, sort order and cursor from params. With
+// params.OutletID set, the stock, in_stock filter and stock sort use the stock
+// at that outlet.
+func ListProducts(db *sql.DB, tables Tables, params ProductListParams) (Page[Product], error) {
+	sortName := params.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+	sortColumn, ok := productSortColumns[sortName]
+	if !ok {
+		return Page[Product]{}, ErrInvalidSort
+	}
+	dir, op := sortDirection(params.Desc)
+	sortKey := sortName + ":" + dir
+
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	stockColumn := func() string {
+		if params.OutletID == 0 {
+			return "p.stock"
+		}
+		return fmt.Sprintf("COALESCE((SELECT s.quantity FROM %s s WHERE s.outlet_id = %s AND s.product_id = p.id AND s.variant_id = 0), 0)", tables.OutletStock, arg(params.OutletID))
+	}
+
+	if !params.IncludeDeleted {
+		conds = append(conds, "p.deleted_at IS NULL")
+	}
+	if params.CategoryID != 0 {
+		conds = append(conds, fmt.Sprintf("p.category_id IN (%s)", categorySubtreeQuery(tables.Category, arg(params.CategoryID))))
+	}
+	if params.MinPrice != nil {
+		conds = append(conds, "p.price >= "+arg(*params.MinPrice))
+	}
+	if params.MaxPrice != nil {
+		conds = append(conds, "p.price <= "+arg(*params.MaxPrice))
+	}
+	if params.InStock != nil {
+		if *params.InStock {
+			conds = append(conds, stockColumn()+" > 0")
+		} else {
+			conds = append(conds, stockColumn()+" <= 0")
+		}
+	}
+
+	page := Page[Product]{Data: []Product{}}
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s p%s", tables.Product, whereClause(conds))
+	if err := db.QueryRow(countQuery, args...).Scan(&page.Total); err != nil {
+		return Page[Product]{}, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	if sortName == "stock" {
+		sortColumn = stockColumn()
+	}
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor, sortKey)
+		if err != nil {
+			return Page[Product]{}, err
+		}
+		v, err := cursorValue(c, sortName != "name")
+		if err != nil {
+			return Page[Product]{}, err
+		}
+		conds = append(conds, fmt.Sprintf("(%s, p.id) %s (%s, %s)", sortColumn, op, arg(v), arg(c.ID)))
+	}
+
+	limit := normalizeLimit(params.Limit)
+	query := fmt.Sprintf(productSelect+"%s ORDER BY %s %s, p.id %s LIMIT %s", tables.Product, tables.Category, whereClause(conds), sortColumn, dir, dir, arg(limit+1))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Page[Product]{}, fmt.Errorf("failed to query products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(p.scanFieldsWithCategory()...); err != nil {
+			return Page[Product]{}, fmt.Errorf("failed to scan product: %w", err)
+		}
+		page.Data = append(page.Data, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page[Product]{}, fmt.Errorf("error iterating products: %w", err)
+	}
+
+	hasMore := len(page.Data) > limit
+	if hasMore {
+		page.Data = page.Data[:limit]
+	}
+	if err := loadOutletStock(db, tables.OutletStock, page.Data, params.OutletID); err != nil {
+		return Page[Product]{}, err
+	}
+
+	if hasMore {
+		last := page.Data[limit-1]
+		var value string
+		switch sortName {
+		case "name":
+			value = last.Name
+		case "price":
+			value = strconv.Itoa(last.Price)
+		case "stock":
+			value = strconv.Itoa(last.Stock)
+		default:
+			value = strconv.Itoa(last.ID)
+		}
+		page.NextCursor = encodeCursor(sortKey, value, last.ID)
+	}
+
+	return page, nil
+}
+
+// GetProductByID retrieves a product by ID with category info. Soft-deleted products are not found.
+func GetProductByID(db *sql.DB, tables Tables, id int) (Product, error) {
 	var p Product
-	query := fmt.Sprintf(`SELECT p.id, p.name, p.price, p.stock, p.category_id, COALESCE(c.name, ''), COALESCE(c.description, '') FROM %s p LEFT JOIN %s c ON p.category_id = c.id WHERE p.id = $1`, tableName, categoryTableName)
-	err := db.QueryRow(query, id).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID, &p.CategoryName, &p.CategoryDescription)
+	query := fmt.Sprintf(productSelect+" WHERE p.id = $1 AND p.deleted_at IS NULL", tables.Product, tables.Category)
+	err := db.QueryRow(query, id).Scan(p.scanFieldsWithCategory()...)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return Product{}, fmt.Errorf("product not found")
+			return Product{}, ErrProductNotFound
 		}
 		return Product{}, fmt.Errorf("failed to query product: %w", err)
 	}
 	return p, nil
 }
 
-// CreateProduct inserts a new product into the database and returns it
-func CreateProduct(db *sql.DB, tableName, categoryTableName string, name string, price, stock, categoryID int) (Product, error) {
+// GetProductByBarcode retrieves a product by its barcode with category info
+func GetProductByBarcode(db *sql.DB, tables Tables, barcode string) (Product, error) {
 	var p Product
-	query := fmt.Sprintf("INSERT INTO %s (name, price, stock, category_id) VALUES ($1, $2, $3, $4) RETURNING id, name, price, stock, category_id", tableName)
-	err := db.QueryRow(query, name, price, stock, categoryID).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID)
+	query := fmt.Sprintf(productSelect+" WHERE p.barcode = $1 AND p.deleted_at IS NULL", tables.Product, tables.Category)
+	err := db.QueryRow(query, barcode).Scan(p.scanFieldsWithCategory()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Product{}, ErrProductNotFound
+		}
+		return Product{}, fmt.Errorf("failed to query product: %w", err)
+	}
+	return p, nil
+}
+
+// CreateProduct inserts the name, price, stock, category, codes and reorder
+// settings of p as a new product and returns it. An empty SKU or barcode is
+// stored as NULL; a barcode already used by a product or variant returns
+// ErrDuplicateProductCode. The opening stock is placed at the default outlet
+// and recorded in the stock history.
+func CreateProduct(db *sql.DB, tables Tables, p Product) (Product, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Product{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("INSERT INTO %s AS p (name, price, stock, category_id, sku, barcode, reorder_point, reorder_qty) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8) RETURNING "+productColumns, tables.Product)
+	err = tx.QueryRow(query, p.Name, p.Price, p.Stock, p.CategoryID, p.SKU, p.Barcode, p.ReorderPoint, p.ReorderQty).Scan(p.scanFields()...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return Product{}, ErrDuplicateProductCode
+		}
+		return Product{}, fmt.Errorf("failed to create product: %w", translateError(err))
+	}
+
+	if _, err := changeOutletStock(tx, tables.OutletStock, DefaultOutletID, p.ID, 0, p.Stock); err != nil {
+		return Product{}, err
+	}
+
+	err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: p.ID, Delta: p.Stock, Balance: p.Stock, Reason: MovementManualEdit})
 	if err != nil {
-		return Product{}, fmt.Errorf("failed to create product: %w", err)
+		return Product{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Product{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
 	}
+
 	// load category info
 	if p.CategoryID != 0 {
-		cat, _ := GetByID(db, categoryTableName, p.CategoryID)
+		cat, _ := GetByID(db, tables.Category, p.CategoryID)
 		p.CategoryName = cat.Name
-		p.CategoryDescription = cat.Description
+		if cat.Description != nil {
+			p.CategoryDescription = *cat.Description
+		}
 	}
 	return p, nil
 }
 
-// UpdateProduct updates an existing product and returns it
-func UpdateProduct(db *sql.DB, tableName, categoryTableName string, id int, name string, price, stock, categoryID int) (Product, error) {
-	var p Product
-	query := fmt.Sprintf("UPDATE %s SET name = $1, price = $2, stock = $3, category_id = $4 WHERE id = $5 RETURNING id, name, price, stock, category_id", tableName)
-	err := db.QueryRow(query, name, price, stock, categoryID, id).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID)
+// UpdateProduct replaces the name, price, stock, category, codes and reorder
+// settings of product p.ID, increments its version and returns it. An empty
+// SKU or barcode clears the stored value; a barcode already used by another
+// product or variant returns ErrDuplicateProductCode. A non-zero
+// expectedVersion must match the stored version or ErrVersionMismatch is
+// returned. A change of stock is applied to the default outlet and recorded in
+// the stock history; lowering the stock below what the other outlets hold
+// returns a *StockError. A decrease is taken from the default outlet's lots
+// first-expired-first-out.
+func UpdateProduct(db *sql.DB, tables Tables, p Product, expectedVersion int) (Product, error) {
+	tx, err := db.Begin()
 	if err != nil {
+		return Product{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the row so the recorded delta matches the stock being replaced
+	var oldStock int
+	lockQuery := fmt.Sprintf("SELECT stock FROM %s WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", tables.Product)
+	if err := tx.QueryRow(lockQuery, p.ID).Scan(&oldStock); err != nil {
 		if err == sql.ErrNoRows {
-			return Product{}, fmt.Errorf("product not found")
+			return Product{}, ErrProductNotFound
 		}
-		return Product{}, fmt.Errorf("failed to update product: %w", err)
+		return Product{}, fmt.Errorf("failed to query product: %w", translateError(err))
 	}
+
+	query := fmt.Sprintf("UPDATE %s AS p SET name = $1, price = $2, stock = $3, category_id = $4, sku = NULLIF($5, ''), barcode = NULLIF($6, ''), reorder_point = $7, reorder_qty = $8, version = version + 1 WHERE id = $9 AND deleted_at IS NULL AND ($10 = 0 OR version = $10) RETURNING "+productColumns, tables.Product)
+	err = tx.QueryRow(query, p.Name, p.Price, p.Stock, p.CategoryID, p.SKU, p.Barcode, p.ReorderPoint, p.ReorderQty, p.ID, expectedVersion).Scan(p.scanFields()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Product{}, missingOrStale(tx, tables.Product, p.ID, ErrProductNotFound)
+		}
+		if isUniqueViolation(err) {
+			return Product{}, ErrDuplicateProductCode
+		}
+		return Product{}, fmt.Errorf("failed to update product: %w", translateError(err))
+	}
+
+	if _, err := changeOutletStock(tx, tables.OutletStock, DefaultOutletID, p.ID, 0, p.Stock-oldStock); err != nil {
+		return Product{}, err
+	}
+	if p.Stock < oldStock {
+		if _, err := takeLots(tx, tables.Lot, DefaultOutletID, p.ID, 0, oldStock-p.Stock); err != nil {
+			return Product{}, err
+		}
+	}
+
+	err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: p.ID, Delta: p.Stock - oldStock, Balance: p.Stock, Reason: MovementManualEdit})
+	if err != nil {
+		return Product{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Product{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+
 	if p.CategoryID != 0 {
-		cat, _ := GetByID(db, categoryTableName, p.CategoryID)
+		cat, _ := GetByID(db, tables.Category, p.CategoryID)
 		p.CategoryName = cat.Name
-		p.CategoryDescription = cat.Description
+		if cat.Description != nil {
+			p.CategoryDescription = *cat.Description
+		}
 	}
 	return p, nil
 }
 
-// DeleteProduct removes a product
-func DeleteProduct(db *sql.DB, tableName string, id int) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", tableName)
-	result, err := db.Exec(query, id)
+// DeleteProduct soft-deletes a product. Its SKU and barcode stay reserved so it can be restored.
+// A non-zero expectedVersion must match the stored version or ErrVersionMismatch is returned.
+func DeleteProduct(db *sql.DB, tables Tables, id int, expectedVersion int) error {
+	query := fmt.Sprintf("UPDATE %s SET deleted_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)", tables.Product)
+	result, err := db.Exec(query, id, expectedVersion)
 	if err != nil {
-		return fmt.Errorf("failed to delete product: %w", err)
+		return fmt.Errorf("failed to delete product: %w", translateError(err))
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("product not found")
+		return missingOrStale(db, tables.Product, id, ErrProductNotFound)
 	}
 	return nil
 }
+
+// RestoreProduct clears the soft deletion of a product and returns it.
+// A product whose category is still deleted returns ErrCategoryDeleted.
+func RestoreProduct(db *sql.DB, tables Tables, id int) (Product, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Product{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var categoryID int
+	lockQuery := fmt.Sprintf("SELECT COALESCE(category_id, 0) FROM %s WHERE id = $1 FOR UPDATE", tables.Product)
+	if err := tx.QueryRow(lockQuery, id).Scan(&categoryID); err != nil {
+		if err == sql.ErrNoRows {
+			return Product{}, ErrProductNotFound
+		}
+		return Product{}, fmt.Errorf("failed to query product: %w", err)
+	}
+
+	// The share lock keeps the category from being deleted until the restore commits
+	if categoryID != 0 {
+		var categoryDeleted bool
+		categoryQuery := fmt.Sprintf("SELECT deleted_at IS NOT NULL FROM %s WHERE id = $1 FOR SHARE", tables.Category)
+		err := tx.QueryRow(categoryQuery, categoryID).Scan(&categoryDeleted)
+		if err != nil && err != sql.ErrNoRows {
+			return Product{}, fmt.Errorf("failed to query category: %w", err)
+		}
+		if categoryDeleted {
+			return Product{}, ErrCategoryDeleted
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at = NULL, version = version + 1 WHERE id = $1", tables.Product), id)
+	if err != nil {
+		return Product{}, fmt.Errorf("failed to restore product: %w", translateError(err))
+	}
+
+	var p Product
+	query := fmt.Sprintf(productSelect+" WHERE p.id = $1", tables.Product, tables.Category)
+	if err := tx.QueryRow(query, id).Scan(p.scanFieldsWithCategory()...); err != nil {
+		return Product{}, fmt.Errorf("failed to query product: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Product{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return p, nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// GetLowStockProducts retrieves the products that are not deleted and whose
+// stock is at or below their reorder point, most short first. Products with
+// a reorder point of 0 are never low on stock.
+func GetLowStockProducts(db *sql.DB, tables Tables) ([]Product, error) {
+	query := fmt.Sprintf(productSelect+" WHERE p.deleted_at IS NULL AND p.reorder_point > 0 AND p.stock <= p.reorder_point ORDER BY p.stock - p.reorder_point, p.id", tables.Product, tables.Category)
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(p.scanFieldsWithCategory()...); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating products: %w", err)
+	}
+
+	return products, nil
+}
+
+// ReorderParams controls reorder suggestions. Sales velocity is measured
+// over the WindowDays days before Now, and stock must last the LeadDays days
+// an order takes to arrive.
+type ReorderParams struct {
+	WindowDays int
+	LeadDays   int
+	Now        time.Time
+}
+
+// ReorderItem is a suggested order of a product. DailySales is the average
+// quantity sold per day over the window and DaysUntilStockout the days the
+// current stock lasts at that rate, nil when nothing was sold. UnitCost is
+// the cost on the supplier's latest purchase order line for the product.
+type ReorderItem struct {
+	ProductID         int      `json:"product_id"`
+	ProductName       string   `json:"product_name"`
+	Stock             int      `json:"stock"`
+	ReorderPoint      int      `json:"reorder_point"`
+	ReorderQty        int      `json:"reorder_qty"`
+	Sold              int      `json:"sold"`
+	DailySales        float64  `json:"daily_sales"`
+	DaysUntilStockout *float64 `json:"days_until_stockout"`
+	SuggestedQuantity int      `json:"suggested_quantity"`
+	UnitCost          int      `json:"unit_cost"`
+}
+
+// SupplierReorder groups the suggested orders of one supplier. Products that
+// have never been on a purchase order are grouped under SupplierID 0.
+type SupplierReorder struct {
+	SupplierID   int           `json:"supplier_id"`
+	SupplierName string        `json:"supplier_name"`
+	TotalCost    int           `json:"total_cost"`
+	Items        []ReorderItem `json:"items"`
+}
+
+// GetReorderSuggestions suggests what to order for every product that is not
+// deleted and whose stock, less the sales expected during the lead time, is
+// at or below its reorder point. Products without a reorder point are only
+// suggested when they sold in the window and would run out during the lead
+// time. The suggested quantity brings the projected stock back up to the
+// reorder point, with a minimum of 1, rounded up to a multiple of the reorder
+// quantity. Suggestions are grouped by the supplier of the latest purchase
+// order for the product that is not cancelled.
+func GetReorderSuggestions(db *sql.DB, tables Tables, params ReorderParams) ([]SupplierReorder, error) {
+	since := params.Now.AddDate(0, 0, -params.WindowDays)
+	query := fmt.Sprintf(`
+	SELECT p.id, p.name, p.stock, p.reorder_point, p.reorder_qty, COALESCE(s.sold, 0),
+		COALESCE(l.supplier_id, 0), COALESCE(l.supplier_name, ''), COALESCE(l.unit_cost, 0)
+	FROM %[1]s p
+	LEFT JOIN (
+		SELECT d.product_id, SUM(d.quantity) AS sold
+		FROM %[2]s d JOIN %[3]s t ON d.transaction_id = t.id
+		WHERE t.created_at >= $1 AND t.created_at < $2 AND t.voided_at IS NULL
+		GROUP BY d.product_id
+	) s ON s.product_id = p.id
+	LEFT JOIN LATERAL (
+		SELECT o.supplier_id, su.name AS supplier_name, pl.unit_cost
+		FROM %[4]s pl JOIN %[5]s o ON pl.purchase_order_id = o.id JOIN %[6]s su ON o.supplier_id = su.id
+		WHERE pl.product_id = p.id AND o.status <> $3
+		ORDER BY o.created_at DESC, o.id DESC
+		LIMIT 1
+	) l ON true
+	WHERE p.deleted_at IS NULL AND (p.reorder_point > 0 OR s.sold > 0)
+	ORDER BY p.id`, tables.Product, tables.TransactionDetail, tables.Transaction, tables.PurchaseOrderLine, tables.PurchaseOrder, tables.Supplier)
+
+	rows, err := db.Query(query, since, params.Now, PurchaseOrderCancelled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reorder candidates: %w", err)
+	}
+	defer rows.Close()
+
+	suppliers := []SupplierReorder{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var item ReorderItem
+		var supplierID int
+		var supplierName string
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.Stock, &item.ReorderPoint, &item.ReorderQty, &item.Sold, &supplierID, &supplierName, &item.UnitCost); err != nil {
+			return nil, fmt.Errorf("failed to scan reorder candidate: %w", err)
+		}
+		if !suggestReorder(&item, params) {
+			continue
+		}
+
+		i, ok := index[supplierID]
+		if !ok {
+			i = len(suppliers)
+			index[supplierID] = i
+			suppliers = append(suppliers, SupplierReorder{SupplierID: supplierID, SupplierName: supplierName})
+		}
+		suppliers[i].Items = append(suppliers[i].Items, item)
+		suppliers[i].TotalCost += item.SuggestedQuantity * item.UnitCost
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reorder candidates: %w", err)
+	}
+
+	return suppliers, nil
+}
+
+// suggestReorder fills in the sales velocity and suggested quantity of item
+// and reports whether the product needs ordering
+func suggestReorder(item *ReorderItem, params ReorderParams) bool {
+	rate := float64(item.Sold) / float64(params.WindowDays)
+	item.DailySales = math.Round(rate*100) / 100
+	if rate > 0 {
+		days := math.Max(0, math.Round(float64(item.Stock)/rate*10)/10)
+		item.DaysUntilStockout = &days
+	}
+
+	projected := item.Stock - int(math.Ceil(rate*float64(params.LeadDays)))
+	if projected > item.ReorderPoint {
+		return false
+	}
+	quantity := max(item.ReorderPoint-projected, 1)
+	if item.ReorderQty > 0 {
+		quantity = (quantity + item.ReorderQty - 1) / item.ReorderQty * item.ReorderQty
+	}
+	item.SuggestedQuantity = quantity
+	return true
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSuggestReorder tests the projected stock and order rounding of reorder suggestions
+func TestSuggestReorder(t *testing.T) {
+	params := ReorderParams{WindowDays: 30, LeadDays: 7}
+	cases := []struct {
+		name     string
+		item     ReorderItem
+		suggest  bool
+		quantity int
+	}{
+		{"above reorder point without sales", ReorderItem{Stock: 20, ReorderPoint: 10}, false, 0},
+		{"at reorder point", ReorderItem{Stock: 10, ReorderPoint: 10}, true, 1},
+		{"rounded to reorder qty", ReorderItem{Stock: 4, ReorderPoint: 10, ReorderQty: 12}, true, 12},
+		{"sales during lead time", ReorderItem{Stock: 20, ReorderPoint: 10, Sold: 60}, true, 4},
+		{"two packs", ReorderItem{Stock: 20, ReorderPoint: 10, ReorderQty: 3, Sold: 60}, true, 6},
+		{"no reorder point, lasts", ReorderItem{Stock: 20, Sold: 30}, false, 0},
+		{"no reorder point, runs out", ReorderItem{Stock: 5, Sold: 30}, true, 2},
+	}
+
+	for _, tc := range cases {
+		item := tc.item
+		if got := suggestReorder(&item, params); got != tc.suggest || item.SuggestedQuantity != tc.quantity {
+			t.Errorf("%s: suggestReorder = %v with %d, want %v with %d", tc.name, got, item.SuggestedQuantity, tc.suggest, tc.quantity)
+		}
+	}
+
+	item := ReorderItem{Stock: 5, Sold: 30}
+	suggestReorder(&item, params)
+	if item.DailySales != 1 || item.DaysUntilStockout == nil || *item.DaysUntilStockout != 5 {
+		t.Errorf("Unexpected velocity: %+v", item)
+	}
+}
+
+func TestReorderSuggestionsBySupplier(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	supplier, err := CreateSupplier(db, "supplier_test", Supplier{Name: "PT Sumber Makmur"})
+	if err != nil {
+		t.Fatalf("CreateSupplier failed: %v", err)
+	}
+	water, err := CreateProduct(db, TestTables, Product{Name: "Air Mineral", Price: 3000, Stock: 30, ReorderPoint: 10, ReorderQty: 24})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	candy, err := CreateProduct(db, TestTables, Product{Name: "Permen", Price: 500, Stock: 3, ReorderPoint: 5})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := CreateProduct(db, TestTables, Product{Name: "Gula 1kg", Price: 16000, Stock: 50, ReorderPoint: 10}); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := CreatePurchaseOrder(db, TestTables, PurchaseOrder{SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: water.ID, Quantity: 24, UnitCost: 2000}}}); err != nil {
+		t.Fatalf("CreatePurchaseOrder failed: %v", err)
+	}
+
+	low, err := GetLowStockProducts(db, TestTables)
+	if err != nil {
+		t.Fatalf("GetLowStockProducts failed: %v", err)
+	}
+	if len(low) != 1 || low[0].ID != candy.ID {
+		t.Errorf("Expected only the candy to be low on stock, got %+v", low)
+	}
+
+	// 18 sold leaves 12, and the 5 expected to sell during the lead time take
+	// it below the reorder point
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: water.ID, Quantity: 18}}, nil); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	suppliers, err := GetReorderSuggestions(db, TestTables, ReorderParams{WindowDays: 30, LeadDays: 7, Now: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("GetReorderSuggestions failed: %v", err)
+	}
+	if len(suppliers) != 2 {
+		t.Fatalf("Expected suggestions for the supplier and for products without one, got %+v", suppliers)
+	}
+	if s := suppliers[0]; s.SupplierID != supplier.ID || len(s.Items) != 1 || s.Items[0].SuggestedQuantity != 24 || s.TotalCost != 24*2000 {
+		t.Errorf("Unexpected supplier suggestion: %+v", s)
+	}
+	if s := suppliers[1]; s.SupplierID != 0 || len(s.Items) != 1 || s.Items[0].ProductID != candy.ID || s.Items[0].SuggestedQuantity != 2 {
+		t.Errorf("Unexpected suggestion without supplier: %+v", s)
+	}
+}
@@ -14,27 +14,47 @@ type ReportTopProduct struct {
 }
 
 // ReportSummary represents revenue and transaction aggregates.
+// TotalRevenue is net of TotalRetur, the refunds of returns.
 type ReportSummary struct {
 	TotalRevenue   int              `json:"total_revenue"`
 	TotalTransaksi int              `json:"total_transaksi"`
+	TotalRetur     int              `json:"total_retur"`
 	ProdukTerlaris ReportTopProduct `json:"produk_terlaris"`
 }
 
 // GetReportBetween aggregates revenue, transaction count, and top product within a date range.
 // Range is [start, end), so pass end as the next day for inclusive end-date.
-func GetReportBetween(db *sql.DB, transactionTable, transactionDetailTable string, start, end time.Time) (ReportSummary, error) {
+// A non-zero outletID only counts the transactions of that outlet.
+// Returns made within the range count as negative revenue and reduce the
+// quantity sold of the top product, whenever the sale was made. Voided
+// transactions are left out.
+func GetReportBetween(db *sql.DB, tables Tables, start, end time.Time, outletID int) (ReportSummary, error) {
 	summary := ReportSummary{}
 
-	aggQuery := fmt.Sprintf("SELECT COALESCE(SUM(total_amount), 0), COUNT(*) FROM %s WHERE created_at >= $1 AND created_at < $2", transactionTable)
-	err := db.QueryRow(aggQuery, start, end).Scan(&summary.TotalRevenue, &summary.TotalTransaksi)
+	aggQuery := fmt.Sprintf("SELECT COALESCE(SUM(total_amount), 0), COUNT(*) FROM %s WHERE created_at >= $1 AND created_at < $2 AND ($3 = 0 OR outlet_id = $3) AND voided_at IS NULL", tables.Transaction)
+	err := db.QueryRow(aggQuery, start, end, outletID).Scan(&summary.TotalRevenue, &summary.TotalTransaksi)
 	if err != nil {
 		return ReportSummary{}, fmt.Errorf("failed to aggregate transactions: %w", err)
 	}
 
-	topQuery := fmt.Sprintf("SELECT product_name, COALESCE(SUM(quantity),0) FROM %s d JOIN %s t ON d.transaction_id = t.id WHERE t.created_at >= $1 AND t.created_at < $2 GROUP BY product_name ORDER BY SUM(quantity) DESC LIMIT 1", transactionDetailTable, transactionTable)
+	returnQuery := fmt.Sprintf("SELECT COALESCE(SUM(r.refund_amount), 0) FROM %s r JOIN %s t ON r.transaction_id = t.id WHERE r.created_at >= $1 AND r.created_at < $2 AND ($3 = 0 OR t.outlet_id = $3)", tables.Return, tables.Transaction)
+	err = db.QueryRow(returnQuery, start, end, outletID).Scan(&summary.TotalRetur)
+	if err != nil {
+		return ReportSummary{}, fmt.Errorf("failed to aggregate returns: %w", err)
+	}
+	summary.TotalRevenue -= summary.TotalRetur
+
+	topQuery := fmt.Sprintf(`
+	SELECT product_name, SUM(quantity) FROM (
+		SELECT d.product_name, d.quantity FROM %[1]s d JOIN %[2]s t ON d.transaction_id = t.id
+		WHERE t.created_at >= $1 AND t.created_at < $2 AND ($3 = 0 OR t.outlet_id = $3) AND t.voided_at IS NULL
+		UNION ALL
+		SELECT d.product_name, -rl.quantity FROM %[3]s rl JOIN %[4]s r ON rl.return_id = r.id JOIN %[1]s d ON rl.transaction_detail_id = d.id JOIN %[2]s t ON r.transaction_id = t.id
+		WHERE r.created_at >= $1 AND r.created_at < $2 AND ($3 = 0 OR t.outlet_id = $3)
+	) sales GROUP BY product_name ORDER BY SUM(quantity) DESC LIMIT 1`, tables.TransactionDetail, tables.Transaction, tables.ReturnLine, tables.Return)
 	var topName sql.NullString
 	var topQty sql.NullInt64
-	err = db.QueryRow(topQuery, start, end).Scan(&topName, &topQty)
+	err = db.QueryRow(topQuery, start, end, outletID).Scan(&topName, &topQty)
 	if err != nil && err != sql.ErrNoRows {
 		return ReportSummary{}, fmt.Errorf("failed to aggregate top product: %w", err)
 	}
@@ -47,8 +67,78 @@ func GetReportBetween(db *sql.DB, transactionTable, transactionDetailTable strin
 }
 
 // GetReportToday aggregates report for the given day based on UTC date boundaries.
-func GetReportToday(db *sql.DB, transactionTable, transactionDetailTable string, day time.Time) (ReportSummary, error) {
+// A non-zero outletID only counts the transactions of that outlet.
+func GetReportToday(db *sql.DB, tables Tables, day time.Time, outletID int) (ReportSummary, error) {
 	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
 	end := start.AddDate(0, 0, 1)
-	return GetReportBetween(db, transactionTable, transactionDetailTable, start, end)
+	return GetReportBetween(db, tables, start, end, outletID)
+}
+
+// CategorySales is the sales total of a category, rolled up over all of its subcategories.
+type CategorySales struct {
+	CategoryID int    `json:"category_id"`
+	Name       string `json:"name"`
+	ParentID   *int   `json:"parent_id"`
+	Revenue    int    `json:"revenue"`
+	Quantity   int    `json:"quantity"`
+}
+
+// GetCategorySalesBetween aggregates revenue and quantity per category within [start, end).
+// Each category's totals include sales of products in its descendant categories.
+// Sales are attributed to the category the product had at checkout; older details
+// without that snapshot fall back to the product's current category.
+// A non-zero outletID only counts the sales of that outlet. Returns made
+// within the range are subtracted and voided transactions left out like in
+// GetReportBetween.
+func GetCategorySalesBetween(db *sql.DB, tables Tables, start, end time.Time, outletID int) ([]CategorySales, error) {
+	query := fmt.Sprintf(`
+	WITH RECURSIVE closure AS (
+		SELECT id AS ancestor_id, id AS category_id FROM %[1]s
+		UNION ALL
+		SELECT cl.ancestor_id, c.id FROM %[1]s c JOIN closure cl ON c.parent_id = cl.category_id
+	), lines AS (
+		SELECT d.category_id, d.product_id, d.subtotal, d.quantity
+		FROM %[2]s d
+		JOIN %[3]s t ON d.transaction_id = t.id
+		WHERE t.created_at >= $1 AND t.created_at < $2 AND ($3 = 0 OR t.outlet_id = $3) AND t.voided_at IS NULL
+		UNION ALL
+		SELECT d.category_id, d.product_id, -rl.subtotal, -rl.quantity
+		FROM %[5]s rl
+		JOIN %[6]s r ON rl.return_id = r.id
+		JOIN %[2]s d ON rl.transaction_detail_id = d.id
+		JOIN %[3]s t ON r.transaction_id = t.id
+		WHERE r.created_at >= $1 AND r.created_at < $2 AND ($3 = 0 OR t.outlet_id = $3)
+	), sales AS (
+		SELECT COALESCE(l.category_id, p.category_id) AS category_id, SUM(l.subtotal) AS revenue, SUM(l.quantity) AS quantity
+		FROM lines l
+		LEFT JOIN %[4]s p ON l.product_id = p.id
+		GROUP BY 1
+	)
+	SELECT c.id, c.name, c.parent_id, COALESCE(SUM(s.revenue), 0), COALESCE(SUM(s.quantity), 0)
+	FROM %[1]s c
+	JOIN closure cl ON cl.ancestor_id = c.id
+	LEFT JOIN sales s ON s.category_id = cl.category_id
+	GROUP BY c.id, c.name, c.parent_id
+	ORDER BY c.id`, tables.Category, tables.TransactionDetail, tables.Transaction, tables.Product, tables.ReturnLine, tables.Return)
+
+	rows, err := db.Query(query, start, end, outletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate category sales: %w", err)
+	}
+	defer rows.Close()
+
+	sales := []CategorySales{}
+	for rows.Next() {
+		var cs CategorySales
+		if err := rows.Scan(&cs.CategoryID, &cs.Name, &cs.ParentID, &cs.Revenue, &cs.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan category sales: %w", err)
+		}
+		sales = append(sales, cs)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating category sales: %w", err)
+	}
+
+	return sales, nil
 }
@@ -10,16 +10,16 @@ func TestGetReportBetween(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Food", "Food category")
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod1, err := CreateProduct(db, "product_test", "category_test", "Indomie Goreng", 5000, 100, cat.ID)
+	prod1, err := CreateProduct(db, TestTables, Product{Name: "Indomie Goreng", Price: 5000, Stock: 100, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
-	prod2, err := CreateProduct(db, "product_test", "category_test", "Teh Botol", 3000, 100, cat.ID)
+	prod2, err := CreateProduct(db, TestTables, Product{Name: "Teh Botol", Price: 3000, Stock: 100, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
@@ -44,7 +44,7 @@ func TestGetReportBetween(t *testing.T) {
 		{ProductID: prod1.ID, ProductName: prod1.Name, Quantity: 1, Subtotal: 9999},
 	})
 
-	summary, err := GetReportBetween(db, "transaction_test", "transaction_detail_test", rangeStart, rangeEnd)
+	summary, err := GetReportBetween(db, TestTables, rangeStart, rangeEnd, 0)
 	if err != nil {
 		t.Fatalf("GetReportBetween failed: %v", err)
 	}
@@ -70,7 +70,7 @@ func TestGetReportBetweenEmpty(t *testing.T) {
 	rangeStart := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
 	rangeEnd := time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)
 
-	summary, err := GetReportBetween(db, "transaction_test", "transaction_detail_test", rangeStart, rangeEnd)
+	summary, err := GetReportBetween(db, TestTables, rangeStart, rangeEnd, 0)
 	if err != nil {
 		t.Fatalf("GetReportBetween failed: %v", err)
 	}
@@ -93,12 +93,12 @@ func TestGetReportToday(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Food", "Food category")
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod, err := CreateProduct(db, "product_test", "category_test", "Indomie Goreng", 5000, 100, cat.ID)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Indomie Goreng", Price: 5000, Stock: 100, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
@@ -108,7 +108,7 @@ func TestGetReportToday(t *testing.T) {
 		{ProductID: prod.ID, ProductName: prod.Name, Quantity: 2, Subtotal: 10000},
 	})
 
-	summary, err := GetReportToday(db, "transaction_test", "transaction_detail_test", day)
+	summary, err := GetReportToday(db, TestTables, day, 0)
 	if err != nil {
 		t.Fatalf("GetReportToday failed: %v", err)
 	}
@@ -121,6 +121,59 @@ func TestGetReportToday(t *testing.T) {
 	}
 }
 
+func TestGetCategorySalesBetween(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	minuman, err := Create(db, "category_test", "Minuman", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	kopi, err := Create(db, "category_test", "Kopi", nil, &minuman.ID)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	kopiSusu, err := Create(db, "category_test", "Kopi Susu", nil, &kopi.ID)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	makanan, err := Create(db, "category_test", "Makanan", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	kopiHitam, err := CreateProduct(db, TestTables, Product{Name: "Kopi Hitam", Price: 10000, Stock: 100, CategoryID: kopi.ID})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	esKopiSusu, err := CreateProduct(db, TestTables, Product{Name: "Es Kopi Susu", Price: 20000, Stock: 100, CategoryID: kopiSusu.ID})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	day := time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC)
+	_ = insertTransactionWithDetails(t, db, 60000, day.Add(time.Hour), []TransactionDetail{
+		// No category snapshot: attributed to the product's current category
+		{ProductID: kopiHitam.ID, ProductName: kopiHitam.Name, Quantity: 2, Subtotal: 20000},
+		{ProductID: esKopiSusu.ID, ProductName: esKopiSusu.Name, Quantity: 2, Subtotal: 40000, CategoryID: kopiSusu.ID},
+	})
+
+	sales, err := GetCategorySalesBetween(db, TestTables, day, day.AddDate(0, 0, 1), 0)
+	if err != nil {
+		t.Fatalf("GetCategorySalesBetween failed: %v", err)
+	}
+	if len(sales) != 4 {
+		t.Fatalf("Expected 4 categories, got %d", len(sales))
+	}
+
+	expected := map[int]int{minuman.ID: 60000, kopi.ID: 60000, kopiSusu.ID: 40000, makanan.ID: 0}
+	for _, cs := range sales {
+		if cs.Revenue != expected[cs.CategoryID] {
+			t.Errorf("Category %s: expected revenue %d, got %d", cs.Name, expected[cs.CategoryID], cs.Revenue)
+		}
+	}
+}
+
 func insertTransactionWithDetails(t *testing.T, db *sql.DB, total int, createdAt time.Time, details []TransactionDetail) int {
 	var trxID int
 	err := db.QueryRow("INSERT INTO transaction_test (total_amount, created_at) VALUES ($1, $2) RETURNING id", total, createdAt).Scan(&trxID)
@@ -129,7 +182,7 @@ func insertTransactionWithDetails(t *testing.T, db *sql.DB, total int, createdAt
 	}
 
 	for _, d := range details {
-		_, err = db.Exec("INSERT INTO transaction_detail_test (transaction_id, product_id, product_name, product_description, unit_price, quantity, subtotal) VALUES ($1, $2, $3, $4, $5, $6, $7)", trxID, d.ProductID, d.ProductName, d.ProductDesc, d.UnitPrice, d.Quantity, d.Subtotal)
+		_, err = db.Exec("INSERT INTO transaction_detail_test (transaction_id, product_id, product_name, product_description, unit_price, quantity, subtotal, category_id) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0))", trxID, d.ProductID, d.ProductName, d.ProductDesc, d.UnitPrice, d.Quantity, d.Subtotal, d.CategoryID)
 		if err != nil {
 			t.Fatalf("Failed to insert transaction_detail_test: %v", err)
 		}
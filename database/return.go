@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidReturn     = errors.New("invalid return")
+	ErrReturnExceedsSale = errors.New("returned quantity exceeds sold quantity")
+)
+
+// ReturnError reports a return line that would take the returned quantity
+// of a transaction detail beyond the sold quantity. It matches
+// ErrReturnExceedsSale with errors.Is.
+type ReturnError struct {
+	TransactionDetailID int
+	Sold                int
+	Returned            int
+	Requested           int
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("return of %d exceeds sale for transaction detail %d: sold %d, returned %d", e.Requested, e.TransactionDetailID, e.Sold, e.Returned)
+}
+
+func (e *ReturnError) Unwrap() error {
+	return ErrReturnExceedsSale
+}
+
+// TransactionReturn is a return of goods sold by a transaction. The refund
+// is the sum of the line subtotals. Only what the transaction has settled is
+// paid back; CreditedAmount is the rest of the refund, taken off its
+// outstanding balance instead.
+type TransactionReturn struct {
+	ID             int          `json:"id" db:"id"`
+	TransactionID  int          `json:"transaction_id" db:"transaction_id"`
+	RefundAmount   int          `json:"refund_amount" db:"refund_amount"`
+	CreditedAmount int          `json:"credited_amount" db:"credited_amount"`
+	Reason         string       `json:"reason" db:"reason"`
+	CreatedAt      time.Time    `json:"created_at" db:"created_at"`
+	Lines          []ReturnLine `json:"lines" db:"-"`
+}
+
+// ReturnLine is a returned quantity of a transaction detail, refunded at
+// the unit price of the sale
+type ReturnLine struct {
+	ID                  int    `json:"id" db:"id"`
+	ReturnID            int    `json:"return_id" db:"return_id"`
+	TransactionDetailID int    `json:"transaction_detail_id" db:"transaction_detail_id"`
+	ProductID           int    `json:"product_id" db:"product_id"`
+	VariantID           int    `json:"variant_id,omitempty" db:"variant_id"`
+	ProductName         string `json:"product_name" db:"product_name"`
+	UnitPrice           int    `json:"unit_price" db:"unit_price"`
+	Quantity            int    `json:"quantity" db:"quantity"`
+	Subtotal            int    `json:"subtotal" db:"subtotal"`
+}
+
+// ReturnItem is a line of a return request
+type ReturnItem struct {
+	TransactionDetailID int `json:"transaction_detail_id"`
+	Quantity            int `json:"quantity"`
+}
+
+// CreateReturn returns items of a transaction. Each item names a detail of
+// the transaction at most once with a positive quantity; other items return
+// ErrInvalidReturn. Returning more of a detail than was sold, counting
+// earlier returns, returns a *ReturnError, and a voided transaction returns
+// ErrTransactionVoided. The quantities go back into the stock of the
+// transaction's outlet, outside lots, recorded as return movements
+// referencing the return, and are refunded at the unit price of the sale.
+// The refund paid back is capped at the settled amount of the transaction
+// and the rest is credited against its outstanding balance.
+func CreateReturn(db *sql.DB, tables Tables, transactionID int, items []ReturnItem, reason string) (TransactionReturn, error) {
+	if len(items) == 0 {
+		return TransactionReturn{}, ErrInvalidReturn
+	}
+	seen := make(map[int]bool, len(items))
+	for _, item := range items {
+		if item.Quantity <= 0 || seen[item.TransactionDetailID] {
+			return TransactionReturn{}, ErrInvalidReturn
+		}
+		seen[item.TransactionDetailID] = true
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return TransactionReturn{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the transaction serializes its returns and payments
+	trx := Transaction{ID: transactionID}
+	var voided bool
+	lockQuery := fmt.Sprintf("SELECT outlet_id, total_amount, paid_amount, change_amount, voided_at IS NOT NULL FROM %s WHERE id = $1 FOR UPDATE", tables.Transaction)
+	if err := tx.QueryRow(lockQuery, transactionID).Scan(&trx.OutletID, &trx.TotalAmount, &trx.PaidAmount, &trx.ChangeAmount, &voided); err != nil {
+		if err == sql.ErrNoRows {
+			return TransactionReturn{}, ErrTransactionNotFound
+		}
+		return TransactionReturn{}, fmt.Errorf("failed to query transaction: %w", translateError(err))
+	}
+	if voided {
+		return TransactionReturn{}, ErrTransactionVoided
+	}
+	if err := trx.loadRefunds(tx, tables.Return); err != nil {
+		return TransactionReturn{}, err
+	}
+	trx.setSettlement()
+
+	// Details saved before unit prices were recorded fall back to the
+	// subtotal per unit
+	detailQuery := fmt.Sprintf(`
+	SELECT d.product_id, COALESCE(d.variant_id, 0), d.product_name, COALESCE(NULLIF(d.unit_price, 0), d.subtotal / d.quantity), d.quantity,
+		COALESCE((SELECT SUM(rl.quantity) FROM %s rl WHERE rl.transaction_detail_id = d.id), 0)
+	FROM %s d WHERE d.id = $1 AND d.transaction_id = $2`, tables.ReturnLine, tables.TransactionDetail)
+
+	ret := TransactionReturn{TransactionID: transactionID, Reason: reason}
+	for _, item := range items {
+		line := ReturnLine{TransactionDetailID: item.TransactionDetailID, Quantity: item.Quantity}
+		var sold, returned int
+		err := tx.QueryRow(detailQuery, item.TransactionDetailID, transactionID).Scan(&line.ProductID, &line.VariantID, &line.ProductName, &line.UnitPrice, &sold, &returned)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return TransactionReturn{}, ErrInvalidReturn
+			}
+			return TransactionReturn{}, fmt.Errorf("failed to query transaction detail: %w", translateError(err))
+		}
+		if returned+item.Quantity > sold {
+			return TransactionReturn{}, &ReturnError{TransactionDetailID: item.TransactionDetailID, Sold: sold, Returned: returned, Requested: item.Quantity}
+		}
+		line.Subtotal = line.UnitPrice * line.Quantity
+		ret.RefundAmount += line.Subtotal
+		ret.Lines = append(ret.Lines, line)
+	}
+	ret.CreditedAmount = ret.RefundAmount - min(ret.RefundAmount, max(trx.SettledAmount, 0))
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (transaction_id, refund_amount, credited_amount, reason) VALUES ($1, $2, $3, $4) RETURNING id, created_at", tables.Return)
+	if err := tx.QueryRow(insertQuery, transactionID, ret.RefundAmount, ret.CreditedAmount, ret.Reason).Scan(&ret.ID, &ret.CreatedAt); err != nil {
+		return TransactionReturn{}, fmt.Errorf("failed to create return: %w", translateError(err))
+	}
+
+	insertLineQuery := fmt.Sprintf("INSERT INTO %s (return_id, transaction_detail_id, unit_price, quantity, subtotal) VALUES ($1, $2, $3, $4, $5) RETURNING id", tables.ReturnLine)
+	for i := range ret.Lines {
+		line := &ret.Lines[i]
+		line.ReturnID = ret.ID
+		if err := tx.QueryRow(insertLineQuery, ret.ID, line.TransactionDetailID, line.UnitPrice, line.Quantity, line.Subtotal).Scan(&line.ID); err != nil {
+			return TransactionReturn{}, fmt.Errorf("failed to create return line: %w", translateError(err))
+		}
+
+		balance, err := changeStock(tx, tables, trx.OutletID, line.ProductID, line.VariantID, line.Quantity)
+		if err != nil {
+			return TransactionReturn{}, err
+		}
+		err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: line.ProductID, VariantID: line.VariantID, OutletID: trx.OutletID, Delta: line.Quantity, Balance: balance, Reason: MovementReturn, ReferenceID: ret.ID})
+		if err != nil {
+			return TransactionReturn{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return TransactionReturn{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return ret, nil
+}
+
+// loadRefunds sets the refunded and credited amounts of t from the returns
+// in returnTable
+func (t *Transaction) loadRefunds(q rowQuerier, returnTable string) error {
+	query := fmt.Sprintf("SELECT COALESCE(SUM(refund_amount), 0), COALESCE(SUM(credited_amount), 0) FROM %s WHERE transaction_id = $1", returnTable)
+	if err := q.QueryRow(query, t.ID).Scan(&t.RefundedAmount, &t.CreditedAmount); err != nil {
+		return fmt.Errorf("failed to query transaction returns: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReturnRefundsAtSalePrice(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Susu UHT", Price: 6000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 5}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	detailID := trx.Details[0].ID
+
+	// The refund uses the price at checkout, not the current one
+	if _, err := UpdateProduct(db, TestTables, Product{ID: prod.ID, Name: prod.Name, Price: 7000, Stock: 5}, 0); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+
+	ret, err := CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: detailID, Quantity: 2}}, "Kemasan bocor")
+	if err != nil {
+		t.Fatalf("CreateReturn failed: %v", err)
+	}
+	if ret.RefundAmount != 12000 || ret.CreditedAmount != 12000 || len(ret.Lines) != 1 || ret.Lines[0].UnitPrice != 6000 || ret.Lines[0].ProductID != prod.ID {
+		t.Errorf("Unexpected return: %+v", ret)
+	}
+
+	var returnErr *ReturnError
+	_, err = CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: detailID, Quantity: 4}}, "")
+	if !errors.As(err, &returnErr) || returnErr.Sold != 5 || returnErr.Returned != 2 {
+		t.Errorf("Expected ReturnError, got %v", err)
+	}
+	if _, err := CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: detailID + 1000, Quantity: 1}}, ""); err != ErrInvalidReturn {
+		t.Errorf("Expected ErrInvalidReturn for a detail of another transaction, got %v", err)
+	}
+	if _, err := CreateReturn(db, TestTables, 999999, []ReturnItem{{TransactionDetailID: detailID, Quantity: 1}}, ""); err != ErrTransactionNotFound {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+
+	updated, err := GetProductByID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 7 {
+		t.Errorf("Expected stock 7, got %d", updated.Stock)
+	}
+
+	history, err := GetStockHistory(db, "inventory_movement_test", "product_test", prod.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if m := history.Data[0]; m.Reason != MovementReturn || m.Delta != 2 || m.Balance != 7 || m.ReferenceID != ret.ID {
+		t.Errorf("Unexpected return movement: %+v", m)
+	}
+
+	loaded, err := GetTransaction(db, TestTables, trx.ID)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if loaded.RefundedAmount != 12000 || loaded.OutstandingAmount != 18000 || loaded.Details[0].ReturnedQuantity != 2 {
+		t.Errorf("Unexpected transaction after return: %+v", loaded)
+	}
+
+	summary, err := GetReportToday(db, TestTables, time.Now().UTC(), 0)
+	if err != nil {
+		t.Fatalf("GetReportToday failed: %v", err)
+	}
+	if summary.TotalRevenue != 18000 || summary.TotalRetur != 12000 || summary.ProdukTerlaris.QtyTerjual != 3 {
+		t.Errorf("Expected returns as negative revenue, got %+v", summary)
+	}
+}
+
+func TestReturnOnPartlyPaidSale(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kopi Bubuk", Price: 10000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 3}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := AddPayments(db, TestTables, trx.ID, []CheckoutPayment{{Method: PaymentCash, Amount: 10000}}); err != nil {
+		t.Fatalf("AddPayments failed: %v", err)
+	}
+
+	// Only the 10000 paid can be given back; the rest comes off the balance
+	ret, err := CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: trx.Details[0].ID, Quantity: 2}}, "")
+	if err != nil {
+		t.Fatalf("CreateReturn failed: %v", err)
+	}
+	if ret.RefundAmount != 20000 || ret.CreditedAmount != 10000 {
+		t.Errorf("Unexpected return: %+v", ret)
+	}
+
+	loaded, err := GetTransaction(db, TestTables, trx.ID)
+	if err != nil {
+		t.Fatalf("GetTransaction failed: %v", err)
+	}
+	if loaded.RefundedAmount != 20000 || loaded.CreditedAmount != 10000 || loaded.SettledAmount != 0 || loaded.OutstandingAmount != 10000 {
+		t.Errorf("Unexpected transaction after return: %+v", loaded)
+	}
+
+	// A return of the rest has nothing left to give back
+	ret, err = CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: trx.Details[0].ID, Quantity: 1}}, "")
+	if err != nil {
+		t.Fatalf("CreateReturn failed: %v", err)
+	}
+	if ret.RefundAmount != 10000 || ret.CreditedAmount != 10000 {
+		t.Errorf("Unexpected second return: %+v", ret)
+	}
+	if _, err := AddPayments(db, TestTables, trx.ID, []CheckoutPayment{{Method: PaymentCash, Amount: 1000}}); err != ErrTransactionSettled {
+		t.Errorf("Expected ErrTransactionSettled once everything is returned, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// searchSimilarityThreshold is the minimum trigram word similarity for a
+// product or category name to count as a fuzzy match. It is low enough to
+// tolerate a typo or a missing letter ("indomi" matches "Indomie Goreng").
+const searchSimilarityThreshold = 0.3
+
+// ProductMatch is a product returned by SearchProducts with its relevance score.
+type ProductMatch struct {
+	Product
+	Rank float64 `json:"rank"`
+}
+
+// searchTerms splits a search string into lowercase words made of letters and digits.
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixTSQuery builds a tsquery that matches every term as a prefix,
+// e.g. "indomie gor" becomes "indomie:* & gor:*".
+func prefixTSQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// SearchProducts finds products whose name, category name or category description
+// match q, combining prefix full-text search on the stored search_doc columns
+// with trigram similarity so that partial words and typos still match. Results
+// are ordered by rank, best first.
+func SearchProducts(db *sql.DB, tables Tables, q string, limit int) ([]ProductMatch, error) {
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return []ProductMatch{}, nil
+	}
+	text := strings.Join(terms, " ")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// SET LOCAL keeps the threshold scoped to this transaction, so the <% operators
+	// below can use the trigram indexes without affecting other pooled connections.
+	_, err = tx.Exec(fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %g", searchSimilarityThreshold))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set similarity threshold: %w", err)
+	}
+
+	// Each way of matching is its own UNION branch so that every branch can use
+	// the GIN index on search_doc or on the name trigrams; an OR across the
+	// product and category tables would make Postgres scan all products.
+	query := fmt.Sprintf(`
+	WITH matched_category AS (
+		SELECT id FROM %[2]s WHERE search_doc @@ to_tsquery('simple', $2)
+		UNION
+		SELECT id FROM %[2]s WHERE $1 <%% name
+	), matched AS (
+		SELECT id FROM %[1]s WHERE search_doc @@ to_tsquery('simple', $2)
+		UNION
+		SELECT id FROM %[1]s WHERE $1 <%% name
+		UNION
+		SELECT p.id FROM %[1]s p JOIN matched_category mc ON p.category_id = mc.id
+	)
+	SELECT `+productColumns+`, COALESCE(c.name, ''), COALESCE(c.description, ''),
+		ts_rank(p.search_doc || COALESCE(c.search_doc, ''::tsvector), to_tsquery('simple', $2)) +
+			word_similarity($1, p.name) + 0.5 * word_similarity($1, COALESCE(c.name, '')) AS rank
+	FROM matched m
+	JOIN %[1]s p ON p.id = m.id
+	LEFT JOIN %[2]s c ON p.category_id = c.id
+	WHERE p.deleted_at IS NULL
+	ORDER BY rank DESC, p.id
+	LIMIT $3`, tables.Product, tables.Category)
+
+	rows, err := tx.Query(query, text, prefixTSQuery(terms), normalizeLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []ProductMatch{}
+	for rows.Next() {
+		var m ProductMatch
+		if err := rows.Scan(append(m.scanFieldsWithCategory(), &m.Rank)...); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		matches = append(matches, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating products: %w", err)
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrShiftNotFound = errors.New("shift not found")
+	ErrShiftOpen     = errors.New("outlet already has an open shift")
+	ErrShiftClosed   = errors.New("shift is already closed")
+)
+
+// Shift is a cashier shift at an outlet, open until ClosedAt is set. An
+// outlet has at most one open shift, and sales made during it can be voided
+// until it is closed.
+type Shift struct {
+	ID       int        `json:"id" db:"id"`
+	OutletID int        `json:"outlet_id" db:"outlet_id"`
+	OpenedBy string     `json:"opened_by" db:"opened_by"`
+	OpenedAt time.Time  `json:"opened_at" db:"opened_at"`
+	ClosedBy string     `json:"closed_by,omitempty" db:"closed_by"`
+	ClosedAt *time.Time `json:"closed_at,omitempty" db:"closed_at"`
+}
+
+const shiftColumns = "id, outlet_id, opened_by, opened_at, closed_by, closed_at"
+
+// scanFields returns scan destinations matching shiftColumns
+func (s *Shift) scanFields() []interface{} {
+	return []interface{}{&s.ID, &s.OutletID, &s.OpenedBy, &s.OpenedAt, &s.ClosedBy, &s.ClosedAt}
+}
+
+// GetShifts retrieves the shifts of outletID, or of every outlet when it is
+// 0, newest first
+func GetShifts(db *sql.DB, tables Tables, outletID int) ([]Shift, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE $1 = 0 OR outlet_id = $1 ORDER BY id DESC", shiftColumns, tables.Shift)
+	rows, err := db.Query(query, outletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shifts: %w", err)
+	}
+	defer rows.Close()
+
+	shifts := []Shift{}
+	for rows.Next() {
+		var s Shift
+		if err := rows.Scan(s.scanFields()...); err != nil {
+			return nil, fmt.Errorf("failed to scan shift: %w", err)
+		}
+		shifts = append(shifts, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating shifts: %w", err)
+	}
+
+	return shifts, nil
+}
+
+// GetShift retrieves a shift by ID
+func GetShift(db *sql.DB, tables Tables, id int) (Shift, error) {
+	var s Shift
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", shiftColumns, tables.Shift)
+	if err := db.QueryRow(query, id).Scan(s.scanFields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return Shift{}, ErrShiftNotFound
+		}
+		return Shift{}, fmt.Errorf("failed to query shift: %w", err)
+	}
+	return s, nil
+}
+
+// OpenShift opens a shift at outletID, or at DefaultOutletID when it is 0,
+// recording who opened it. An outlet with an open shift returns ErrShiftOpen.
+func OpenShift(db *sql.DB, tables Tables, outletID int, openedBy string) (Shift, error) {
+	if outletID == 0 {
+		outletID = DefaultOutletID
+	}
+
+	var s Shift
+	query := fmt.Sprintf("INSERT INTO %s (outlet_id, opened_by) VALUES ($1, $2) RETURNING %s", tables.Shift, shiftColumns)
+	if err := db.QueryRow(query, outletID, openedBy).Scan(s.scanFields()...); err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return Shift{}, ErrOutletNotFound
+		case isUniqueViolation(err):
+			return Shift{}, ErrShiftOpen
+		}
+		return Shift{}, fmt.Errorf("failed to open shift: %w", translateError(err))
+	}
+	return s, nil
+}
+
+// CloseShift closes shift id, recording who closed it. Sales made during the
+// shift can no longer be voided once the void window has passed. A closed
+// shift returns ErrShiftClosed.
+func CloseShift(db *sql.DB, tables Tables, id int, closedBy string) (Shift, error) {
+	var s Shift
+	query := fmt.Sprintf("UPDATE %s SET closed_by = $1, closed_at = NOW() WHERE id = $2 AND closed_at IS NULL RETURNING %s", tables.Shift, shiftColumns)
+	err := db.QueryRow(query, closedBy, id).Scan(s.scanFields()...)
+	if err == sql.ErrNoRows {
+		if _, err := GetShift(db, tables, id); err != nil {
+			return Shift{}, err
+		}
+		return Shift{}, ErrShiftClosed
+	}
+	if err != nil {
+		return Shift{}, fmt.Errorf("failed to close shift: %w", translateError(err))
+	}
+	return s, nil
+}
+
+// inOpenShift reports whether a sale made at createdAt falls in the open
+// shift of outletID. The shift is locked for the rest of tx so it cannot be
+// closed meanwhile.
+func inOpenShift(tx *sql.Tx, shiftTable string, outletID int, createdAt time.Time) (bool, error) {
+	var id int
+	query := fmt.Sprintf("SELECT id FROM %s WHERE outlet_id = $1 AND closed_at IS NULL AND opened_at <= $2 FOR SHARE", shiftTable)
+	err := tx.QueryRow(query, outletID, createdAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query shift: %w", translateError(err))
+	}
+	return true, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import "testing"
+
+func TestShiftLifecycle(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	shift, err := OpenShift(db, TestTables, 0, "Kasir 1")
+	if err != nil {
+		t.Fatalf("OpenShift failed: %v", err)
+	}
+	if shift.OutletID != DefaultOutletID || shift.OpenedBy != "Kasir 1" || shift.ClosedAt != nil {
+		t.Errorf("Unexpected shift: %+v", shift)
+	}
+	if _, err := OpenShift(db, TestTables, DefaultOutletID, "Kasir 2"); err != ErrShiftOpen {
+		t.Errorf("Expected ErrShiftOpen, got %v", err)
+	}
+	if _, err := OpenShift(db, TestTables, 999999, "Kasir 2"); err != ErrOutletNotFound {
+		t.Errorf("Expected ErrOutletNotFound, got %v", err)
+	}
+
+	closed, err := CloseShift(db, TestTables, shift.ID, "Supervisor")
+	if err != nil {
+		t.Fatalf("CloseShift failed: %v", err)
+	}
+	if closed.ClosedAt == nil || closed.ClosedBy != "Supervisor" {
+		t.Errorf("Unexpected closed shift: %+v", closed)
+	}
+	if _, err := CloseShift(db, TestTables, shift.ID, "Supervisor"); err != ErrShiftClosed {
+		t.Errorf("Expected ErrShiftClosed, got %v", err)
+	}
+	if _, err := CloseShift(db, TestTables, 999999, "Supervisor"); err != ErrShiftNotFound {
+		t.Errorf("Expected ErrShiftNotFound, got %v", err)
+	}
+
+	// The next shift can open once the previous one is closed
+	next, err := OpenShift(db, TestTables, 0, "Kasir 2")
+	if err != nil {
+		t.Fatalf("OpenShift failed after close: %v", err)
+	}
+	shifts, err := GetShifts(db, TestTables, DefaultOutletID)
+	if err != nil {
+		t.Fatalf("GetShifts failed: %v", err)
+	}
+	if len(shifts) != 2 || shifts[0].ID != next.ID {
+		t.Errorf("Expected the newest shift first, got %+v", shifts)
+	}
+}
@@ -0,0 +1,316 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrStockTakeNotFound = errors.New("stock take not found")
+	ErrStockTakeOpen     = errors.New("outlet already has an open stock take")
+	ErrStockTakeStatus   = errors.New("stock take status does not allow this change")
+	ErrInvalidStockCount = errors.New("invalid stock count")
+)
+
+// Statuses of a stock take. Counts can only be recorded while it is open.
+const (
+	StockTakeOpen      = "open"
+	StockTakeFinalized = "finalized"
+	StockTakeCancelled = "cancelled"
+)
+
+// StockTake is a physical count of the product stock at an outlet. Opening
+// it snapshots the stock of every product; Counted is the number of products
+// counted so far and VarianceValue the value of all variances at the current
+// product prices.
+type StockTake struct {
+	ID            int        `json:"id" db:"id"`
+	OutletID      int        `json:"outlet_id" db:"outlet_id"`
+	Status        string     `json:"status" db:"status"`
+	Note          string     `json:"note" db:"note"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	FinalizedAt   *time.Time `json:"finalized_at,omitempty" db:"finalized_at"`
+	Products      int        `json:"products" db:"-"`
+	Counted       int        `json:"counted" db:"-"`
+	VarianceValue int        `json:"variance_value" db:"-"`
+	// Lines is only loaded when a single stock take is fetched
+	Lines []StockTakeLine `json:"lines,omitempty" db:"-"`
+}
+
+// stockTakeSelect selects a stock take with its summary. It takes the stock
+// take, stock take line and product table names.
+const stockTakeSelect = "SELECT s.id, s.outlet_id, s.status, s.note, s.created_at, s.finalized_at, (SELECT COUNT(*) FROM %[2]s l WHERE l.stock_take_id = s.id), (SELECT COUNT(l.counted_quantity) FROM %[2]s l WHERE l.stock_take_id = s.id), COALESCE((SELECT SUM((l.counted_quantity - l.expected_quantity) * p.price) FROM %[2]s l JOIN %[3]s p ON l.product_id = p.id WHERE l.stock_take_id = s.id), 0) FROM %[1]s s"
+
+// scanFields returns scan destinations matching stockTakeSelect
+func (s *StockTake) scanFields() []interface{} {
+	return []interface{}{&s.ID, &s.OutletID, &s.Status, &s.Note, &s.CreatedAt, &s.FinalizedAt, &s.Products, &s.Counted, &s.VarianceValue}
+}
+
+// StockTakeLine is the count of one product. SnapshotQuantity is the outlet's
+// stock when the stock take was opened and ExpectedQuantity its stock when
+// the count was recorded, so sales made while counting are not variances.
+// The count fields are nil until the product is counted; Variance is then the
+// counted minus the expected quantity and VarianceValue its value at Price.
+type StockTakeLine struct {
+	ProductID        int        `json:"product_id" db:"product_id"`
+	ProductName      string     `json:"product_name" db:"-"`
+	Price            int        `json:"price" db:"-"`
+	SnapshotQuantity int        `json:"snapshot_quantity" db:"snapshot_quantity"`
+	ExpectedQuantity *int       `json:"expected_quantity" db:"expected_quantity"`
+	CountedQuantity  *int       `json:"counted_quantity" db:"counted_quantity"`
+	Variance         *int       `json:"variance" db:"-"`
+	VarianceValue    *int       `json:"variance_value" db:"-"`
+	CountedAt        *time.Time `json:"counted_at" db:"counted_at"`
+}
+
+// StockCount is the counted quantity of a product
+type StockCount struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// GetStockTakes retrieves all stock takes without their lines, newest first
+func GetStockTakes(db *sql.DB, tables Tables) ([]StockTake, error) {
+	query := fmt.Sprintf(stockTakeSelect+" ORDER BY s.id DESC", tables.StockTake, tables.StockTakeLine, tables.Product)
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stock takes: %w", err)
+	}
+	defer rows.Close()
+
+	stockTakes := []StockTake{}
+	for rows.Next() {
+		var s StockTake
+		if err := rows.Scan(s.scanFields()...); err != nil {
+			return nil, fmt.Errorf("failed to scan stock take: %w", err)
+		}
+		stockTakes = append(stockTakes, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock takes: %w", err)
+	}
+
+	return stockTakes, nil
+}
+
+// GetStockTake retrieves a stock take with its lines ordered by product
+func GetStockTake(db *sql.DB, tables Tables, id int) (StockTake, error) {
+	var s StockTake
+	query := fmt.Sprintf(stockTakeSelect+" WHERE s.id = $1", tables.StockTake, tables.StockTakeLine, tables.Product)
+	if err := db.QueryRow(query, id).Scan(s.scanFields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return StockTake{}, ErrStockTakeNotFound
+		}
+		return StockTake{}, fmt.Errorf("failed to query stock take: %w", err)
+	}
+
+	linesQuery := fmt.Sprintf("SELECT l.product_id, p.name, p.price, l.snapshot_quantity, l.expected_quantity, l.counted_quantity, l.counted_at FROM %s l JOIN %s p ON l.product_id = p.id WHERE l.stock_take_id = $1 ORDER BY l.product_id", tables.StockTakeLine, tables.Product)
+	rows, err := db.Query(linesQuery, id)
+	if err != nil {
+		return StockTake{}, fmt.Errorf("failed to query stock take lines: %w", err)
+	}
+	defer rows.Close()
+
+	s.Lines = []StockTakeLine{}
+	for rows.Next() {
+		var line StockTakeLine
+		if err := rows.Scan(&line.ProductID, &line.ProductName, &line.Price, &line.SnapshotQuantity, &line.ExpectedQuantity, &line.CountedQuantity, &line.CountedAt); err != nil {
+			return StockTake{}, fmt.Errorf("failed to scan stock take line: %w", err)
+		}
+		if line.CountedQuantity != nil {
+			variance := *line.CountedQuantity - *line.ExpectedQuantity
+			value := variance * line.Price
+			line.Variance = &variance
+			line.VarianceValue = &value
+		}
+		s.Lines = append(s.Lines, line)
+	}
+
+	if err = rows.Err(); err != nil {
+		return StockTake{}, fmt.Errorf("error iterating stock take lines: %w", err)
+	}
+
+	return s, nil
+}
+
+// OpenStockTake opens a stock take at outletID, or at DefaultOutletID when it
+// is 0, and snapshots the outlet's stock of every product that is not
+// deleted. An outlet with an open stock take returns ErrStockTakeOpen.
+func OpenStockTake(db *sql.DB, tables Tables, outletID int, note string) (StockTake, error) {
+	if outletID == 0 {
+		outletID = DefaultOutletID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return StockTake{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (outlet_id, status, note) VALUES ($1, $2, $3) RETURNING id", tables.StockTake)
+	if err := tx.QueryRow(query, outletID, StockTakeOpen, note).Scan(&id); err != nil {
+		switch {
+		case isForeignKeyViolation(err):
+			return StockTake{}, ErrOutletNotFound
+		case isUniqueViolation(err):
+			return StockTake{}, ErrStockTakeOpen
+		}
+		return StockTake{}, fmt.Errorf("failed to create stock take: %w", translateError(err))
+	}
+
+	snapshotQuery := fmt.Sprintf("INSERT INTO %s (stock_take_id, product_id, snapshot_quantity) SELECT $1, p.id, COALESCE(s.quantity, 0) FROM %s p LEFT JOIN %s s ON s.product_id = p.id AND s.variant_id = 0 AND s.outlet_id = $2 WHERE p.deleted_at IS NULL", tables.StockTakeLine, tables.Product, tables.OutletStock)
+	if _, err := tx.Exec(snapshotQuery, id, outletID); err != nil {
+		return StockTake{}, fmt.Errorf("failed to snapshot stock: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockTake{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetStockTake(db, tables, id)
+}
+
+// lockStockTake locks stock take id for the rest of tx with lockMode and
+// returns its outlet. It returns ErrStockTakeStatus unless the stock take is open.
+func lockStockTake(tx *sql.Tx, tables Tables, id int, lockMode string) (int, error) {
+	var outletID int
+	var status string
+	lockQuery := fmt.Sprintf("SELECT outlet_id, status FROM %s WHERE id = $1 FOR %s", tables.StockTake, lockMode)
+	if err := tx.QueryRow(lockQuery, id).Scan(&outletID, &status); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrStockTakeNotFound
+		}
+		return 0, fmt.Errorf("failed to query stock take: %w", translateError(err))
+	}
+	if status != StockTakeOpen {
+		return 0, ErrStockTakeStatus
+	}
+	return outletID, nil
+}
+
+// RecordStockCounts records a batch of counted quantities on an open stock
+// take. Batches can be recorded concurrently and a later count of a product
+// replaces the earlier one. Each count stores the outlet's stock at that
+// moment as the expected quantity. Products that are not on the stock take
+// return ErrInvalidStockCount.
+func RecordStockCounts(db *sql.DB, tables Tables, id int, counts []StockCount) (StockTake, error) {
+	if len(counts) == 0 {
+		return StockTake{}, ErrInvalidStockCount
+	}
+	seen := make(map[int]bool, len(counts))
+	for _, count := range counts {
+		if count.ProductID <= 0 || count.Quantity < 0 || seen[count.ProductID] {
+			return StockTake{}, ErrInvalidStockCount
+		}
+		seen[count.ProductID] = true
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return StockTake{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	outletID, err := lockStockTake(tx, tables, id, "SHARE")
+	if err != nil {
+		return StockTake{}, err
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE %s SET counted_quantity = $1, expected_quantity = COALESCE((SELECT quantity FROM %s WHERE outlet_id = $2 AND product_id = $3 AND variant_id = 0), 0), counted_at = NOW() WHERE stock_take_id = $4 AND product_id = $3", tables.StockTakeLine, tables.OutletStock)
+	for _, count := range counts {
+		result, err := tx.Exec(updateQuery, count.Quantity, outletID, count.ProductID, id)
+		if err != nil {
+			return StockTake{}, fmt.Errorf("failed to record stock count: %w", translateError(err))
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return StockTake{}, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return StockTake{}, ErrInvalidStockCount
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockTake{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetStockTake(db, tables, id)
+}
+
+// FinalizeStockTake closes an open stock take. Every counted product whose
+// count differs from its expected quantity gets a recount stock adjustment by
+// the variance, all in one database transaction. Adjusting by the variance
+// rather than setting the counted quantity keeps sales made after the count.
+// Products that were not counted are left unchanged.
+func FinalizeStockTake(db *sql.DB, tables Tables, id int) (StockTake, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return StockTake{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	outletID, err := lockStockTake(tx, tables, id, "UPDATE")
+	if err != nil {
+		return StockTake{}, err
+	}
+
+	var adjustments []StockAdjustment
+	varianceQuery := fmt.Sprintf("SELECT product_id, counted_quantity - expected_quantity FROM %s WHERE stock_take_id = $1 AND counted_quantity <> expected_quantity ORDER BY product_id", tables.StockTakeLine)
+	rows, err := tx.Query(varianceQuery, id)
+	if err != nil {
+		return StockTake{}, fmt.Errorf("failed to query stock take lines: %w", translateError(err))
+	}
+	for rows.Next() {
+		adj := StockAdjustment{OutletID: outletID, Reason: AdjustmentRecount, Note: fmt.Sprintf("Stock take #%d", id)}
+		if err := rows.Scan(&adj.ProductID, &adj.Delta); err != nil {
+			rows.Close()
+			return StockTake{}, fmt.Errorf("failed to scan stock take line: %w", err)
+		}
+		adjustments = append(adjustments, adj)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return StockTake{}, fmt.Errorf("error iterating stock take lines: %w", translateError(err))
+	}
+
+	for _, adj := range adjustments {
+		if _, err := postAdjustment(tx, tables, adj); err != nil {
+			return StockTake{}, err
+		}
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE %s SET status = $1, finalized_at = NOW() WHERE id = $2", tables.StockTake)
+	if _, err := tx.Exec(updateQuery, StockTakeFinalized, id); err != nil {
+		return StockTake{}, fmt.Errorf("failed to update stock take: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockTake{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetStockTake(db, tables, id)
+}
+
+// CancelStockTake cancels an open stock take without changing any stock
+func CancelStockTake(db *sql.DB, tables Tables, id int) (StockTake, error) {
+	query := fmt.Sprintf("UPDATE %s SET status = $1 WHERE id = $2 AND status = $3", tables.StockTake)
+	result, err := db.Exec(query, StockTakeCancelled, id, StockTakeOpen)
+	if err != nil {
+		return StockTake{}, fmt.Errorf("failed to update stock take: %w", translateError(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return StockTake{}, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	s, err := GetStockTake(db, tables, id)
+	if err != nil {
+		return StockTake{}, err
+	}
+	if rowsAffected == 0 {
+		return StockTake{}, ErrStockTakeStatus
+	}
+	return s, nil
+}
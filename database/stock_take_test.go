@@ -0,0 +1,92 @@
+package database
+
+import "testing"
+
+func TestStockTakeWithCheckoutDuringCount(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	soap, err := CreateProduct(db, TestTables, Product{Name: "Sabun Mandi", Price: 4000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	shampoo, err := CreateProduct(db, TestTables, Product{Name: "Sampo Sachet", Price: 1000, Stock: 5})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	stockTake, err := OpenStockTake(db, TestTables, 0, "Monthly count")
+	if err != nil {
+		t.Fatalf("OpenStockTake failed: %v", err)
+	}
+	if stockTake.OutletID != DefaultOutletID || stockTake.Products != 2 || stockTake.Lines[0].SnapshotQuantity != 10 {
+		t.Errorf("Unexpected stock take: %+v", stockTake)
+	}
+	if _, err := OpenStockTake(db, TestTables, DefaultOutletID, ""); err != ErrStockTakeOpen {
+		t.Errorf("Expected ErrStockTakeOpen, got %v", err)
+	}
+
+	// Sold before the soap was counted
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: soap.ID, Quantity: 2}}, nil); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	stockTake, err = RecordStockCounts(db, TestTables, stockTake.ID, []StockCount{{ProductID: soap.ID, Quantity: 7}})
+	if err != nil {
+		t.Fatalf("RecordStockCounts failed: %v", err)
+	}
+	stockTake, err = RecordStockCounts(db, TestTables, stockTake.ID, []StockCount{{ProductID: shampoo.ID, Quantity: 5}})
+	if err != nil {
+		t.Fatalf("RecordStockCounts failed: %v", err)
+	}
+	if _, err := RecordStockCounts(db, TestTables, stockTake.ID, []StockCount{{ProductID: 9999, Quantity: 1}}); err != ErrInvalidStockCount {
+		t.Errorf("Expected ErrInvalidStockCount for a product not on the stock take, got %v", err)
+	}
+
+	line := stockTake.Lines[0]
+	if *line.ExpectedQuantity != 8 || *line.Variance != -1 || *line.VarianceValue != -4000 {
+		t.Errorf("Unexpected soap count: %+v", line)
+	}
+	if stockTake.Counted != 2 || stockTake.VarianceValue != -4000 {
+		t.Errorf("Unexpected stock take summary: %+v", stockTake)
+	}
+
+	// Sold after the soap was counted
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: soap.ID, Quantity: 1}}, nil); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	stockTake, err = FinalizeStockTake(db, TestTables, stockTake.ID)
+	if err != nil {
+		t.Fatalf("FinalizeStockTake failed: %v", err)
+	}
+	if stockTake.Status != StockTakeFinalized || stockTake.FinalizedAt == nil {
+		t.Errorf("Expected finalized stock take, got %+v", stockTake)
+	}
+
+	updated, err := GetProductByID(db, TestTables, soap.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 6 {
+		t.Errorf("Expected soap stock 6, got %d", updated.Stock)
+	}
+
+	history, err := GetStockHistory(db, "inventory_movement_test", "product_test", soap.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if m := history.Data[0]; m.Reason != MovementAdjustment || m.Delta != -1 || m.Balance != 6 {
+		t.Errorf("Unexpected stock take movement: %+v", m)
+	}
+	history, err = GetStockHistory(db, "inventory_movement_test", "product_test", shampoo.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if history.Data[0].Reason != MovementManualEdit {
+		t.Errorf("Expected no adjustment for a count without variance, got %+v", history.Data[0])
+	}
+
+	if _, err := RecordStockCounts(db, TestTables, stockTake.ID, []StockCount{{ProductID: soap.ID, Quantity: 6}}); err != ErrStockTakeStatus {
+		t.Errorf("Expected ErrStockTakeStatus counting a finalized stock take, got %v", err)
+	}
+}
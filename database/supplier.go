@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrSupplierNotFound = errors.New("supplier not found")
+
+// Supplier is a business that delivers stock through purchase orders
+type Supplier struct {
+	ID    int    `json:"id" db:"id"`
+	Name  string `json:"name" db:"name"`
+	Phone string `json:"phone" db:"phone"`
+	Email string `json:"email" db:"email"`
+}
+
+const supplierColumns = "id, name, phone, email"
+
+// scanFields returns scan destinations matching supplierColumns
+func (s *Supplier) scanFields() []interface{} {
+	return []interface{}{&s.ID, &s.Name, &s.Phone, &s.Email}
+}
+
+// GetSuppliers retrieves all suppliers ordered by name
+func GetSuppliers(db *sql.DB, tableName string) ([]Supplier, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY name, id", supplierColumns, tableName)
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query suppliers: %w", err)
+	}
+	defer rows.Close()
+
+	suppliers := []Supplier{}
+	for rows.Next() {
+		var s Supplier
+		if err := rows.Scan(s.scanFields()...); err != nil {
+			return nil, fmt.Errorf("failed to scan supplier: %w", err)
+		}
+		suppliers = append(suppliers, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating suppliers: %w", err)
+	}
+
+	return suppliers, nil
+}
+
+// GetSupplierByID retrieves a supplier by ID
+func GetSupplierByID(db *sql.DB, tableName string, id int) (Supplier, error) {
+	var s Supplier
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", supplierColumns, tableName)
+	err := db.QueryRow(query, id).Scan(s.scanFields()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Supplier{}, ErrSupplierNotFound
+		}
+		return Supplier{}, fmt.Errorf("failed to query supplier: %w", err)
+	}
+	return s, nil
+}
+
+// CreateSupplier inserts a new supplier and returns it
+func CreateSupplier(db *sql.DB, tableName string, s Supplier) (Supplier, error) {
+	var created Supplier
+	query := fmt.Sprintf("INSERT INTO %s (name, phone, email) VALUES ($1, $2, $3) RETURNING %s", tableName, supplierColumns)
+	err := db.QueryRow(query, s.Name, s.Phone, s.Email).Scan(created.scanFields()...)
+	if err != nil {
+		return Supplier{}, fmt.Errorf("failed to create supplier: %w", translateError(err))
+	}
+	return created, nil
+}
+
+// UpdateSupplier replaces the fields of supplier s.ID and returns it
+func UpdateSupplier(db *sql.DB, tableName string, s Supplier) (Supplier, error) {
+	var updated Supplier
+	query := fmt.Sprintf("UPDATE %s SET name = $1, phone = $2, email = $3 WHERE id = $4 RETURNING %s", tableName, supplierColumns)
+	err := db.QueryRow(query, s.Name, s.Phone, s.Email, s.ID).Scan(updated.scanFields()...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Supplier{}, ErrSupplierNotFound
+		}
+		return Supplier{}, fmt.Errorf("failed to update supplier: %w", translateError(err))
+	}
+	return updated, nil
+}
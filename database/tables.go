@@ -0,0 +1,86 @@
+package database
+
+// Tables holds the table names used by operations that span several tables.
+// Production code uses DefaultTables; tests use the *_test tables.
+type Tables struct {
+	Category          string
+	Product           string
+	ProductVariant    string
+	Transaction       string
+	TransactionDetail string
+	InventoryMovement string
+	StockAdjustment   string
+	Supplier          string
+	PurchaseOrder     string
+	PurchaseOrderLine string
+	Outlet            string
+	OutletStock       string
+	StockTransfer     string
+	TransferLine      string
+	StockTake         string
+	StockTakeLine     string
+	Lot               string
+	TransactionLot    string
+	TransferLot       string
+	IdempotencyKey    string
+	Payment           string
+	Return            string
+	ReturnLine        string
+	Shift             string
+}
+
+// DefaultTables are the production table names created by Migrate.
+var DefaultTables = Tables{
+	Category:          "category",
+	Product:           "product",
+	ProductVariant:    "product_variant",
+	Transaction:       "\"transaction\"",
+	TransactionDetail: "transaction_detail",
+	InventoryMovement: "inventory_movement",
+	StockAdjustment:   "stock_adjustment",
+	Supplier:          "supplier",
+	PurchaseOrder:     "purchase_order",
+	PurchaseOrderLine: "purchase_order_line",
+	Outlet:            "outlet",
+	OutletStock:       "outlet_stock",
+	StockTransfer:     "stock_transfer",
+	TransferLine:      "stock_transfer_line",
+	StockTake:         "stock_take",
+	StockTakeLine:     "stock_take_line",
+	Lot:               "product_lot",
+	TransactionLot:    "transaction_detail_lot",
+	TransferLot:       "stock_transfer_line_lot",
+	IdempotencyKey:    "checkout_idempotency_key",
+	Payment:           "transaction_payment",
+	Return:            "transaction_return",
+	ReturnLine:        "transaction_return_line",
+	Shift:             "shift",
+}
+
+// TestTables are the table names created by MigrateTest.
+var TestTables = Tables{
+	Category:          "category_test",
+	Product:           "product_test",
+	ProductVariant:    "product_variant_test",
+	Transaction:       "transaction_test",
+	TransactionDetail: "transaction_detail_test",
+	InventoryMovement: "inventory_movement_test",
+	StockAdjustment:   "stock_adjustment_test",
+	Supplier:          "supplier_test",
+	PurchaseOrder:     "purchase_order_test",
+	PurchaseOrderLine: "purchase_order_line_test",
+	Outlet:            "outlet_test",
+	OutletStock:       "outlet_stock_test",
+	StockTransfer:     "stock_transfer_test",
+	TransferLine:      "stock_transfer_line_test",
+	StockTake:         "stock_take_test",
+	StockTakeLine:     "stock_take_line_test",
+	Lot:               "product_lot_test",
+	TransactionLot:    "transaction_detail_lot_test",
+	TransferLot:       "stock_transfer_line_lot_test",
+	IdempotencyKey:    "checkout_idempotency_key_test",
+	Payment:           "transaction_payment_test",
+	Return:            "transaction_return_test",
+	ReturnLine:        "transaction_return_line_test",
+	Shift:             "shift_test",
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -11,16 +12,106 @@ var (
 	ErrCheckoutEmptyItems  = errors.New("checkout items required")
 	ErrInvalidCheckoutItem = errors.New("invalid checkout item")
 	ErrProductNotFound     = errors.New("product not found")
+	ErrProductDeleted      = errors.New("product has been deleted")
 	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrTransactionNotFound = errors.New("transaction not found")
 )
 
+// StockError reports a checkout line that asked for more than is in stock.
+// OutletID is set when the stock of a single outlet was short.
+// It matches ErrInsufficientStock with errors.Is.
+type StockError struct {
+	ProductID int
+	VariantID int
+	OutletID  int
+	Requested int
+	Available int
+}
+
+func (e *StockError) Error() string {
+	item := fmt.Sprintf("product %d", e.ProductID)
+	if e.VariantID != 0 {
+		item = fmt.Sprintf("variant %d of product %d", e.VariantID, e.ProductID)
+	}
+	if e.OutletID != 0 {
+		item += fmt.Sprintf(" at outlet %d", e.OutletID)
+	}
+	return fmt.Sprintf("insufficient stock for %s: requested %d, available %d", item, e.Requested, e.Available)
+}
+
+func (e *StockError) Unwrap() error {
+	return ErrInsufficientStock
+}
+
 // Transaction represents a checkout transaction with details
-// It includes a timestamp for reporting.
+// It includes a timestamp for reporting. PaidAmount is the sum of the
+// payments and ChangeAmount the cash given back; both are 0 for a checkout
+// made without payments. RefundedAmount is the sum of the refunds of its
+// returns and CreditedAmount the part of it taken off the outstanding
+// balance instead of paid back. SettledAmount is what the payments cover
+// less the refunds paid back, and OutstandingAmount the part of the total,
+// less the refunds, still to be paid. VoidedAt, VoidedBy
+// and VoidReason are set once the transaction is voided.
 type Transaction struct {
-	ID          int                 `json:"id" db:"id"`
-	TotalAmount int                 `json:"total_amount" db:"total_amount"`
-	CreatedAt   time.Time           `json:"created_at" db:"created_at"`
-	Details     []TransactionDetail `json:"details" db:"-"`
+	ID                int                 `json:"id" db:"id"`
+	OutletID          int                 `json:"outlet_id" db:"outlet_id"`
+	TotalAmount       int                 `json:"total_amount" db:"total_amount"`
+	PaidAmount        int                 `json:"paid_amount" db:"paid_amount"`
+	ChangeAmount      int                 `json:"change_amount" db:"change_amount"`
+	SettledAmount     int                 `json:"settled_amount" db:"-"`
+	OutstandingAmount int                 `json:"outstanding_amount" db:"-"`
+	RefundedAmount    int                 `json:"refunded_amount" db:"-"`
+	CreditedAmount    int                 `json:"credited_amount" db:"-"`
+	CreatedAt         time.Time           `json:"created_at" db:"created_at"`
+	VoidedAt          *time.Time          `json:"voided_at,omitempty" db:"voided_at"`
+	VoidedBy          string              `json:"voided_by,omitempty" db:"voided_by"`
+	VoidReason        string              `json:"void_reason,omitempty" db:"void_reason"`
+	Details           []TransactionDetail `json:"details" db:"-"`
+	Payments          []Payment           `json:"payments,omitempty" db:"-"`
+}
+
+// TransactionSummary is a transaction as listed by ListTransactions, without
+// its details and payments
+type TransactionSummary struct {
+	ID                int        `json:"id"`
+	OutletID          int        `json:"outlet_id"`
+	TotalAmount       int        `json:"total_amount"`
+	PaidAmount        int        `json:"paid_amount"`
+	ChangeAmount      int        `json:"change_amount"`
+	SettledAmount     int        `json:"settled_amount"`
+	OutstandingAmount int        `json:"outstanding_amount"`
+	RefundedAmount    int        `json:"refunded_amount"`
+	CreditedAmount    int        `json:"credited_amount"`
+	CreatedAt         time.Time  `json:"created_at"`
+	VoidedAt          *time.Time `json:"voided_at,omitempty"`
+	VoidedBy          string     `json:"voided_by,omitempty"`
+	VoidReason        string     `json:"void_reason,omitempty"`
+}
+
+// summary returns t without its details and payments
+func (t Transaction) summary() TransactionSummary {
+	return TransactionSummary{
+		ID:                t.ID,
+		OutletID:          t.OutletID,
+		TotalAmount:       t.TotalAmount,
+		PaidAmount:        t.PaidAmount,
+		ChangeAmount:      t.ChangeAmount,
+		SettledAmount:     t.SettledAmount,
+		OutstandingAmount: t.OutstandingAmount,
+		RefundedAmount:    t.RefundedAmount,
+		CreditedAmount:    t.CreditedAmount,
+		CreatedAt:         t.CreatedAt,
+		VoidedAt:          t.VoidedAt,
+		VoidedBy:          t.VoidedBy,
+		VoidReason:        t.VoidReason,
+	}
+}
+
+// setSettlement derives the settled and outstanding amounts from the
+// payment and refund totals
+func (t *Transaction) setSettlement() {
+	t.SettledAmount = t.PaidAmount - t.ChangeAmount - (t.RefundedAmount - t.CreditedAmount)
+	t.OutstandingAmount = t.TotalAmount - t.RefundedAmount - t.SettledAmount
 }
 
 // TransactionDetail represents each item in a transaction
@@ -30,120 +121,486 @@ type TransactionDetail struct {
 	ProductID     int    `json:"product_id" db:"product_id"`
 	ProductName   string `json:"product_name" db:"product_name"`
 	ProductDesc   string `json:"product_description" db:"product_description"`
+	VariantID     int    `json:"variant_id,omitempty" db:"variant_id"`
+	VariantName   string `json:"variant_name,omitempty" db:"variant_name"`
+	CategoryID    int    `json:"category_id,omitempty" db:"category_id"`
 	UnitPrice     int    `json:"unit_price" db:"unit_price"`
 	Quantity      int    `json:"quantity" db:"quantity"`
 	Subtotal      int    `json:"subtotal" db:"subtotal"`
+	// ReturnedQuantity is the part of Quantity that was returned.
+	ReturnedQuantity int `json:"returned_quantity" db:"-"`
+	// Lots lists the lots the quantity was taken from, earliest expiry first.
+	// Quantity not covered by lots came from stock outside lots.
+	Lots []LotUsage `json:"lots,omitempty" db:"-"`
 }
 
 // CheckoutRequest represents a checkout request payload
-// Items are validated in the API and database layers.
+// Items are validated in the API and database layers. Stock is taken from
+// OutletID, or from the default outlet when it is not set. Payments are
+// optional; when given they must cover the total, and without them the
+// total stays outstanding until settled with AddPayments.
 type CheckoutRequest struct {
-	Items []CheckoutItem `json:"items"`
+	OutletID int               `json:"outlet_id" validate:"nullable,min=1"`
+	Items    []CheckoutItem    `json:"items" validate:"required"`
+	Payments []CheckoutPayment `json:"payments,omitempty" validate:"nullable,max=20"`
 }
 
 // CheckoutItem represents a product purchase line
-// ProductID is required and Quantity must be > 0.
+// The product is identified by exactly one of ProductID, Barcode or SKU, or a
+// variant is chosen by VariantID (optionally together with its ProductID).
+// A barcode may belong to a product or to a variant. Quantity must be > 0.
 type CheckoutItem struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
+	ProductID int    `json:"product_id,omitempty"`
+	VariantID int    `json:"variant_id,omitempty"`
+	Barcode   string `json:"barcode,omitempty"`
+	SKU       string `json:"sku,omitempty"`
+	Quantity  int    `json:"quantity"`
+}
+
+// valid reports whether the item has a positive quantity and an unambiguous identifier
+func (item CheckoutItem) valid() bool {
+	if item.Quantity <= 0 || item.ProductID < 0 || item.VariantID < 0 {
+		return false
+	}
+	if item.VariantID != 0 {
+		return item.Barcode == "" && item.SKU == ""
+	}
+	set := 0
+	if item.ProductID != 0 {
+		set++
+	}
+	if item.Barcode != "" {
+		set++
+	}
+	if item.SKU != "" {
+		set++
+	}
+	return set == 1
+}
+
+// lockCheckoutItem resolves item to a product or variant row and locks it FOR UPDATE.
+// It returns a detail snapshot (VariantID is set when the stock lives on a variant)
+// together with the current stock of the locked row. Soft-deleted products
+// return ErrProductDeleted; deleted variants are not found.
+func lockCheckoutItem(tx *sql.Tx, tables Tables, item CheckoutItem) (TransactionDetail, int, error) {
+	productQuery := fmt.Sprintf("SELECT p.id, p.name, p.price, p.stock, COALESCE(c.description, ''), COALESCE(p.category_id, 0), p.deleted_at IS NOT NULL FROM %s p LEFT JOIN %s c ON p.category_id = c.id WHERE p.%%s = $1 FOR UPDATE OF p", tables.Product, tables.Category)
+	variantQuery := fmt.Sprintf("SELECT p.id, p.name, v.price, v.stock, COALESCE(c.description, ''), COALESCE(p.category_id, 0), p.deleted_at IS NOT NULL, v.id, v.name FROM %s v JOIN %s p ON v.product_id = p.id LEFT JOIN %s c ON p.category_id = c.id WHERE v.%%s = $1 AND v.deleted_at IS NULL FOR UPDATE OF v", tables.ProductVariant, tables.Product, tables.Category)
+
+	var d TransactionDetail
+	var stock int
+	var deleted bool
+	lockProduct := func(column string, value interface{}) error {
+		return tx.QueryRow(fmt.Sprintf(productQuery, column), value).Scan(&d.ProductID, &d.ProductName, &d.UnitPrice, &stock, &d.ProductDesc, &d.CategoryID, &deleted)
+	}
+	lockVariant := func(column string, value interface{}) error {
+		return tx.QueryRow(fmt.Sprintf(variantQuery, column), value).Scan(&d.ProductID, &d.ProductName, &d.UnitPrice, &stock, &d.ProductDesc, &d.CategoryID, &deleted, &d.VariantID, &d.VariantName)
+	}
+
+	var err error
+	switch {
+	case item.VariantID != 0:
+		err = lockVariant("id", item.VariantID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && item.ProductID != 0 && item.ProductID != d.ProductID) {
+			return TransactionDetail{}, 0, ErrVariantNotFound
+		}
+	case item.Barcode != "":
+		err = lockProduct("barcode", item.Barcode)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = lockVariant("barcode", item.Barcode)
+		}
+	case item.SKU != "":
+		err = lockProduct("sku", item.SKU)
+	default:
+		err = lockProduct("id", item.ProductID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TransactionDetail{}, 0, ErrProductNotFound
+		}
+		return TransactionDetail{}, 0, fmt.Errorf("failed to fetch product: %w", translateError(err))
+	}
+	if deleted {
+		return TransactionDetail{}, 0, ErrProductDeleted
+	}
+	return d, stock, nil
+}
+
+// Checkout creates a transaction, updates product or variant stocks, and inserts transaction details atomically.
+// The stock is taken from outletID, or from DefaultOutletID when it is 0, and
+// each line needs enough stock at that outlet. Each line takes its stock from
+// the outlet's lots first-expired-first-out; expired lots cannot be sold. Every stock change is recorded
+// as a sale movement referencing the transaction. Payments, when given, are
+// checked against the total by settlePayments and recorded with the
+// transaction; a shortfall returns a *PaymentError.
+func Checkout(db *sql.DB, tables Tables, outletID int, items []CheckoutItem, payments []CheckoutPayment) (Transaction, error) {
+	transaction, _, _, err := checkout(db, tables, "", "", CheckoutRequest{OutletID: outletID, Items: items, Payments: payments})
+	return transaction, err
 }
 
-// Checkout creates a transaction, updates product stocks, and inserts transaction details atomically.
-func Checkout(db *sql.DB, productTable, categoryTable, transactionTable, transactionDetailTable string, items []CheckoutItem) (Transaction, error) {
+// IdempotentCheckout runs Checkout for req at most once per key and returns
+// the JSON encoding of the created transaction, which is stored with the key.
+// A retry with the same key and an identical request returns the stored
+// response unchanged with replayed set, and a different request under the
+// key returns ErrIdempotencyConflict. A retry that arrives while the first
+// request is still running waits for it to finish. Failed checkouts do not
+// use up the key.
+func IdempotentCheckout(db *sql.DB, tables Tables, key string, req CheckoutRequest) (response []byte, replayed bool, err error) {
+	hash, err := requestHash(req)
+	if err != nil {
+		return nil, false, err
+	}
+	_, response, replayed, err = checkout(db, tables, key, hash, req)
+	return response, replayed, err
+}
+
+// checkout implements Checkout. With a non-empty key the key is locked for the
+// database transaction and stored with the request hash and the response at
+// commit, and a completed checkout under the key returns its stored response
+// instead.
+func checkout(db *sql.DB, tables Tables, key, hash string, req CheckoutRequest) (Transaction, []byte, bool, error) {
+	items := req.Items
 	if len(items) == 0 {
-		return Transaction{}, ErrCheckoutEmptyItems
+		return Transaction{}, nil, false, ErrCheckoutEmptyItems
+	}
+	outletID := req.OutletID
+	if outletID == 0 {
+		outletID = DefaultOutletID
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		return Transaction{}, fmt.Errorf("failed to begin transaction: %w", err)
+		return Transaction{}, nil, false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
 	rollback := func() {
 		_ = tx.Rollback()
 	}
 
-	getProductQuery := fmt.Sprintf("SELECT p.id, p.name, p.price, p.stock, COALESCE(c.description, '') FROM %s p LEFT JOIN %s c ON p.category_id = c.id WHERE p.id = $1 FOR UPDATE OF p", productTable, categoryTable)
-	updateStockQuery := fmt.Sprintf("UPDATE %s SET stock = $1 WHERE id = $2", productTable)
+	if key != "" {
+		// Blocks while another request holds the key, so duplicates never
+		// both reach the stock
+		response, err := claimIdempotencyKey(tx, tables.IdempotencyKey, key, hash)
+		if err != nil {
+			rollback()
+			return Transaction{}, nil, false, err
+		}
+		if response != nil {
+			rollback()
+			return Transaction{}, response, true, nil
+		}
+	}
+
+	if err = checkOutlet(tx, tables.Outlet, outletID); err != nil {
+		rollback()
+		return Transaction{}, nil, false, err
+	}
+
+	updateStockQuery := fmt.Sprintf("UPDATE %s SET stock = $1 WHERE id = $2", tables.Product)
+	updateVariantStockQuery := fmt.Sprintf("UPDATE %s SET stock = $1 WHERE id = $2", tables.ProductVariant)
 
 	var details []TransactionDetail
+	var movements []InventoryMovement
 	totalAmount := 0
 
 	for _, item := range items {
-		if item.ProductID <= 0 || item.Quantity <= 0 {
+		if !item.valid() {
 			rollback()
-			return Transaction{}, ErrInvalidCheckoutItem
+			return Transaction{}, nil, false, ErrInvalidCheckoutItem
 		}
 
-		var (
-			productID   int
-			productName string
-			productDesc string
-			price       int
-			stock       int
-		)
-
-		err = tx.QueryRow(getProductQuery, item.ProductID).Scan(&productID, &productName, &price, &stock, &productDesc)
+		detail, stock, err := lockCheckoutItem(tx, tables, item)
 		if err != nil {
 			rollback()
-			if errors.Is(err, sql.ErrNoRows) {
-				return Transaction{}, ErrProductNotFound
-			}
-			return Transaction{}, fmt.Errorf("failed to fetch product: %w", err)
+			return Transaction{}, nil, false, err
 		}
 
-		// Validation: with FOR UPDATE lock, ensure stock is enough to avoid oversell
-		if stock < item.Quantity {
+		// Validation: with FOR UPDATE lock, ensure the outlet's stock is enough to avoid oversell
+		remaining, err := changeOutletStock(tx, tables.OutletStock, outletID, detail.ProductID, detail.VariantID, -item.Quantity)
+		if err != nil {
 			rollback()
-			return Transaction{}, ErrInsufficientStock
+			return Transaction{}, nil, false, err
+		}
+		if detail.Lots, err = sellLots(tx, tables.Lot, outletID, detail.ProductID, detail.VariantID, item.Quantity, remaining); err != nil {
+			rollback()
+			return Transaction{}, nil, false, err
 		}
 
 		newStock := stock - item.Quantity
-		_, err = tx.Exec(updateStockQuery, newStock, productID)
+		if detail.VariantID != 0 {
+			_, err = tx.Exec(updateVariantStockQuery, newStock, detail.VariantID)
+		} else {
+			_, err = tx.Exec(updateStockQuery, newStock, detail.ProductID)
+		}
 		if err != nil {
 			rollback()
-			return Transaction{}, fmt.Errorf("failed to update stock: %w", err)
+			return Transaction{}, nil, false, fmt.Errorf("failed to update stock: %w", translateError(err))
 		}
 
-		subtotal := price * item.Quantity
-		totalAmount += subtotal
+		detail.Quantity = item.Quantity
+		detail.Subtotal = detail.UnitPrice * item.Quantity
+		totalAmount += detail.Subtotal
 
-		details = append(details, TransactionDetail{
-			ProductID:   productID,
-			ProductName: productName,
-			ProductDesc: productDesc,
-			UnitPrice:   price,
-			Quantity:    item.Quantity,
-			Subtotal:    subtotal,
-		})
+		details = append(details, detail)
+		movements = append(movements, InventoryMovement{ProductID: detail.ProductID, VariantID: detail.VariantID, OutletID: outletID, Delta: -item.Quantity, Balance: newStock, Reason: MovementSale})
 	}
 
-	insertTransactionQuery := fmt.Sprintf("INSERT INTO %s (total_amount) VALUES ($1) RETURNING id, total_amount, created_at", transactionTable)
+	payments := []Payment{}
+	paidAmount, changeAmount := 0, 0
+	if len(req.Payments) > 0 {
+		if payments, err = settlePayments(req.Payments, totalAmount, false); err != nil {
+			rollback()
+			return Transaction{}, nil, false, err
+		}
+		for _, p := range payments {
+			paidAmount += p.Amount
+			changeAmount += p.ChangeAmount
+		}
+	}
+
+	insertTransactionQuery := fmt.Sprintf("INSERT INTO %s (outlet_id, total_amount, paid_amount, change_amount) VALUES ($1, $2, $3, $4) RETURNING id, outlet_id, total_amount, paid_amount, change_amount, created_at", tables.Transaction)
 	var transaction Transaction
 	transaction.Details = details
 	transaction.TotalAmount = totalAmount
+	transaction.Payments = payments
 
-	err = tx.QueryRow(insertTransactionQuery, totalAmount).Scan(&transaction.ID, &transaction.TotalAmount, &transaction.CreatedAt)
+	err = tx.QueryRow(insertTransactionQuery, outletID, totalAmount, paidAmount, changeAmount).Scan(&transaction.ID, &transaction.OutletID, &transaction.TotalAmount, &transaction.PaidAmount, &transaction.ChangeAmount, &transaction.CreatedAt)
 	if err != nil {
 		rollback()
-		return Transaction{}, fmt.Errorf("failed to create transaction: %w", err)
+		return Transaction{}, nil, false, fmt.Errorf("failed to create transaction: %w", translateError(err))
 	}
 
-	insertDetailQuery := fmt.Sprintf("INSERT INTO %s (transaction_id, product_id, product_name, product_description, unit_price, quantity, subtotal) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", transactionDetailTable)
+	insertDetailQuery := fmt.Sprintf("INSERT INTO %s (transaction_id, product_id, product_name, product_description, unit_price, quantity, subtotal, variant_id, variant_name, category_id) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9, NULLIF($10, 0)) RETURNING id", tables.TransactionDetail)
+	insertLotQuery := fmt.Sprintf("INSERT INTO %s (transaction_detail_id, lot_id, quantity) VALUES ($1, $2, $3)", tables.TransactionLot)
 	for i := range transaction.Details {
 		detail := &transaction.Details[i]
 		detail.TransactionID = transaction.ID
-		err = tx.QueryRow(insertDetailQuery, transaction.ID, detail.ProductID, detail.ProductName, detail.ProductDesc, detail.UnitPrice, detail.Quantity, detail.Subtotal).Scan(&detail.ID)
+		err = tx.QueryRow(insertDetailQuery, transaction.ID, detail.ProductID, detail.ProductName, detail.ProductDesc, detail.UnitPrice, detail.Quantity, detail.Subtotal, detail.VariantID, detail.VariantName, detail.CategoryID).Scan(&detail.ID)
 		if err != nil {
 			rollback()
-			return Transaction{}, fmt.Errorf("failed to create transaction detail: %w", err)
+			return Transaction{}, nil, false, fmt.Errorf("failed to create transaction detail: %w", translateError(err))
+		}
+		for _, lot := range detail.Lots {
+			if _, err = tx.Exec(insertLotQuery, detail.ID, lot.LotID, lot.Quantity); err != nil {
+				rollback()
+				return Transaction{}, nil, false, fmt.Errorf("failed to record transaction detail lot: %w", translateError(err))
+			}
+		}
+	}
+
+	if err = insertPayments(tx, tables.Payment, transaction.ID, transaction.Payments); err != nil {
+		rollback()
+		return Transaction{}, nil, false, err
+	}
+	transaction.setSettlement()
+
+	for _, m := range movements {
+		m.ReferenceID = transaction.ID
+		if err = recordMovement(tx, tables.InventoryMovement, m); err != nil {
+			rollback()
+			return Transaction{}, nil, false, err
+		}
+	}
+
+	var response []byte
+	if key != "" {
+		if response, err = recordIdempotencyKey(tx, tables.IdempotencyKey, key, hash, transaction); err != nil {
+			rollback()
+			return Transaction{}, nil, false, err
 		}
 	}
 
 	if err = tx.Commit(); err != nil {
 		rollback()
-		return Transaction{}, fmt.Errorf("failed to commit transaction: %w", err)
+		return Transaction{}, nil, false, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+
+	return transaction, response, false, nil
+}
+
+// GetTransaction retrieves a transaction with its details, the lots each
+// detail was taken from, its payments and the refunded amount and
+// quantities of its returns
+func GetTransaction(db *sql.DB, tables Tables, id int) (Transaction, error) {
+	var t Transaction
+	query := fmt.Sprintf("SELECT id, outlet_id, total_amount, paid_amount, change_amount, created_at, voided_at, voided_by, void_reason FROM %s WHERE id = $1", tables.Transaction)
+	if err := db.QueryRow(query, id).Scan(&t.ID, &t.OutletID, &t.TotalAmount, &t.PaidAmount, &t.ChangeAmount, &t.CreatedAt, &t.VoidedAt, &t.VoidedBy, &t.VoidReason); err != nil {
+		if err == sql.ErrNoRows {
+			return Transaction{}, ErrTransactionNotFound
+		}
+		return Transaction{}, fmt.Errorf("failed to query transaction: %w", err)
+	}
+	if err := t.loadRefunds(db, tables.Return); err != nil {
+		return Transaction{}, err
+	}
+	t.setSettlement()
+
+	detailQuery := fmt.Sprintf("SELECT d.id, d.transaction_id, d.product_id, d.product_name, d.product_description, COALESCE(d.variant_id, 0), d.variant_name, COALESCE(d.category_id, 0), d.unit_price, d.quantity, d.subtotal, COALESCE((SELECT SUM(rl.quantity) FROM %s rl WHERE rl.transaction_detail_id = d.id), 0) FROM %s d WHERE d.transaction_id = $1 ORDER BY d.id", tables.ReturnLine, tables.TransactionDetail)
+	rows, err := db.Query(detailQuery, id)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to query transaction details: %w", err)
+	}
+	defer rows.Close()
+
+	index := make(map[int]int)
+	for rows.Next() {
+		var d TransactionDetail
+		if err := rows.Scan(&d.ID, &d.TransactionID, &d.ProductID, &d.ProductName, &d.ProductDesc, &d.VariantID, &d.VariantName, &d.CategoryID, &d.UnitPrice, &d.Quantity, &d.Subtotal, &d.ReturnedQuantity); err != nil {
+			return Transaction{}, fmt.Errorf("failed to scan transaction detail: %w", err)
+		}
+		index[d.ID] = len(t.Details)
+		t.Details = append(t.Details, d)
+	}
+	if err = rows.Err(); err != nil {
+		return Transaction{}, fmt.Errorf("error iterating transaction details: %w", err)
+	}
+
+	lotQuery := fmt.Sprintf("SELECT dl.transaction_detail_id, dl.lot_id, l.lot_number, to_char(l.expiry_date, 'YYYY-MM-DD'), dl.quantity FROM %s dl JOIN %s d ON dl.transaction_detail_id = d.id JOIN %s l ON dl.lot_id = l.id WHERE d.transaction_id = $1 ORDER BY l.expiry_date, l.id", tables.TransactionLot, tables.TransactionDetail, tables.Lot)
+	lotRows, err := db.Query(lotQuery, id)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to query transaction lots: %w", err)
+	}
+	defer lotRows.Close()
+
+	for lotRows.Next() {
+		var detailID int
+		var u LotUsage
+		if err := lotRows.Scan(&detailID, &u.LotID, &u.LotNumber, &u.ExpiryDate, &u.Quantity); err != nil {
+			return Transaction{}, fmt.Errorf("failed to scan transaction lot: %w", err)
+		}
+		d := &t.Details[index[detailID]]
+		d.Lots = append(d.Lots, u)
+	}
+	if err = lotRows.Err(); err != nil {
+		return Transaction{}, fmt.Errorf("error iterating transaction lots: %w", err)
+	}
+
+	paymentQuery := fmt.Sprintf("SELECT %s FROM %s WHERE transaction_id = $1 ORDER BY id", paymentColumns, tables.Payment)
+	paymentRows, err := db.Query(paymentQuery, id)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to query transaction payments: %w", err)
+	}
+	defer paymentRows.Close()
+
+	t.Payments = []Payment{}
+	for paymentRows.Next() {
+		var p Payment
+		if err := paymentRows.Scan(p.scanFields()...); err != nil {
+			return Transaction{}, fmt.Errorf("failed to scan transaction payment: %w", err)
+		}
+		t.Payments = append(t.Payments, p)
+	}
+	if err = paymentRows.Err(); err != nil {
+		return Transaction{}, fmt.Errorf("error iterating transaction payments: %w", err)
+	}
+
+	return t, nil
+}
+
+// TransactionListParams controls filtering and pagination of the transaction
+// list, which is ordered by ID. Start and End bound the checkout time to
+// [Start, End), MinAmount and MaxAmount the total amount, ProductID matches
+// transactions with a detail of the product and PaymentMethod transactions
+// with a payment of the method. Voided picks voided or other transactions.
+// Empty filters are not applied.
+type TransactionListParams struct {
+	Limit         int
+	Cursor        string
+	Desc          bool
+	Start         time.Time
+	End           time.Time
+	MinAmount     *int
+	MaxAmount     *int
+	OutletID      int
+	ProductID     int
+	PaymentMethod string
+	Voided        *bool
+}
+
+// ListTransactions retrieves a page of transaction summaries with their
+// refunded amounts
+func ListTransactions(db *sql.DB, tables Tables, params TransactionListParams) (Page[TransactionSummary], error) {
+	dir, op := sortDirection(params.Desc)
+	sortKey := "id:" + dir
+
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !params.Start.IsZero() {
+		conds = append(conds, "t.created_at >= "+arg(params.Start))
+	}
+	if !params.End.IsZero() {
+		conds = append(conds, "t.created_at < "+arg(params.End))
+	}
+	if params.MinAmount != nil {
+		conds = append(conds, "t.total_amount >= "+arg(*params.MinAmount))
+	}
+	if params.MaxAmount != nil {
+		conds = append(conds, "t.total_amount <= "+arg(*params.MaxAmount))
+	}
+	if params.OutletID != 0 {
+		conds = append(conds, "t.outlet_id = "+arg(params.OutletID))
+	}
+	if params.ProductID != 0 {
+		conds = append(conds, fmt.Sprintf("EXISTS (SELECT 1 FROM %s d WHERE d.transaction_id = t.id AND d.product_id = %s)", tables.TransactionDetail, arg(params.ProductID)))
+	}
+	if params.PaymentMethod != "" {
+		conds = append(conds, fmt.Sprintf("EXISTS (SELECT 1 FROM %s p WHERE p.transaction_id = t.id AND p.method = %s)", tables.Payment, arg(params.PaymentMethod)))
+	}
+	if params.Voided != nil {
+		if *params.Voided {
+			conds = append(conds, "t.voided_at IS NOT NULL")
+		} else {
+			conds = append(conds, "t.voided_at IS NULL")
+		}
+	}
+
+	page := Page[TransactionSummary]{Data: []TransactionSummary{}}
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s t%s", tables.Transaction, whereClause(conds))
+	if err := db.QueryRow(countQuery, args...).Scan(&page.Total); err != nil {
+		return Page[TransactionSummary]{}, fmt.Errorf("failed to count transactions: %w", err)
+	}
+
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor, sortKey)
+		if err != nil {
+			return Page[TransactionSummary]{}, err
+		}
+		conds = append(conds, fmt.Sprintf("t.id %s %s", op, arg(c.ID)))
+	}
+
+	limit := normalizeLimit(params.Limit)
+	query := fmt.Sprintf(`
+	SELECT t.id, t.outlet_id, t.total_amount, t.paid_amount, t.change_amount, t.created_at, t.voided_at, t.voided_by, t.void_reason,
+		COALESCE(r.refunded, 0), COALESCE(r.credited, 0)
+	FROM %s t LEFT JOIN (SELECT transaction_id, SUM(refund_amount) AS refunded, SUM(credited_amount) AS credited FROM %s GROUP BY transaction_id) r ON r.transaction_id = t.id%s ORDER BY t.id %s LIMIT %s`, tables.Transaction, tables.Return, whereClause(conds), dir, arg(limit+1))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Page[TransactionSummary]{}, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Transaction
+		if err := rows.Scan(&t.ID, &t.OutletID, &t.TotalAmount, &t.PaidAmount, &t.ChangeAmount, &t.CreatedAt, &t.VoidedAt, &t.VoidedBy, &t.VoidReason, &t.RefundedAmount, &t.CreditedAmount); err != nil {
+			return Page[TransactionSummary]{}, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		t.setSettlement()
+		page.Data = append(page.Data, t.summary())
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page[TransactionSummary]{}, fmt.Errorf("error iterating transactions: %w", err)
+	}
+
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		last := page.Data[limit-1]
+		page.NextCursor = encodeCursor(sortKey, strconv.Itoa(last.ID), last.ID)
 	}
 
-	return transaction, nil
+	return page, nil
 }
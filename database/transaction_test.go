@@ -1,22 +1,28 @@
 package database
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
 
 func TestCheckoutSuccess(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Food", "Food category")
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod1, err := CreateProduct(db, "product_test", "category_test", "Apple", 10, 50, cat.ID)
+	prod1, err := CreateProduct(db, TestTables, Product{Name: "Apple", Price: 10, Stock: 50, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
-	prod2, err := CreateProduct(db, "product_test", "category_test", "Orange", 20, 30, cat.ID)
+	prod2, err := CreateProduct(db, TestTables, Product{Name: "Orange", Price: 20, Stock: 30, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
@@ -26,7 +32,7 @@ func TestCheckoutSuccess(t *testing.T) {
 		{ProductID: prod2.ID, Quantity: 2},
 	}
 
-	trx, err := Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", items)
+	trx, err := Checkout(db, TestTables, 0, items, nil)
 	if err != nil {
 		t.Fatalf("Checkout failed: %v", err)
 	}
@@ -53,7 +59,7 @@ func TestCheckoutSuccess(t *testing.T) {
 		t.Errorf("Expected product description 'Food category', got %s", trx.Details[0].ProductDesc)
 	}
 
-	updated1, err := GetProductByID(db, "product_test", "category_test", prod1.ID)
+	updated1, err := GetProductByID(db, TestTables, prod1.ID)
 	if err != nil {
 		t.Fatalf("Failed to fetch product after checkout: %v", err)
 	}
@@ -61,7 +67,7 @@ func TestCheckoutSuccess(t *testing.T) {
 		t.Errorf("Expected stock 47, got %d", updated1.Stock)
 	}
 
-	updated2, err := GetProductByID(db, "product_test", "category_test", prod2.ID)
+	updated2, err := GetProductByID(db, TestTables, prod2.ID)
 	if err != nil {
 		t.Fatalf("Failed to fetch product after checkout: %v", err)
 	}
@@ -74,12 +80,12 @@ func TestCheckoutWithoutCategory(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	prod, err := CreateProduct(db, "product_test", "category_test", "NoCatItem", 100, 5, 0)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "NoCatItem", Price: 100, Stock: 5})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
-	trx, err := Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{{ProductID: prod.ID, Quantity: 1}})
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 1}}, nil)
 	if err != nil {
 		t.Fatalf("Checkout failed: %v", err)
 	}
@@ -95,30 +101,37 @@ func TestCheckoutInsufficientStock(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Food", "Food category")
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod, err := CreateProduct(db, "product_test", "category_test", "Apple", 10, 1, cat.ID)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Apple", Price: 10, Stock: 1, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
-	_, err = Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{{ProductID: prod.ID, Quantity: 2}})
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 2}}, nil)
 	if err == nil {
 		t.Fatal("Expected insufficient stock error")
 	}
-	if err != ErrInsufficientStock {
+	if !errors.Is(err, ErrInsufficientStock) {
 		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
 	}
+	var stockErr *StockError
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("Expected *StockError, got %T", err)
+	}
+	if stockErr.ProductID != prod.ID || stockErr.Requested != 2 || stockErr.Available != 1 {
+		t.Errorf("Unexpected stock error details: %+v", stockErr)
+	}
 }
 
 func TestCheckoutProductNotFound(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	_, err := Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{{ProductID: 9999, Quantity: 1}})
+	_, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: 9999, Quantity: 1}}, nil)
 	if err == nil {
 		t.Fatal("Expected product not found error")
 	}
@@ -131,7 +144,7 @@ func TestCheckoutInvalidItems(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	_, err := Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{})
+	_, err := Checkout(db, TestTables, 0, []CheckoutItem{}, nil)
 	if err == nil {
 		t.Fatal("Expected empty items error")
 	}
@@ -139,7 +152,7 @@ func TestCheckoutInvalidItems(t *testing.T) {
 		t.Fatalf("Expected ErrCheckoutEmptyItems, got %v", err)
 	}
 
-	_, err = Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{{ProductID: 1, Quantity: 0}})
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: 1, Quantity: 0}}, nil)
 	if err == nil {
 		t.Fatal("Expected invalid item error")
 	}
@@ -147,7 +160,7 @@ func TestCheckoutInvalidItems(t *testing.T) {
 		t.Fatalf("Expected ErrInvalidCheckoutItem, got %v", err)
 	}
 
-	_, err = Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{{ProductID: 0, Quantity: 1}})
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: 0, Quantity: 1}}, nil)
 	if err == nil {
 		t.Fatal("Expected invalid item error for product_id 0")
 	}
@@ -155,7 +168,7 @@ func TestCheckoutInvalidItems(t *testing.T) {
 		t.Fatalf("Expected ErrInvalidCheckoutItem, got %v", err)
 	}
 
-	_, err = Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{{ProductID: 1, Quantity: -2}})
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: 1, Quantity: -2}}, nil)
 	if err == nil {
 		t.Fatal("Expected invalid item error for negative quantity")
 	}
@@ -168,20 +181,20 @@ func TestCheckoutRollbackOnInvalidItem(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Food", "Food category")
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod, err := CreateProduct(db, "product_test", "category_test", "Apple", 10, 10, cat.ID)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Apple", Price: 10, Stock: 10, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
-	_, err = Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{
 		{ProductID: prod.ID, Quantity: 2},
 		{ProductID: 0, Quantity: 1},
-	})
+	}, nil)
 	if err == nil {
 		t.Fatal("Expected invalid item error")
 	}
@@ -189,7 +202,7 @@ func TestCheckoutRollbackOnInvalidItem(t *testing.T) {
 		t.Fatalf("Expected ErrInvalidCheckoutItem, got %v", err)
 	}
 
-	updated, err := GetProductByID(db, "product_test", "category_test", prod.ID)
+	updated, err := GetProductByID(db, TestTables, prod.ID)
 	if err != nil {
 		t.Fatalf("Failed to fetch product after rollback: %v", err)
 	}
@@ -202,33 +215,33 @@ func TestCheckoutRollbackOnInsufficientStockSecondItem(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Food", "Food category")
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod1, err := CreateProduct(db, "product_test", "category_test", "Apple", 10, 10, cat.ID)
+	prod1, err := CreateProduct(db, TestTables, Product{Name: "Apple", Price: 10, Stock: 10, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
-	prod2, err := CreateProduct(db, "product_test", "category_test", "Orange", 20, 1, cat.ID)
+	prod2, err := CreateProduct(db, TestTables, Product{Name: "Orange", Price: 20, Stock: 1, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
-	_, err = Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{
 		{ProductID: prod1.ID, Quantity: 2},
 		{ProductID: prod2.ID, Quantity: 2},
-	})
+	}, nil)
 	if err == nil {
 		t.Fatal("Expected insufficient stock error")
 	}
-	if err != ErrInsufficientStock {
+	if !errors.Is(err, ErrInsufficientStock) {
 		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
 	}
 
-	updated1, err := GetProductByID(db, "product_test", "category_test", prod1.ID)
+	updated1, err := GetProductByID(db, TestTables, prod1.ID)
 	if err != nil {
 		t.Fatalf("Failed to fetch product after rollback: %v", err)
 	}
@@ -236,7 +249,7 @@ func TestCheckoutRollbackOnInsufficientStockSecondItem(t *testing.T) {
 		t.Errorf("Expected stock 10 after rollback, got %d", updated1.Stock)
 	}
 
-	updated2, err := GetProductByID(db, "product_test", "category_test", prod2.ID)
+	updated2, err := GetProductByID(db, TestTables, prod2.ID)
 	if err != nil {
 		t.Fatalf("Failed to fetch product after rollback: %v", err)
 	}
@@ -249,20 +262,20 @@ func TestCheckoutRollbackOnProductNotFoundSecondItem(t *testing.T) {
 	db := setupProductTestDB(t)
 	defer teardownProductTestDB(t, db)
 
-	cat, err := Create(db, "category_test", "Food", "Food category")
+	cat, err := Create(db, "category_test", "Food", stringPtr("Food category"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create category: %v", err)
 	}
 
-	prod, err := CreateProduct(db, "product_test", "category_test", "Apple", 10, 10, cat.ID)
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Apple", Price: 10, Stock: 10, CategoryID: cat.ID})
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
-	_, err = Checkout(db, "product_test", "category_test", "transaction_test", "transaction_detail_test", []CheckoutItem{
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{
 		{ProductID: prod.ID, Quantity: 2},
 		{ProductID: 9999, Quantity: 1},
-	})
+	}, nil)
 	if err == nil {
 		t.Fatal("Expected product not found error")
 	}
@@ -270,7 +283,7 @@ func TestCheckoutRollbackOnProductNotFoundSecondItem(t *testing.T) {
 		t.Fatalf("Expected ErrProductNotFound, got %v", err)
 	}
 
-	updated, err := GetProductByID(db, "product_test", "category_test", prod.ID)
+	updated, err := GetProductByID(db, TestTables, prod.ID)
 	if err != nil {
 		t.Fatalf("Failed to fetch product after rollback: %v", err)
 	}
@@ -278,3 +291,233 @@ func TestCheckoutRollbackOnProductNotFoundSecondItem(t *testing.T) {
 		t.Errorf("Expected stock 10 after rollback, got %d", updated.Stock)
 	}
 }
+
+func TestCheckoutDeletedProduct(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Apple", Price: 10, Stock: 10, Barcode: "4006381333931"})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if err := DeleteProduct(db, TestTables, prod.ID, 0); err != nil {
+		t.Fatalf("DeleteProduct failed: %v", err)
+	}
+
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 1}}, nil)
+	if err != ErrProductDeleted {
+		t.Errorf("Expected ErrProductDeleted by id, got %v", err)
+	}
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{Barcode: "4006381333931", Quantity: 1}}, nil)
+	if err != ErrProductDeleted {
+		t.Errorf("Expected ErrProductDeleted by barcode, got %v", err)
+	}
+
+	if _, err := RestoreProduct(db, TestTables, prod.ID); err != nil {
+		t.Fatalf("RestoreProduct failed: %v", err)
+	}
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID, Quantity: 1}}, nil); err != nil {
+		t.Errorf("Checkout after restore failed: %v", err)
+	}
+}
+
+func TestCheckoutByBarcodeAndSKU(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod1, err := CreateProduct(db, TestTables, Product{Name: "Indomie Goreng", Price: 3500, Stock: 10, Barcode: "089686010947"})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	prod2, err := CreateProduct(db, TestTables, Product{Name: "Teh Botol", Price: 4000, Stock: 10, SKU: "TEH-BTL"})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{
+		{Barcode: "089686010947", Quantity: 2},
+		{SKU: "TEH-BTL", Quantity: 1},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if trx.TotalAmount != 2*3500+4000 {
+		t.Errorf("Expected total amount %d, got %d", 2*3500+4000, trx.TotalAmount)
+	}
+	if trx.Details[0].ProductID != prod1.ID || trx.Details[1].ProductID != prod2.ID {
+		t.Errorf("Expected details for products %d and %d, got %+v", prod1.ID, prod2.ID, trx.Details)
+	}
+
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{Barcode: "4006381333931", Quantity: 1}}, nil)
+	if err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound for unknown barcode, got %v", err)
+	}
+
+	// More than one identifier on the same line is ambiguous
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod1.ID, SKU: "TEH-BTL", Quantity: 1}}, nil)
+	if err != ErrInvalidCheckoutItem {
+		t.Errorf("Expected ErrInvalidCheckoutItem, got %v", err)
+	}
+}
+
+func TestIdempotentCheckout(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kopi Susu", Price: 18000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	req := CheckoutRequest{Items: []CheckoutItem{{ProductID: prod.ID, Quantity: 2}}}
+
+	// Two tablets retrying at the same time must not both check out
+	type result struct {
+		response []byte
+		replayed bool
+		err      error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			response, replayed, err := IdempotentCheckout(db, TestTables, "till-1-0001", req)
+			results <- result{response, replayed, err}
+		}()
+	}
+	first, second := <-results, <-results
+	if first.err != nil || second.err != nil {
+		t.Fatalf("IdempotentCheckout failed: %v, %v", first.err, second.err)
+	}
+	if !bytes.Equal(first.response, second.response) || first.replayed == second.replayed {
+		t.Errorf("Expected one checkout and an identical replay of it, got %s and %s", first.response, second.response)
+	}
+	var trx Transaction
+	if err := json.Unmarshal(second.response, &trx); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(trx.Details) != 1 || trx.Details[0].Quantity != 2 || trx.TotalAmount != 36000 {
+		t.Errorf("Unexpected replayed transaction: %+v", trx)
+	}
+
+	updated, err := GetProductByID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 8 {
+		t.Errorf("Expected stock to be deducted once to 8, got %d", updated.Stock)
+	}
+
+	// A replay returns the original response, not the transaction as it is now
+	if _, err := CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: trx.Details[0].ID, Quantity: 1}}, "Tumpah"); err != nil {
+		t.Fatalf("CreateReturn failed: %v", err)
+	}
+	response, replayed, err := IdempotentCheckout(db, TestTables, "till-1-0001", req)
+	if err != nil || !replayed {
+		t.Fatalf("Expected a replay, got replayed=%v err=%v", replayed, err)
+	}
+	if !bytes.Equal(response, first.response) {
+		t.Errorf("Expected the original response %s, got %s", first.response, response)
+	}
+
+	req.Items[0].Quantity = 3
+	if _, _, err := IdempotentCheckout(db, TestTables, "till-1-0001", req); err != ErrIdempotencyConflict {
+		t.Errorf("Expected ErrIdempotencyConflict for a different request, got %v", err)
+	}
+
+	// A failed checkout does not use up its key
+	req.Items[0].Quantity = 99
+	if _, _, err := IdempotentCheckout(db, TestTables, "till-1-0002", req); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	req.Items[0].Quantity = 1
+	if _, replayed, err := IdempotentCheckout(db, TestTables, "till-1-0002", req); err != nil || replayed {
+		t.Errorf("Expected a new checkout under the key of a failed one, got replayed=%v err=%v", replayed, err)
+	}
+}
+
+func TestListTransactions(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	coffee, err := CreateProduct(db, TestTables, Product{Name: "Kopi Susu", Price: 18000, Stock: 20})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	bread, err := CreateProduct(db, TestTables, Product{Name: "Roti Tawar", Price: 15000, Stock: 20})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	cash, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: coffee.ID, Quantity: 1}}, []CheckoutPayment{{Method: PaymentCash, Amount: 20000}})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	qris, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: bread.ID, Quantity: 2}}, []CheckoutPayment{{Method: PaymentQRIS, Amount: 30000, Reference: "QR-1"}})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	voided, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: coffee.ID, Quantity: 3}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := VoidTransaction(db, TestTables, voided.ID, time.Hour, "Kasir 1", "Salah input"); err != nil {
+		t.Fatalf("VoidTransaction failed: %v", err)
+	}
+
+	page, err := ListTransactions(db, TestTables, TransactionListParams{Limit: 2, Desc: true})
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if page.Total != 3 || len(page.Data) != 2 || page.Data[0].ID != voided.ID || page.Data[0].VoidedAt == nil || page.NextCursor == "" {
+		t.Errorf("Unexpected first page: %+v", page)
+	}
+	if page.Data[1].OutstandingAmount != 0 {
+		t.Errorf("Expected a settled transaction, got %+v", page.Data)
+	}
+	page, err = ListTransactions(db, TestTables, TransactionListParams{Limit: 2, Desc: true, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if len(page.Data) != 1 || page.Data[0].ID != cash.ID || page.NextCursor != "" {
+		t.Errorf("Unexpected second page: %+v", page)
+	}
+
+	minAmount := 25000
+	page, err = ListTransactions(db, TestTables, TransactionListParams{MinAmount: &minAmount})
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if page.Total != 2 || page.Data[0].ID != qris.ID {
+		t.Errorf("Expected transactions of at least 25000, got %+v", page)
+	}
+
+	notVoided := false
+	page, err = ListTransactions(db, TestTables, TransactionListParams{ProductID: coffee.ID, Voided: &notVoided})
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if page.Total != 1 || page.Data[0].ID != cash.ID {
+		t.Errorf("Expected only the cash sale of coffee, got %+v", page)
+	}
+
+	page, err = ListTransactions(db, TestTables, TransactionListParams{PaymentMethod: PaymentQRIS})
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if page.Total != 1 || page.Data[0].ID != qris.ID {
+		t.Errorf("Expected only the QRIS sale, got %+v", page)
+	}
+
+	now := time.Now().UTC()
+	page, err = ListTransactions(db, TestTables, TransactionListParams{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("ListTransactions failed: %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("Expected no transactions in the future, got %+v", page)
+	}
+
+	if _, err := ListTransactions(db, TestTables, TransactionListParams{Cursor: "bogus"}); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
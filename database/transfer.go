@@ -0,0 +1,485 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrTransferNotFound       = errors.New("stock transfer not found")
+	ErrInvalidTransfer        = errors.New("invalid stock transfer")
+	ErrTransferStatus         = errors.New("stock transfer status does not allow this change")
+	ErrInvalidTransferReceipt = errors.New("invalid stock transfer receipt")
+)
+
+// Statuses of a stock transfer. A draft has not touched any stock and can be
+// cancelled. Shipping takes the goods out of the source outlet, so they are
+// in transit and count towards no outlet until they are received.
+const (
+	TransferDraft     = "draft"
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// StockTransfer moves stock from one outlet to another
+type StockTransfer struct {
+	ID           int        `json:"id" db:"id"`
+	FromOutletID int        `json:"from_outlet_id" db:"from_outlet_id"`
+	ToOutletID   int        `json:"to_outlet_id" db:"to_outlet_id"`
+	Status       string     `json:"status" db:"status"`
+	Note         string     `json:"note" db:"note"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ShippedAt    *time.Time `json:"shipped_at,omitempty" db:"shipped_at"`
+	ReceivedAt   *time.Time `json:"received_at,omitempty" db:"received_at"`
+	// Lines is only loaded when a single stock transfer is fetched
+	Lines []StockTransferLine `json:"lines,omitempty" db:"-"`
+}
+
+const transferColumns = "id, from_outlet_id, to_outlet_id, status, note, created_at, shipped_at, received_at"
+
+// scanFields returns scan destinations matching transferColumns
+func (t *StockTransfer) scanFields() []interface{} {
+	return []interface{}{&t.ID, &t.FromOutletID, &t.ToOutletID, &t.Status, &t.Note, &t.CreatedAt, &t.ShippedAt, &t.ReceivedAt}
+}
+
+// StockTransferLine is a product, or one of its variants when VariantID is
+// set, moved by a stock transfer. ReceivedQuantity is nil until the transfer
+// is received; Variance is then the received minus the shipped quantity.
+type StockTransferLine struct {
+	ID               int    `json:"id" db:"id"`
+	ProductID        int    `json:"product_id" db:"product_id"`
+	VariantID        int    `json:"variant_id,omitempty" db:"variant_id"`
+	ProductName      string `json:"product_name" db:"-"`
+	Quantity         int    `json:"quantity" db:"quantity"`
+	ReceivedQuantity *int   `json:"received_quantity" db:"received_quantity"`
+	Variance         *int   `json:"variance" db:"-"`
+}
+
+// TransferReceiptLine is the quantity of a transfer line that arrived
+type TransferReceiptLine struct {
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// transferLineKey identifies a line of a stock transfer
+type transferLineKey struct {
+	productID, variantID int
+}
+
+// StockTransferListParams controls filtering and pagination of the stock
+// transfer list, which is ordered by ID. OutletID matches transfers from or
+// to the outlet. Empty filters are not applied.
+type StockTransferListParams struct {
+	Limit    int
+	Cursor   string
+	Desc     bool
+	Status   string
+	OutletID int
+}
+
+// ValidTransferStatus reports whether status is a stock transfer status
+func ValidTransferStatus(status string) bool {
+	switch status {
+	case TransferDraft, TransferInTransit, TransferReceived, TransferCancelled:
+		return true
+	}
+	return false
+}
+
+// GetStockTransfer retrieves a stock transfer with its lines
+func GetStockTransfer(db *sql.DB, tables Tables, id int) (StockTransfer, error) {
+	var t StockTransfer
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", transferColumns, tables.StockTransfer)
+	if err := db.QueryRow(query, id).Scan(t.scanFields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return StockTransfer{}, ErrTransferNotFound
+		}
+		return StockTransfer{}, fmt.Errorf("failed to query stock transfer: %w", err)
+	}
+
+	linesQuery := fmt.Sprintf("SELECT l.id, l.product_id, l.variant_id, COALESCE(p.name, ''), l.quantity, l.received_quantity FROM %s l LEFT JOIN %s p ON l.product_id = p.id WHERE l.stock_transfer_id = $1 ORDER BY l.id", tables.TransferLine, tables.Product)
+	rows, err := db.Query(linesQuery, id)
+	if err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to query stock transfer lines: %w", err)
+	}
+	defer rows.Close()
+
+	t.Lines = []StockTransferLine{}
+	for rows.Next() {
+		var line StockTransferLine
+		if err := rows.Scan(&line.ID, &line.ProductID, &line.VariantID, &line.ProductName, &line.Quantity, &line.ReceivedQuantity); err != nil {
+			return StockTransfer{}, fmt.Errorf("failed to scan stock transfer line: %w", err)
+		}
+		if line.ReceivedQuantity != nil {
+			variance := *line.ReceivedQuantity - line.Quantity
+			line.Variance = &variance
+		}
+		t.Lines = append(t.Lines, line)
+	}
+
+	if err = rows.Err(); err != nil {
+		return StockTransfer{}, fmt.Errorf("error iterating stock transfer lines: %w", err)
+	}
+
+	return t, nil
+}
+
+// ListStockTransfers retrieves a page of stock transfers without their lines
+func ListStockTransfers(db *sql.DB, tables Tables, params StockTransferListParams) (Page[StockTransfer], error) {
+	dir, op := sortDirection(params.Desc)
+	sortKey := "id:" + dir
+
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if params.Status != "" {
+		conds = append(conds, "status = "+arg(params.Status))
+	}
+	if params.OutletID != 0 {
+		outlet := arg(params.OutletID)
+		conds = append(conds, fmt.Sprintf("(from_outlet_id = %[1]s OR to_outlet_id = %[1]s)", outlet))
+	}
+
+	page := Page[StockTransfer]{Data: []StockTransfer{}}
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", tables.StockTransfer, whereClause(conds))
+	if err := db.QueryRow(countQuery, args...).Scan(&page.Total); err != nil {
+		return Page[StockTransfer]{}, fmt.Errorf("failed to count stock transfers: %w", err)
+	}
+
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor, sortKey)
+		if err != nil {
+			return Page[StockTransfer]{}, err
+		}
+		conds = append(conds, fmt.Sprintf("id %s %s", op, arg(c.ID)))
+	}
+
+	limit := normalizeLimit(params.Limit)
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY id %s LIMIT %s", transferColumns, tables.StockTransfer, whereClause(conds), dir, arg(limit+1))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Page[StockTransfer]{}, fmt.Errorf("failed to query stock transfers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t StockTransfer
+		if err := rows.Scan(t.scanFields()...); err != nil {
+			return Page[StockTransfer]{}, fmt.Errorf("failed to scan stock transfer: %w", err)
+		}
+		page.Data = append(page.Data, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return Page[StockTransfer]{}, fmt.Errorf("error iterating stock transfers: %w", err)
+	}
+
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		last := page.Data[limit-1]
+		page.NextCursor = encodeCursor(sortKey, strconv.Itoa(last.ID), last.ID)
+	}
+
+	return page, nil
+}
+
+// validTransfer reports whether t moves stock between two different outlets
+// and has lines that list each product or variant once with positive quantities
+func validTransfer(t StockTransfer) bool {
+	if t.FromOutletID <= 0 || t.ToOutletID <= 0 || t.FromOutletID == t.ToOutletID || len(t.Lines) == 0 {
+		return false
+	}
+	seen := make(map[transferLineKey]bool, len(t.Lines))
+	for _, line := range t.Lines {
+		key := transferLineKey{line.ProductID, line.VariantID}
+		if line.ProductID <= 0 || line.VariantID < 0 || line.Quantity <= 0 || seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+	return true
+}
+
+// CreateStockTransfer creates a draft stock transfer with its lines and
+// returns it. Deleted products cannot be transferred and return
+// ErrProductNotFound; variants must belong to their line's product.
+func CreateStockTransfer(db *sql.DB, tables Tables, t StockTransfer) (StockTransfer, error) {
+	if !validTransfer(t) {
+		return StockTransfer{}, ErrInvalidTransfer
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (from_outlet_id, to_outlet_id, status, note) VALUES ($1, $2, $3, $4) RETURNING id", tables.StockTransfer)
+	if err := tx.QueryRow(query, t.FromOutletID, t.ToOutletID, TransferDraft, t.Note).Scan(&id); err != nil {
+		if isForeignKeyViolation(err) {
+			return StockTransfer{}, ErrOutletNotFound
+		}
+		return StockTransfer{}, fmt.Errorf("failed to create stock transfer: %w", translateError(err))
+	}
+
+	var productIDs []int64
+	seen := make(map[int]bool, len(t.Lines))
+	for _, line := range t.Lines {
+		if !seen[line.ProductID] {
+			seen[line.ProductID] = true
+			productIDs = append(productIDs, int64(line.ProductID))
+		}
+	}
+	var active int
+	activeQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = ANY($1) AND deleted_at IS NULL", tables.Product)
+	if err := tx.QueryRow(activeQuery, pq.Array(productIDs)).Scan(&active); err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to query products: %w", translateError(err))
+	}
+	if active != len(productIDs) {
+		return StockTransfer{}, ErrProductNotFound
+	}
+
+	variantQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL)", tables.ProductVariant)
+	insertQuery := fmt.Sprintf("INSERT INTO %s (stock_transfer_id, product_id, variant_id, quantity) VALUES ($1, $2, $3, $4)", tables.TransferLine)
+	for _, line := range t.Lines {
+		if line.VariantID != 0 {
+			var exists bool
+			if err := tx.QueryRow(variantQuery, line.VariantID, line.ProductID).Scan(&exists); err != nil {
+				return StockTransfer{}, fmt.Errorf("failed to query variant: %w", translateError(err))
+			}
+			if !exists {
+				return StockTransfer{}, ErrVariantNotFound
+			}
+		}
+		if _, err := tx.Exec(insertQuery, id, line.ProductID, line.VariantID, line.Quantity); err != nil {
+			return StockTransfer{}, fmt.Errorf("failed to create stock transfer line: %w", translateError(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetStockTransfer(db, tables, id)
+}
+
+// lockTransfer locks stock transfer id for the rest of tx and returns it with
+// its lines ordered by product and variant, the order their stock is locked
+// in. It returns ErrTransferStatus unless the transfer has status.
+func lockTransfer(tx *sql.Tx, tables Tables, id int, status string) (StockTransfer, error) {
+	var t StockTransfer
+	lockQuery := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1 FOR UPDATE", transferColumns, tables.StockTransfer)
+	if err := tx.QueryRow(lockQuery, id).Scan(t.scanFields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return StockTransfer{}, ErrTransferNotFound
+		}
+		return StockTransfer{}, fmt.Errorf("failed to query stock transfer: %w", translateError(err))
+	}
+	if t.Status != status {
+		return StockTransfer{}, ErrTransferStatus
+	}
+
+	linesQuery := fmt.Sprintf("SELECT id, product_id, variant_id, quantity FROM %s WHERE stock_transfer_id = $1 ORDER BY product_id, variant_id", tables.TransferLine)
+	rows, err := tx.Query(linesQuery, id)
+	if err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to query stock transfer lines: %w", translateError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line StockTransferLine
+		if err := rows.Scan(&line.ID, &line.ProductID, &line.VariantID, &line.Quantity); err != nil {
+			return StockTransfer{}, fmt.Errorf("failed to scan stock transfer line: %w", err)
+		}
+		t.Lines = append(t.Lines, line)
+	}
+
+	if err = rows.Err(); err != nil {
+		return StockTransfer{}, fmt.Errorf("error iterating stock transfer lines: %w", translateError(err))
+	}
+	return t, nil
+}
+
+// ShipStockTransfer ships a draft stock transfer. Every line is taken out of
+// the source outlet's stock and recorded as a transfer_out movement in one
+// database transaction, holding the row locks like Checkout. The lots each
+// line is taken from are recorded so that they can be received. Shipping
+// more than the source outlet holds returns a *StockError and ships nothing.
+func ShipStockTransfer(db *sql.DB, tables Tables, id int) (StockTransfer, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	t, err := lockTransfer(tx, tables, id, TransferDraft)
+	if err != nil {
+		return StockTransfer{}, err
+	}
+
+	insertLotQuery := fmt.Sprintf("INSERT INTO %s (stock_transfer_line_id, lot_id, quantity) VALUES ($1, $2, $3)", tables.TransferLot)
+	for _, line := range t.Lines {
+		balance, usages, err := changeStockLots(tx, tables, t.FromOutletID, line.ProductID, line.VariantID, -line.Quantity)
+		if err != nil {
+			return StockTransfer{}, err
+		}
+		err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: line.ProductID, VariantID: line.VariantID, OutletID: t.FromOutletID, Delta: -line.Quantity, Balance: balance, Reason: MovementTransferOut, ReferenceID: id})
+		if err != nil {
+			return StockTransfer{}, err
+		}
+		for _, u := range usages {
+			if _, err := tx.Exec(insertLotQuery, line.ID, u.LotID, u.Quantity); err != nil {
+				return StockTransfer{}, fmt.Errorf("failed to record stock transfer lot: %w", translateError(err))
+			}
+		}
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE %s SET status = $1, shipped_at = NOW() WHERE id = $2", tables.StockTransfer)
+	if _, err := tx.Exec(updateQuery, TransferInTransit, id); err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to update stock transfer: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetStockTransfer(db, tables, id)
+}
+
+// ReceiveStockTransfer receives a stock transfer in transit at its
+// destination outlet. Lines listed in received arrive with the given
+// quantity, which may differ from the shipped one; the other lines arrive in
+// full. The arrived quantities are added to the destination's stock and
+// recorded as transfer_in movements in one database transaction, and the
+// shipped lots are recreated at the destination. Listing a product that is
+// not on the transfer returns ErrInvalidTransferReceipt.
+func ReceiveStockTransfer(db *sql.DB, tables Tables, id int, received []TransferReceiptLine) (StockTransfer, error) {
+	quantities := make(map[transferLineKey]int, len(received))
+	for _, line := range received {
+		key := transferLineKey{line.ProductID, line.VariantID}
+		if _, ok := quantities[key]; ok || line.Quantity < 0 {
+			return StockTransfer{}, ErrInvalidTransferReceipt
+		}
+		quantities[key] = line.Quantity
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	t, err := lockTransfer(tx, tables, id, TransferInTransit)
+	if err != nil {
+		return StockTransfer{}, err
+	}
+
+	updateLineQuery := fmt.Sprintf("UPDATE %s SET received_quantity = $1 WHERE id = $2", tables.TransferLine)
+	for _, line := range t.Lines {
+		key := transferLineKey{line.ProductID, line.VariantID}
+		quantity, ok := quantities[key]
+		if !ok {
+			quantity = line.Quantity
+		}
+		delete(quantities, key)
+
+		balance, err := changeStock(tx, tables, t.ToOutletID, line.ProductID, line.VariantID, quantity)
+		if err != nil {
+			return StockTransfer{}, err
+		}
+		if err := receiveTransferLots(tx, tables, t.ToOutletID, line, quantity); err != nil {
+			return StockTransfer{}, err
+		}
+		err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: line.ProductID, VariantID: line.VariantID, OutletID: t.ToOutletID, Delta: quantity, Balance: balance, Reason: MovementTransferIn, ReferenceID: id})
+		if err != nil {
+			return StockTransfer{}, err
+		}
+		if _, err := tx.Exec(updateLineQuery, quantity, line.ID); err != nil {
+			return StockTransfer{}, fmt.Errorf("failed to update stock transfer line: %w", translateError(err))
+		}
+	}
+	if len(quantities) != 0 {
+		return StockTransfer{}, ErrInvalidTransferReceipt
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE %s SET status = $1, received_at = NOW() WHERE id = $2", tables.StockTransfer)
+	if _, err := tx.Exec(updateQuery, TransferReceived, id); err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to update stock transfer: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetStockTransfer(db, tables, id)
+}
+
+// receiveTransferLots recreates at the destination outlet the lots a transfer
+// line was shipped from. The arrived quantity fills the shipped lots
+// earliest expiry first, so a shortfall is taken from the latest expiring
+// lots and a surplus arrives outside lots. A lot number the destination
+// already holds with another expiry date returns ErrInvalidLot.
+func receiveTransferLots(tx *sql.Tx, tables Tables, outletID int, line StockTransferLine, quantity int) error {
+	query := fmt.Sprintf("SELECT l.lot_number, to_char(l.expiry_date, 'YYYY-MM-DD'), tl.quantity FROM %s tl JOIN %s l ON tl.lot_id = l.id WHERE tl.stock_transfer_line_id = $1 ORDER BY l.expiry_date, l.id", tables.TransferLot, tables.Lot)
+	rows, err := tx.Query(query, line.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query stock transfer lots: %w", translateError(err))
+	}
+
+	var lots []Lot
+	for rows.Next() && quantity > 0 {
+		lot := Lot{OutletID: outletID, ProductID: line.ProductID, VariantID: line.VariantID}
+		if err := rows.Scan(&lot.LotNumber, &lot.ExpiryDate, &lot.Quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stock transfer lot: %w", err)
+		}
+		if lot.Quantity > quantity {
+			lot.Quantity = quantity
+		}
+		quantity -= lot.Quantity
+		lots = append(lots, lot)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating stock transfer lots: %w", translateError(err))
+	}
+
+	for _, lot := range lots {
+		if _, err := addLot(tx, tables.Lot, lot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelStockTransfer cancels a draft stock transfer. Transfers that have
+// shipped return ErrTransferStatus.
+func CancelStockTransfer(db *sql.DB, tables Tables, id int) (StockTransfer, error) {
+	query := fmt.Sprintf("UPDATE %s SET status = $1 WHERE id = $2 AND status = $3", tables.StockTransfer)
+	result, err := db.Exec(query, TransferCancelled, id, TransferDraft)
+	if err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to update stock transfer: %w", translateError(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return StockTransfer{}, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	t, err := GetStockTransfer(db, tables, id)
+	if err != nil {
+		return StockTransfer{}, err
+	}
+	if rowsAffected == 0 {
+		return StockTransfer{}, ErrTransferStatus
+	}
+	return t, nil
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStockTransfer(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	warehouse, err := CreateOutlet(db, "outlet_test", Outlet{Name: "Gudang Belakang"})
+	if err != nil {
+		t.Fatalf("CreateOutlet failed: %v", err)
+	}
+	tea, err := CreateProduct(db, TestTables, Product{Name: "Teh Botol", Price: 5000, Stock: 20})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	sugar, err := CreateProduct(db, TestTables, Product{Name: "Gula 1kg", Price: 16000, Stock: 5})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	_, err = CreateStockTransfer(db, TestTables, StockTransfer{FromOutletID: DefaultOutletID, ToOutletID: DefaultOutletID, Lines: []StockTransferLine{{ProductID: tea.ID, Quantity: 1}}})
+	if err != ErrInvalidTransfer {
+		t.Errorf("Expected ErrInvalidTransfer for a transfer to the same outlet, got %v", err)
+	}
+	_, err = CreateStockTransfer(db, TestTables, StockTransfer{FromOutletID: DefaultOutletID, ToOutletID: 9999, Lines: []StockTransferLine{{ProductID: tea.ID, Quantity: 1}}})
+	if err != ErrOutletNotFound {
+		t.Errorf("Expected ErrOutletNotFound, got %v", err)
+	}
+
+	transfer, err := CreateStockTransfer(db, TestTables, StockTransfer{
+		FromOutletID: DefaultOutletID,
+		ToOutletID:   warehouse.ID,
+		Note:         "Move to the back",
+		Lines: []StockTransferLine{
+			{ProductID: tea.ID, Quantity: 12},
+			{ProductID: sugar.ID, Quantity: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateStockTransfer failed: %v", err)
+	}
+	if transfer.Status != TransferDraft || len(transfer.Lines) != 2 || transfer.Lines[0].ReceivedQuantity != nil {
+		t.Errorf("Unexpected stock transfer: %+v", transfer)
+	}
+
+	if _, err := ReceiveStockTransfer(db, TestTables, transfer.ID, nil); err != ErrTransferStatus {
+		t.Errorf("Expected ErrTransferStatus receiving a draft, got %v", err)
+	}
+
+	transfer, err = ShipStockTransfer(db, TestTables, transfer.ID)
+	if err != nil {
+		t.Fatalf("ShipStockTransfer failed: %v", err)
+	}
+	if transfer.Status != TransferInTransit || transfer.ShippedAt == nil {
+		t.Errorf("Expected transfer in transit, got %+v", transfer)
+	}
+	if _, err := CancelStockTransfer(db, TestTables, transfer.ID); err != ErrTransferStatus {
+		t.Errorf("Expected ErrTransferStatus cancelling a shipped transfer, got %v", err)
+	}
+
+	updated, err := GetProductByID(db, TestTables, tea.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 8 {
+		t.Errorf("Expected 8 in stock while 12 are in transit, got %d", updated.Stock)
+	}
+
+	_, err = ReceiveStockTransfer(db, TestTables, transfer.ID, []TransferReceiptLine{{ProductID: 9999, Quantity: 1}})
+	if err != ErrInvalidTransferReceipt {
+		t.Errorf("Expected ErrInvalidTransferReceipt for a product not on the transfer, got %v", err)
+	}
+
+	transfer, err = ReceiveStockTransfer(db, TestTables, transfer.ID, []TransferReceiptLine{{ProductID: tea.ID, Quantity: 11}})
+	if err != nil {
+		t.Fatalf("ReceiveStockTransfer failed: %v", err)
+	}
+	if transfer.Status != TransferReceived || *transfer.Lines[0].Variance != -1 || *transfer.Lines[1].ReceivedQuantity != 5 {
+		t.Errorf("Unexpected received transfer: %+v", transfer)
+	}
+
+	page, err := ListProducts(db, TestTables, ProductListParams{OutletID: warehouse.ID, Sort: "name"})
+	if err != nil {
+		t.Fatalf("ListProducts failed: %v", err)
+	}
+	if page.Data[0].Stock != 5 || page.Data[1].Stock != 11 {
+		t.Errorf("Expected 5 sugar and 11 tea at the warehouse, got %+v", page.Data)
+	}
+
+	history, err := GetStockHistory(db, "inventory_movement_test", "product_test", tea.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if m := history.Data[0]; m.Reason != MovementTransferIn || m.OutletID != warehouse.ID || m.Delta != 11 || m.Balance != 19 {
+		t.Errorf("Unexpected transfer movement: %+v", m)
+	}
+
+	back, err := CreateStockTransfer(db, TestTables, StockTransfer{FromOutletID: warehouse.ID, ToOutletID: DefaultOutletID, Lines: []StockTransferLine{{ProductID: sugar.ID, Quantity: 6}}})
+	if err != nil {
+		t.Fatalf("CreateStockTransfer failed: %v", err)
+	}
+	_, err = ShipStockTransfer(db, TestTables, back.ID)
+	var stockErr *StockError
+	if !errors.As(err, &stockErr) || stockErr.OutletID != warehouse.ID || stockErr.Available != 5 {
+		t.Errorf("Expected StockError with 5 available at outlet %d, got %v", warehouse.ID, err)
+	}
+
+	list, err := ListStockTransfers(db, TestTables, StockTransferListParams{Status: TransferDraft, OutletID: warehouse.ID})
+	if err != nil {
+		t.Fatalf("ListStockTransfers failed: %v", err)
+	}
+	if list.Total != 1 || list.Data[0].ID != back.ID {
+		t.Errorf("Expected only the unshipped transfer, got %+v", list)
+	}
+}
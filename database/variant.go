@@ -0,0 +1,211 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrVariantNotFound = errors.New("variant not found")
+
+// ProductVariant is a sellable variation of a product, such as a size or flavour.
+// Each variant has its own price and stock, and optionally its own barcode.
+type ProductVariant struct {
+	ID         int               `json:"id" db:"id"`
+	ProductID  int               `json:"product_id" db:"product_id"`
+	Name       string            `json:"name" db:"name"`
+	Attributes map[string]string `json:"attributes" db:"attributes"`
+	Price      int               `json:"price" db:"price"`
+	Stock      int               `json:"stock" db:"stock"`
+	Barcode    string            `json:"barcode" db:"barcode"`
+	// DeletedAt is set when the variant has been soft-deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+const variantColumns = "id, product_id, name, attributes, price, stock, COALESCE(barcode, ''), deleted_at"
+
+// scanVariant scans a row selected with variantColumns
+func scanVariant(row interface{ Scan(...interface{}) error }) (ProductVariant, error) {
+	var v ProductVariant
+	var attrs []byte
+	if err := row.Scan(&v.ID, &v.ProductID, &v.Name, &attrs, &v.Price, &v.Stock, &v.Barcode, &v.DeletedAt); err != nil {
+		return ProductVariant{}, err
+	}
+	if err := json.Unmarshal(attrs, &v.Attributes); err != nil {
+		return ProductVariant{}, fmt.Errorf("failed to decode variant attributes: %w", err)
+	}
+	if v.Attributes == nil {
+		v.Attributes = map[string]string{}
+	}
+	return v, nil
+}
+
+// encodeAttributes marshals variant attributes for the JSONB column
+func encodeAttributes(attrs map[string]string) ([]byte, error) {
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	return json.Marshal(attrs)
+}
+
+// GetVariantsByProductID retrieves the variants of a product that are not
+// deleted, ordered by ID
+func GetVariantsByProductID(db *sql.DB, tables Tables, productID int) ([]ProductVariant, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE product_id = $1 AND deleted_at IS NULL ORDER BY id", variantColumns, tables.ProductVariant)
+	rows, err := db.Query(query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query variants: %w", err)
+	}
+	defer rows.Close()
+
+	variants := []ProductVariant{}
+	for rows.Next() {
+		v, err := scanVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan variant: %w", err)
+		}
+		variants = append(variants, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating variants: %w", err)
+	}
+
+	return variants, nil
+}
+
+// GetVariantByBarcode retrieves the variant with the given barcode. Deleted
+// variants are not found.
+func GetVariantByBarcode(db *sql.DB, tables Tables, barcode string) (ProductVariant, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE barcode = $1 AND deleted_at IS NULL", variantColumns, tables.ProductVariant)
+	v, err := scanVariant(db.QueryRow(query, barcode))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ProductVariant{}, ErrVariantNotFound
+		}
+		return ProductVariant{}, fmt.Errorf("failed to query variant: %w", err)
+	}
+	return v, nil
+}
+
+// CreateVariant inserts a new variant for v.ProductID and returns it. A
+// barcode already used by a product or variant returns
+// ErrDuplicateProductCode. Its opening stock is placed at the default outlet
+// and recorded in the stock history.
+func CreateVariant(db *sql.DB, tables Tables, v ProductVariant) (ProductVariant, error) {
+	attrs, err := encodeAttributes(v.Attributes)
+	if err != nil {
+		return ProductVariant{}, fmt.Errorf("failed to encode variant attributes: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ProductVariant{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("INSERT INTO %s (product_id, name, attributes, price, stock, barcode) VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) RETURNING %s", tables.ProductVariant, variantColumns)
+	created, err := scanVariant(tx.QueryRow(query, v.ProductID, v.Name, attrs, v.Price, v.Stock, v.Barcode))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ProductVariant{}, ErrDuplicateProductCode
+		}
+		if isForeignKeyViolation(err) {
+			return ProductVariant{}, ErrProductNotFound
+		}
+		return ProductVariant{}, fmt.Errorf("failed to create variant: %w", translateError(err))
+	}
+
+	if _, err := changeOutletStock(tx, tables.OutletStock, DefaultOutletID, created.ProductID, created.ID, created.Stock); err != nil {
+		return ProductVariant{}, err
+	}
+
+	err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: created.ProductID, VariantID: created.ID, Delta: created.Stock, Balance: created.Stock, Reason: MovementManualEdit})
+	if err != nil {
+		return ProductVariant{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ProductVariant{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return created, nil
+}
+
+// UpdateVariant replaces the fields of variant v.ID belonging to v.ProductID.
+// A barcode already used by another product or variant returns
+// ErrDuplicateProductCode. A change of stock is applied to the default outlet
+// and recorded in the stock history; lowering the stock below what the other
+// outlets hold returns a *StockError. A decrease is taken from the default
+// outlet's lots first-expired-first-out.
+func UpdateVariant(db *sql.DB, tables Tables, v ProductVariant) (ProductVariant, error) {
+	attrs, err := encodeAttributes(v.Attributes)
+	if err != nil {
+		return ProductVariant{}, fmt.Errorf("failed to encode variant attributes: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ProductVariant{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldStock int
+	lockQuery := fmt.Sprintf("SELECT stock FROM %s WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL FOR UPDATE", tables.ProductVariant)
+	if err := tx.QueryRow(lockQuery, v.ID, v.ProductID).Scan(&oldStock); err != nil {
+		if err == sql.ErrNoRows {
+			return ProductVariant{}, ErrVariantNotFound
+		}
+		return ProductVariant{}, fmt.Errorf("failed to query variant: %w", translateError(err))
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET name = $1, attributes = $2, price = $3, stock = $4, barcode = NULLIF($5, '') WHERE id = $6 AND product_id = $7 RETURNING %s", tables.ProductVariant, variantColumns)
+	updated, err := scanVariant(tx.QueryRow(query, v.Name, attrs, v.Price, v.Stock, v.Barcode, v.ID, v.ProductID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ProductVariant{}, ErrVariantNotFound
+		}
+		if isUniqueViolation(err) {
+			return ProductVariant{}, ErrDuplicateProductCode
+		}
+		return ProductVariant{}, fmt.Errorf("failed to update variant: %w", translateError(err))
+	}
+
+	if _, err := changeOutletStock(tx, tables.OutletStock, DefaultOutletID, updated.ProductID, updated.ID, updated.Stock-oldStock); err != nil {
+		return ProductVariant{}, err
+	}
+	if updated.Stock < oldStock {
+		if _, err := takeLots(tx, tables.Lot, DefaultOutletID, updated.ProductID, updated.ID, oldStock-updated.Stock); err != nil {
+			return ProductVariant{}, err
+		}
+	}
+
+	err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: updated.ProductID, VariantID: updated.ID, Delta: updated.Stock - oldStock, Balance: updated.Stock, Reason: MovementManualEdit})
+	if err != nil {
+		return ProductVariant{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ProductVariant{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return updated, nil
+}
+
+// DeleteVariant soft-deletes a variant of a product. It can no longer be
+// sold, but the sales that refer to it stay valid. Its barcode stays reserved.
+func DeleteVariant(db *sql.DB, tables Tables, productID, variantID int) error {
+	query := fmt.Sprintf("UPDATE %s SET deleted_at = NOW() WHERE id = $1 AND product_id = $2 AND deleted_at IS NULL", tables.ProductVariant)
+	result, err := db.Exec(query, variantID, productID)
+	if err != nil {
+		return fmt.Errorf("failed to delete variant: %w", translateError(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrVariantNotFound
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVariantCRUD(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kaos Polos", Price: 50000})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	small, err := CreateVariant(db, TestTables, ProductVariant{
+		ProductID:  prod.ID,
+		Name:       "S",
+		Attributes: map[string]string{"size": "S", "color": "white"},
+		Price:      50000,
+		Stock:      10,
+	})
+	if err != nil {
+		t.Fatalf("CreateVariant failed: %v", err)
+	}
+	if small.ID == 0 || small.Attributes["size"] != "S" {
+		t.Errorf("Unexpected variant: %+v", small)
+	}
+
+	xl, err := CreateVariant(db, TestTables, ProductVariant{
+		ProductID: prod.ID,
+		Name:      "XL",
+		Price:     55000,
+		Stock:     4,
+		Barcode:   "4006381333931",
+	})
+	if err != nil {
+		t.Fatalf("CreateVariant failed: %v", err)
+	}
+
+	variants, err := GetVariantsByProductID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetVariantsByProductID failed: %v", err)
+	}
+	if len(variants) != 2 {
+		t.Fatalf("Expected 2 variants, got %d", len(variants))
+	}
+	if variants[1].Attributes == nil {
+		t.Error("Expected empty attributes map, got nil")
+	}
+
+	xl.Price = 60000
+	updated, err := UpdateVariant(db, TestTables, xl)
+	if err != nil {
+		t.Fatalf("UpdateVariant failed: %v", err)
+	}
+	if updated.Price != 60000 {
+		t.Errorf("Expected price 60000, got %d", updated.Price)
+	}
+
+	_, err = CreateVariant(db, TestTables, ProductVariant{ProductID: 9999, Name: "M", Price: 1})
+	if err != ErrProductNotFound {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+
+	_, err = CreateVariant(db, TestTables, ProductVariant{ProductID: prod.ID, Name: "XXL", Price: 1, Barcode: "4006381333931"})
+	if err != ErrDuplicateProductCode {
+		t.Errorf("Expected ErrDuplicateProductCode, got %v", err)
+	}
+	_, err = CreateProduct(db, TestTables, Product{Name: "Kaos Lain", Price: 1, Barcode: "4006381333931"})
+	if err != ErrDuplicateProductCode {
+		t.Errorf("Expected ErrDuplicateProductCode for variant barcode, got %v", err)
+	}
+
+	found, err := GetVariantByBarcode(db, TestTables, "4006381333931")
+	if err != nil {
+		t.Fatalf("GetVariantByBarcode failed: %v", err)
+	}
+	if found.ID != xl.ID {
+		t.Errorf("Expected variant %d, got %d", xl.ID, found.ID)
+	}
+
+	if err := DeleteVariant(db, TestTables, prod.ID, small.ID); err != nil {
+		t.Fatalf("DeleteVariant failed: %v", err)
+	}
+	if err := DeleteVariant(db, TestTables, prod.ID, small.ID); err != ErrVariantNotFound {
+		t.Errorf("Expected ErrVariantNotFound, got %v", err)
+	}
+	if _, err := UpdateVariant(db, TestTables, small); err != ErrVariantNotFound {
+		t.Errorf("Expected ErrVariantNotFound updating a deleted variant, got %v", err)
+	}
+	variants, err = GetVariantsByProductID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetVariantsByProductID failed: %v", err)
+	}
+	if len(variants) != 1 || variants[0].ID != xl.ID {
+		t.Errorf("Expected only variant %d after delete, got %+v", xl.ID, variants)
+	}
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{VariantID: small.ID, Quantity: 1}}, nil); err != ErrVariantNotFound {
+		t.Errorf("Expected ErrVariantNotFound selling a deleted variant, got %v", err)
+	}
+}
+
+func TestCheckoutVariant(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Es Kopi Susu", Price: 18000})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	regular, err := CreateVariant(db, TestTables, ProductVariant{ProductID: prod.ID, Name: "Regular", Price: 18000, Stock: 5})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+	large, err := CreateVariant(db, TestTables, ProductVariant{ProductID: prod.ID, Name: "Large", Price: 24000, Stock: 1, Barcode: "96385074"})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{
+		{VariantID: regular.ID, Quantity: 2},
+		{Barcode: "96385074", Quantity: 1},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if trx.TotalAmount != 2*18000+24000 {
+		t.Errorf("Expected total %d, got %d", 2*18000+24000, trx.TotalAmount)
+	}
+	if trx.Details[0].VariantID != regular.ID || trx.Details[0].VariantName != "Regular" {
+		t.Errorf("Expected first detail to record variant Regular, got %+v", trx.Details[0])
+	}
+	if trx.Details[1].VariantID != large.ID || trx.Details[1].ProductID != prod.ID {
+		t.Errorf("Expected second detail to record variant Large, got %+v", trx.Details[1])
+	}
+
+	variants, err := GetVariantsByProductID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetVariantsByProductID failed: %v", err)
+	}
+	if variants[0].Stock != 3 || variants[1].Stock != 0 {
+		t.Errorf("Expected variant stocks 3 and 0, got %d and %d", variants[0].Stock, variants[1].Stock)
+	}
+
+	var storedVariantID int
+	err = db.QueryRow("SELECT variant_id FROM transaction_detail_test WHERE id = $1", trx.Details[0].ID).Scan(&storedVariantID)
+	if err != nil {
+		t.Fatalf("Failed to read transaction detail: %v", err)
+	}
+	if storedVariantID != regular.ID {
+		t.Errorf("Expected stored variant_id %d, got %d", regular.ID, storedVariantID)
+	}
+
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{VariantID: large.ID, Quantity: 1}}, nil)
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Expected ErrInsufficientStock, got %v", err)
+	}
+
+	_, err = Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: prod.ID + 1, VariantID: regular.ID, Quantity: 1}}, nil)
+	if err != ErrVariantNotFound {
+		t.Errorf("Expected ErrVariantNotFound for mismatched product, got %v", err)
+	}
+}
+
+func TestReturnDeletedVariant(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	prod, err := CreateProduct(db, TestTables, Product{Name: "Kaos Polos", Price: 50000})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	medium, err := CreateVariant(db, TestTables, ProductVariant{ProductID: prod.ID, Name: "M", Price: 50000, Stock: 4})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{VariantID: medium.ID, Quantity: 3}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if err := DeleteVariant(db, TestTables, prod.ID, medium.ID); err != nil {
+		t.Fatalf("DeleteVariant failed: %v", err)
+	}
+
+	variants, err := GetVariantsByProductID(db, TestTables, prod.ID)
+	if err != nil {
+		t.Fatalf("GetVariantsByProductID failed: %v", err)
+	}
+	if len(variants) != 0 {
+		t.Errorf("Expected deleted variant to be left out, got %+v", variants)
+	}
+	if _, err := Checkout(db, TestTables, 0, []CheckoutItem{{VariantID: medium.ID, Quantity: 1}}, nil); err != ErrVariantNotFound {
+		t.Errorf("Expected ErrVariantNotFound, got %v", err)
+	}
+
+	ret, err := CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: trx.Details[0].ID, Quantity: 2}}, "Ukuran tidak cocok")
+	if err != nil {
+		t.Fatalf("CreateReturn failed: %v", err)
+	}
+	if ret.RefundAmount != 100000 || ret.Lines[0].VariantID != medium.ID {
+		t.Errorf("Unexpected return: %+v", ret)
+	}
+
+	var stock int
+	if err := db.QueryRow("SELECT stock FROM product_variant_test WHERE id = $1", medium.ID).Scan(&stock); err != nil {
+		t.Fatalf("Failed to read variant stock: %v", err)
+	}
+	if stock != 3 {
+		t.Errorf("Expected variant stock 3, got %d", stock)
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrTransactionVoided   = errors.New("transaction is voided")
+	ErrVoidWindowExpired   = errors.New("void window has expired")
+	ErrTransactionReturned = errors.New("transaction has returns")
+	ErrInvalidVoid         = errors.New("invalid void")
+)
+
+// VoidTransaction voids a transaction made less than window ago or during
+// the open shift of its outlet, recording who voided it and why. Every
+// detail's quantity goes back into the stock of the transaction's outlet and
+// into the lots it was taken from, recorded as void movements referencing the
+// transaction. Voided transactions are left out of reports. A voided
+// transaction returns ErrTransactionVoided, an older one outside the open
+// shift ErrVoidWindowExpired, and one with returns ErrTransactionReturned,
+// since part of its stock is already back.
+func VoidTransaction(db *sql.DB, tables Tables, id int, window time.Duration, voidedBy, reason string) (Transaction, error) {
+	if voidedBy == "" || reason == "" {
+		return Transaction{}, ErrInvalidVoid
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the transaction serializes voids with returns and payments
+	var outletID int
+	var createdAt time.Time
+	var voided, expired bool
+	lockQuery := fmt.Sprintf("SELECT outlet_id, created_at, voided_at IS NOT NULL, created_at < NOW() - make_interval(secs => $2) FROM %s WHERE id = $1 FOR UPDATE", tables.Transaction)
+	if err := tx.QueryRow(lockQuery, id, window.Seconds()).Scan(&outletID, &createdAt, &voided, &expired); err != nil {
+		if err == sql.ErrNoRows {
+			return Transaction{}, ErrTransactionNotFound
+		}
+		return Transaction{}, fmt.Errorf("failed to query transaction: %w", translateError(err))
+	}
+	if voided {
+		return Transaction{}, ErrTransactionVoided
+	}
+	if expired {
+		inShift, err := inOpenShift(tx, tables.Shift, outletID, createdAt)
+		if err != nil {
+			return Transaction{}, err
+		}
+		if !inShift {
+			return Transaction{}, ErrVoidWindowExpired
+		}
+	}
+
+	var returned bool
+	returnQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE transaction_id = $1)", tables.Return)
+	if err := tx.QueryRow(returnQuery, id).Scan(&returned); err != nil {
+		return Transaction{}, fmt.Errorf("failed to query returns: %w", translateError(err))
+	}
+	if returned {
+		return Transaction{}, ErrTransactionReturned
+	}
+
+	detailQuery := fmt.Sprintf("SELECT product_id, COALESCE(variant_id, 0), quantity FROM %s WHERE transaction_id = $1 ORDER BY id", tables.TransactionDetail)
+	rows, err := tx.Query(detailQuery, id)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to query transaction details: %w", translateError(err))
+	}
+	var details []TransactionDetail
+	for rows.Next() {
+		var d TransactionDetail
+		if err := rows.Scan(&d.ProductID, &d.VariantID, &d.Quantity); err != nil {
+			rows.Close()
+			return Transaction{}, fmt.Errorf("failed to scan transaction detail: %w", err)
+		}
+		details = append(details, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return Transaction{}, fmt.Errorf("error iterating transaction details: %w", translateError(err))
+	}
+
+	for _, d := range details {
+		balance, err := changeStock(tx, tables, outletID, d.ProductID, d.VariantID, d.Quantity)
+		if err != nil {
+			return Transaction{}, err
+		}
+		err = recordMovement(tx, tables.InventoryMovement, InventoryMovement{ProductID: d.ProductID, VariantID: d.VariantID, OutletID: outletID, Delta: d.Quantity, Balance: balance, Reason: MovementVoid, ReferenceID: id})
+		if err != nil {
+			return Transaction{}, err
+		}
+	}
+
+	// The stock changes above hold the locks of the lots' products
+	lotQuery := fmt.Sprintf(`
+	UPDATE %[1]s l SET quantity = l.quantity + u.quantity
+	FROM (
+		SELECT dl.lot_id, SUM(dl.quantity) AS quantity
+		FROM %[2]s dl JOIN %[3]s d ON dl.transaction_detail_id = d.id
+		WHERE d.transaction_id = $1
+		GROUP BY dl.lot_id
+	) u
+	WHERE l.id = u.lot_id`, tables.Lot, tables.TransactionLot, tables.TransactionDetail)
+	if _, err := tx.Exec(lotQuery, id); err != nil {
+		return Transaction{}, fmt.Errorf("failed to restore lots: %w", translateError(err))
+	}
+
+	voidQuery := fmt.Sprintf("UPDATE %s SET voided_at = NOW(), voided_by = $1, void_reason = $2 WHERE id = $3", tables.Transaction)
+	if _, err := tx.Exec(voidQuery, voidedBy, reason, id); err != nil {
+		return Transaction{}, fmt.Errorf("failed to void transaction: %w", translateError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Transaction{}, fmt.Errorf("failed to commit transaction: %w", translateError(err))
+	}
+	return GetTransaction(db, tables, id)
+}
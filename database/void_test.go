@@ -0,0 +1,140 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVoidTransaction(t *testing.T) {
+	db := setupProductTestDB(t)
+	defer teardownProductTestDB(t, db)
+
+	milk, err := CreateProduct(db, TestTables, Product{Name: "Susu UHT", Price: 6000, Stock: 10})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	lot, err := CreateLot(db, TestTables, Lot{ProductID: milk.ID, LotNumber: "B-0115", ExpiryDate: "2099-01-15", Quantity: 4})
+	if err != nil {
+		t.Fatalf("CreateLot failed: %v", err)
+	}
+
+	trx, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: milk.ID, Quantity: 5}}, []CheckoutPayment{{Method: PaymentCash, Amount: 30000}})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	if _, err := VoidTransaction(db, TestTables, trx.ID, 15*time.Minute, "", "Salah input"); err != ErrInvalidVoid {
+		t.Errorf("Expected ErrInvalidVoid without voided_by, got %v", err)
+	}
+
+	voided, err := VoidTransaction(db, TestTables, trx.ID, 15*time.Minute, "Kasir 1", "Salah input")
+	if err != nil {
+		t.Fatalf("VoidTransaction failed: %v", err)
+	}
+	if voided.VoidedAt == nil || voided.VoidedBy != "Kasir 1" || voided.VoidReason != "Salah input" {
+		t.Errorf("Unexpected voided transaction: %+v", voided)
+	}
+
+	updated, err := GetProductByID(db, TestTables, milk.ID)
+	if err != nil {
+		t.Fatalf("GetProductByID failed: %v", err)
+	}
+	if updated.Stock != 10 {
+		t.Errorf("Expected stock 10, got %d", updated.Stock)
+	}
+	lots, err := GetLots(db, TestTables, milk.ID)
+	if err != nil {
+		t.Fatalf("GetLots failed: %v", err)
+	}
+	if len(lots) != 1 || lots[0].ID != lot.ID || lots[0].Quantity != 4 {
+		t.Errorf("Expected the lot to be restored, got %+v", lots)
+	}
+
+	history, err := GetStockHistory(db, "inventory_movement_test", "product_test", milk.ID, 0, "")
+	if err != nil {
+		t.Fatalf("GetStockHistory failed: %v", err)
+	}
+	if m := history.Data[0]; m.Reason != MovementVoid || m.Delta != 5 || m.Balance != 10 || m.ReferenceID != trx.ID {
+		t.Errorf("Unexpected void movement: %+v", m)
+	}
+
+	summary, err := GetReportToday(db, TestTables, time.Now().UTC(), 0)
+	if err != nil {
+		t.Fatalf("GetReportToday failed: %v", err)
+	}
+	if summary.TotalRevenue != 0 || summary.TotalTransaksi != 0 {
+		t.Errorf("Expected voided transaction to be left out of the report, got %+v", summary)
+	}
+
+	if _, err := VoidTransaction(db, TestTables, trx.ID, 15*time.Minute, "Kasir 1", "Salah input"); err != ErrTransactionVoided {
+		t.Errorf("Expected ErrTransactionVoided, got %v", err)
+	}
+	if _, err := CreateReturn(db, TestTables, trx.ID, []ReturnItem{{TransactionDetailID: trx.Details[0].ID, Quantity: 1}}, ""); err != ErrTransactionVoided {
+		t.Errorf("Expected ErrTransactionVoided for a return, got %v", err)
+	}
+	if _, err := VoidTransaction(db, TestTables, 999999, 15*time.Minute, "Kasir 1", "Salah input"); err != ErrTransactionNotFound {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+
+	// Transactions with returns cannot be voided
+	returned, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: milk.ID, Quantity: 2}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := CreateReturn(db, TestTables, returned.ID, []ReturnItem{{TransactionDetailID: returned.Details[0].ID, Quantity: 1}}, ""); err != nil {
+		t.Fatalf("CreateReturn failed: %v", err)
+	}
+	if _, err := VoidTransaction(db, TestTables, returned.ID, 15*time.Minute, "Kasir 1", "Salah input"); err != ErrTransactionReturned {
+		t.Errorf("Expected ErrTransactionReturned, got %v", err)
+	}
+
+	// Transactions older than the window cannot be voided
+	old, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: milk.ID, Quantity: 1}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET created_at = NOW() - interval '1 hour' WHERE id = $1", TestTables.Transaction), old.ID); err != nil {
+		t.Fatalf("Failed to backdate transaction: %v", err)
+	}
+	if _, err := VoidTransaction(db, TestTables, old.ID, 15*time.Minute, "Kasir 1", "Salah input"); err != ErrVoidWindowExpired {
+		t.Errorf("Expected ErrVoidWindowExpired, got %v", err)
+	}
+
+	// ...unless they were made during the outlet's open shift
+	shift, err := OpenShift(db, TestTables, 0, "Kasir 1")
+	if err != nil {
+		t.Fatalf("OpenShift failed: %v", err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET opened_at = NOW() - interval '2 hours' WHERE id = $1", TestTables.Shift), shift.ID); err != nil {
+		t.Fatalf("Failed to backdate shift: %v", err)
+	}
+	if _, err := VoidTransaction(db, TestTables, old.ID, 15*time.Minute, "Kasir 1", "Salah input"); err != nil {
+		t.Errorf("Expected a sale of the open shift to be voided, got %v", err)
+	}
+
+	beforeShift, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: milk.ID, Quantity: 1}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET created_at = NOW() - interval '3 hours' WHERE id = $1", TestTables.Transaction), beforeShift.ID); err != nil {
+		t.Fatalf("Failed to backdate transaction: %v", err)
+	}
+	if _, err := VoidTransaction(db, TestTables, beforeShift.ID, 15*time.Minute, "Kasir 1", "Salah input"); err != ErrVoidWindowExpired {
+		t.Errorf("Expected ErrVoidWindowExpired for a sale before the shift, got %v", err)
+	}
+
+	lastSale, err := Checkout(db, TestTables, 0, []CheckoutItem{{ProductID: milk.ID, Quantity: 1}}, nil)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET created_at = NOW() - interval '1 hour' WHERE id = $1", TestTables.Transaction), lastSale.ID); err != nil {
+		t.Fatalf("Failed to backdate transaction: %v", err)
+	}
+	if _, err := CloseShift(db, TestTables, shift.ID, "Supervisor"); err != nil {
+		t.Fatalf("CloseShift failed: %v", err)
+	}
+	if _, err := VoidTransaction(db, TestTables, lastSale.ID, 15*time.Minute, "Kasir 1", "Salah input"); err != ErrVoidWindowExpired {
+		t.Errorf("Expected ErrVoidWindowExpired once the shift is closed, got %v", err)
+	}
+}
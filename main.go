@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	_ "github.com/lib/pq"
 
@@ -49,37 +50,149 @@ func main() {
 	log.Println("Database migrations completed")
 
 	// Initialize categories service
-	categories := api.NewCategories(db, "category")
+	categories := api.NewCategories(db, "category", "product")
 
 	// Initialize products service
-	products := api.NewProducts(db, "product")
+	products := api.NewProducts(db, database.DefaultTables)
+
+	// Initialize product variants service
+	variants := api.NewVariants(db, database.DefaultTables)
 
 	// Initialize checkout service
-	checkout := api.NewCheckout(db, "product", "category", "\"transaction\"", "transaction_detail")
+	checkout := api.NewCheckout(db, database.DefaultTables)
+
+	// Initialize transactions service
+	transactions := api.NewTransactions(db, database.DefaultTables, time.Duration(cfg.VoidWindowMinutes)*time.Minute)
+
+	// Initialize inventory service
+	inventory := api.NewInventory(db, database.DefaultTables)
+
+	// Initialize outlets service
+	outlets := api.NewOutlets(db, "outlet")
+
+	// Initialize stock transfers service
+	transfers := api.NewTransfers(db, database.DefaultTables)
+
+	// Initialize stock takes service
+	stockTakes := api.NewStockTakes(db, database.DefaultTables)
+
+	// Initialize shifts service
+	shifts := api.NewShifts(db, database.DefaultTables)
+
+	// Initialize suppliers service
+	suppliers := api.NewSuppliers(db, "supplier")
+
+	// Initialize purchase orders service
+	purchaseOrders := api.NewPurchaseOrders(db, database.DefaultTables)
 
 	// Initialize report service
-	report := api.NewReport(db, "\"transaction\"", "transaction_detail")
+	report := api.NewReport(db, database.DefaultTables)
 
 	// Category routes
 	http.HandleFunc("GET /categories", categories.GetAll)
+	http.HandleFunc("GET /categories/tree", categories.Tree)
 	http.HandleFunc("GET /categories/{id}", categories.GetByID)
 	http.HandleFunc("POST /categories", categories.Create)
 	http.HandleFunc("PUT /categories/{id}", categories.Update)
+	http.HandleFunc("PATCH /categories/{id}", categories.Patch)
 	http.HandleFunc("DELETE /categories/{id}", categories.Delete)
+	http.HandleFunc("POST /categories/{id}/restore", categories.Restore)
 
 	// Product routes
 	http.HandleFunc("GET /products", products.GetAll)
+	http.HandleFunc("GET /products/search", products.Search)
 	http.HandleFunc("GET /products/{id}", products.GetByID)
 	http.HandleFunc("POST /products", products.Create)
 	http.HandleFunc("PUT /products/{id}", products.Update)
+	http.HandleFunc("PATCH /products/{id}", products.Patch)
 	http.HandleFunc("DELETE /products/{id}", products.Delete)
+	http.HandleFunc("POST /products/{id}/restore", products.Restore)
+	http.HandleFunc("POST /products/{id}/stock-adjustments", inventory.Adjust)
+	http.HandleFunc("POST /products/{id}/lots", inventory.CreateLot)
+	http.HandleFunc("GET /inventory/expiring", inventory.Expiring)
+	http.HandleFunc("GET /inventory/low-stock", inventory.LowStock)
+	http.HandleFunc("GET /inventory/reorder-suggestions", inventory.ReorderSuggestions)
+
+	// GET /products/barcode/{code} and GET /products/{id}/stock-history both
+	// match /products/barcode/stock-history, which ServeMux refuses to
+	// register, so a single pattern dispatches every GET /products/{id}/{sub}
+	http.HandleFunc("GET /products/{id}/{sub}", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.PathValue("id") == "barcode":
+			r.SetPathValue("code", r.PathValue("sub"))
+			products.GetByBarcode(w, r)
+		case r.PathValue("sub") == "stock-history":
+			inventory.StockHistory(w, r)
+		case r.PathValue("sub") == "lots":
+			inventory.Lots(w, r)
+		default:
+			api.NotFound(w, r)
+		}
+	})
+
+	// Product variant routes
+	http.HandleFunc("POST /products/{id}/variants", variants.Create)
+	http.HandleFunc("PUT /products/{id}/variants/{variantId}", variants.Update)
+	http.HandleFunc("DELETE /products/{id}/variants/{variantId}", variants.Delete)
+
+	// Outlet routes
+	http.HandleFunc("GET /outlets", outlets.GetAll)
+	http.HandleFunc("GET /outlets/{id}", outlets.GetByID)
+	http.HandleFunc("POST /outlets", outlets.Create)
+	http.HandleFunc("PUT /outlets/{id}", outlets.Update)
+
+	// Stock transfer routes
+	http.HandleFunc("GET /stock-transfers", transfers.GetAll)
+	http.HandleFunc("GET /stock-transfers/{id}", transfers.GetByID)
+	http.HandleFunc("POST /stock-transfers", transfers.Create)
+	http.HandleFunc("POST /stock-transfers/{id}/ship", transfers.Ship)
+	http.HandleFunc("POST /stock-transfers/{id}/receive", transfers.Receive)
+	http.HandleFunc("POST /stock-transfers/{id}/cancel", transfers.Cancel)
+
+	// Stock take routes
+	http.HandleFunc("GET /stock-takes", stockTakes.GetAll)
+	http.HandleFunc("GET /stock-takes/{id}", stockTakes.GetByID)
+	http.HandleFunc("POST /stock-takes", stockTakes.Create)
+	http.HandleFunc("POST /stock-takes/{id}/counts", stockTakes.Count)
+	http.HandleFunc("POST /stock-takes/{id}/finalize", stockTakes.Finalize)
+	http.HandleFunc("POST /stock-takes/{id}/cancel", stockTakes.Cancel)
+
+	// Shift routes
+	http.HandleFunc("GET /shifts", shifts.GetAll)
+	http.HandleFunc("GET /shifts/{id}", shifts.GetByID)
+	http.HandleFunc("POST /shifts", shifts.Create)
+	http.HandleFunc("POST /shifts/{id}/close", shifts.Close)
+
+	// Supplier routes
+	http.HandleFunc("GET /suppliers", suppliers.GetAll)
+	http.HandleFunc("GET /suppliers/{id}", suppliers.GetByID)
+	http.HandleFunc("POST /suppliers", suppliers.Create)
+	http.HandleFunc("PUT /suppliers/{id}", suppliers.Update)
+
+	// Purchase order routes
+	http.HandleFunc("GET /purchase-orders", purchaseOrders.GetAll)
+	http.HandleFunc("GET /purchase-orders/{id}", purchaseOrders.GetByID)
+	http.HandleFunc("POST /purchase-orders", purchaseOrders.Create)
+	http.HandleFunc("PUT /purchase-orders/{id}", purchaseOrders.Update)
+	http.HandleFunc("POST /purchase-orders/{id}/order", purchaseOrders.Order)
+	http.HandleFunc("POST /purchase-orders/{id}/cancel", purchaseOrders.Cancel)
+	http.HandleFunc("POST /purchase-orders/{id}/receipts", purchaseOrders.Receive)
 
 	// Checkout routes
 	http.HandleFunc("POST /checkout", checkout.Create)
 
+	// Transaction routes
+	http.HandleFunc("GET /transactions", transactions.GetAll)
+	http.HandleFunc("GET /transactions/{id}", transactions.GetByID)
+	http.HandleFunc("POST /transactions/{id}/payments", transactions.AddPayments)
+	http.HandleFunc("POST /transactions/{id}/returns", transactions.CreateReturn)
+	http.HandleFunc("POST /transactions/{id}/void", transactions.Void)
+
 	// Report routes
 	http.HandleFunc("GET /report/hari-ini", report.Today)
 	http.HandleFunc("GET /report", report.Range)
+	http.HandleFunc("GET /report/categories", report.Categories)
+	http.HandleFunc("GET /report/payments", report.Payments)
 
 	// Original endpoints
 	http.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
@@ -96,5 +209,5 @@ func main() {
 
 	addr := fmt.Sprintf(":%s", cfg.Port)
 	log.Printf("Server starting on port %s", cfg.Port)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	log.Fatal(http.ListenAndServe(addr, api.RequestID(http.DefaultServeMux)))
 }